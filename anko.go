@@ -2,28 +2,108 @@
 package anko
 
 import (
+	"cmp"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ancientcatz/anko/extras"
 	"github.com/d5/tengo/v2"
-	"gopkg.in/yaml.v2"
+	req "github.com/imroc/req/v3"
 )
 
 // Engine holds the parsed YAML configuration, a structured logger,
 // caches compiled Tengo scripts, and a customizable deny list.
+// Its methods are safe for concurrent use; the exported fields must not be
+// modified while rules are running.
 type Engine struct {
+	mu sync.Mutex
+
 	Metadata      Metadata
 	Env           map[string]any
 	Rules         map[string]Rule
 	Functions     map[string]string
-	compiledCache map[string]*tengo.Compiled
+	Schemas       map[string]Schema
+	Selectors     map[string]string
+	Changelog     []ChangelogEntry
+	HTTP          HTTPConfig
+	Security      SecurityConfig
+	Chapters      ChapterConfig
+	Warm          []string
+	compiledCache *ruleCache
+	codeOffsets   map[string]int
+	ruleModules   map[string][]string
 	Logger        *slog.Logger
-	denyLibs      []string
 	CacheEnabled  bool
-	lastInputs    map[string]string
+
+	// settings are shared with the engine's tenants; the fields below are
+	// the state of this engine alone.
+	settings
+
+	mirror      mirrorState
+	stats       Stats
+	history     map[string]*runHistory
+	warm        *sync.Once
+	tenants     map[string]*Engine
+	tenantID    string
+	lastRequest atomic.Int64
+	logs        *logSwitch
+	httpClient  *req.Client
+	cursors     map[cursorKey]any
+}
+
+// settings configure an Engine through its options and setters. Tenant
+// copies them as a whole, so that a setting added here reaches the tenants
+// without further changes; maps and slices that setters modify in place
+// are cloned there.
+type settings struct {
+	denyLibs           []string
+	mirrorFailureLimit int
+	probe              func(client *req.Client, url string) bool
+	slowThreshold      time.Duration
+	historySize        int
+	throttle           *throttle
+
+	canonicalURLs bool
+	precompile    bool
+	hostFuncs     map[string]HostFunc
+	converters    []Converter
+	moduleConfig  extras.Config
+	hooks         []Hook
+	taxonomy      *taxonomy
+	cacheManager  *CacheManager
+	funcs         map[string]*tengo.UserFunction
+	limits        Limits
+	allowedHosts  []string
+	trustedKeys   []ed25519.PublicKey
+	secrets       SecretProvider
+	credentials   map[string]extras.Credentials
+	proxy         string
+	contentPolicy ContentPolicy
+	translator    Translator
+	store         Store
+	translateTo   string
+	httpTimeout   time.Duration
+	retryPolicy   extras.RetryPolicy
+	rateLimit     *extras.RateLimiter
+	features      Features
+
+	chapterPatterns   chapterPatterns
+	selectorOverrides map[string]string
 }
 
 // Metadata holds the top‑level anko metadata.
@@ -34,49 +114,446 @@ type Metadata struct {
 	Language   string   `yaml:"language"`
 	Sources    []string `yaml:"sources"`
 	Identifier string   `yaml:"identifier"`
+
+	Concurrency Concurrency `yaml:"concurrency"`
+
+	// Capabilities, when set, restricts the modules the rules may import to
+	// those granted by these capabilities (see Capabilities). When unset,
+	// the rules may import every module not denied by the engine.
+	Capabilities []string `yaml:"capabilities"`
+
+	// Deprecated is set for sources that are being retired.
+	Deprecated *Deprecation `yaml:"deprecated"`
+}
+
+// Deprecation explains why a source is deprecated and, optionally, names the
+// identifier of the source that replaces it.
+type Deprecation struct {
+	Reason                string `yaml:"reason"`
+	ReplacementIdentifier string `yaml:"replacement_identifier"`
+}
+
+// Option configures an Engine at construction time.
+type Option func(*Engine)
+
+// WithCanonicalURLs makes the novel rules canonicalize every URL they return
+// (see extras.CanonicalURL), so cache keys and deduplication stay consistent.
+func WithCanonicalURLs() Option {
+	return func(e *Engine) {
+		e.canonicalURLs = true
+	}
+}
+
+// WithPrecompile makes every Load method compile all rules eagerly, as
+// Precompile does, and fail when one of them does not compile.
+func WithPrecompile() Option {
+	return func(e *Engine) {
+		e.precompile = true
+	}
 }
 
-// NewEngine creates a new Engine with the given *slog.Logger.
-// It sets a default deny list.
-func NewEngine(logger *slog.Logger) *Engine {
-	return &Engine{
-		compiledCache: make(map[string]*tengo.Compiled),
+// WithRequestSigner signs every request the source's rules send with signer,
+// e.g. extras.HMACSigner for APIs that require signed requests.
+func WithRequestSigner(signer extras.Signer) Option {
+	return func(e *Engine) {
+		e.moduleConfig.Signer = signer
+	}
+}
+
+// NewEngine creates a new Engine with the given *slog.Logger and options.
+// A nil logger logs to slog.Default. It sets a default deny list.
+func NewEngine(logger *slog.Logger, opts ...Option) *Engine {
+	logger, logs := newSwitchLogger(logger)
+	e := &Engine{
+		compiledCache: newRuleCache(),
+		codeOffsets:   make(map[string]int),
+		ruleModules:   make(map[string][]string),
 		Logger:        logger,
-		denyLibs:      []string{},
+		logs:          logs,
 		CacheEnabled:  true,
-		lastInputs:    make(map[string]string),
+
+		settings: settings{
+			denyLibs:           []string{},
+			mirrorFailureLimit: defaultMirrorFailureLimit,
+			probe:              probeMirror,
+			historySize:        defaultHistorySize,
+
+			funcs: map[string]*tengo.UserFunction{
+				"url_encode":    addURLEncode(),
+				"to_title_case": addToTitleCase(),
+			},
+		},
 	}
+	e.taxonomy = newTaxonomy()
+	e.moduleConfig.OnRequest = e.observeRequest
+	e.moduleConfig.OnDownload = e.observeDownload
+	e.moduleConfig.Jar = extras.NewCookieJar()
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.store == nil {
+		e.store = NewMemoryStore()
+	}
+	return e
 }
 
 // SetDenyLibs allows customizing the deny list.
 func (e *Engine) SetDenyLibs(deny ...string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	e.denyLibs = deny
 }
 
 // EnableCache turns rule‐level caching on.
 func (e *Engine) EnableCache() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	e.CacheEnabled = true
 }
 
 // DisableCache turns rule‐level caching off and clears any existing cache.
 func (e *Engine) DisableCache() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	e.CacheEnabled = false
-	e.compiledCache = make(map[string]*tengo.Compiled)
-	e.lastInputs = make(map[string]string)
+	e.compiledCache.clear()
+}
+
+// reservedGlobals are script globals set by the engine itself.
+var reservedGlobals = []string{"env", "deps", "host", "selectors", "features", "translate", "result"}
+
+// isReservedGlobal reports whether name is a global the engine sets for a
+// run: one of reservedGlobals or a context module, such as req or times,
+// including the extra modules compiled out of this build.
+func isReservedGlobal(name string) bool {
+	_, unavailable := extras.UnavailableModules[name]
+	return slices.Contains(reservedGlobals, name) || extras.IsContextModule(name) || unavailable
+}
+
+// RegisterFunction exposes fn to every rule as the global function name,
+// alongside the built-in url_encode and to_title_case, which it may replace.
+// Names of globals the engine sets, such as env or the req module, are
+// refused. Cached compilations are dropped so later runs see the function.
+func (e *Engine) RegisterFunction(name string, fn tengo.CallableFunc) {
+	if isReservedGlobal(name) {
+		e.Logger.Warn("Cannot register reserved global", "name", name)
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.funcs == nil {
+		e.funcs = make(map[string]*tengo.UserFunction)
+	}
+	e.funcs[name] = &tengo.UserFunction{Name: name, Value: fn}
+	e.compiledCache.clear()
+}
+
+// SetHTTPTimeout sets the default timeout of req module requests for sources
+// whose http section sets none. Scripts can override it per request with the
+// timeout option (milliseconds).
+func (e *Engine) SetHTTPTimeout(d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.httpTimeout = d
+	if e.HTTP.Timeout <= 0 {
+		e.moduleConfig.HTTPTimeout = d
+	}
+	e.compiledCache.clear()
+}
+
+// SetRetryPolicy sets the retry policy of req module requests for sources
+// whose http section sets none. Scripts can override it per request with the
+// retries and retry options.
+func (e *Engine) SetRetryPolicy(p extras.RetryPolicy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.retryPolicy = p
+	if e.HTTP.Retry == nil {
+		e.moduleConfig.Retry = p
+	}
+	e.compiledCache.clear()
+}
+
+// SetRateLimit limits the req module to requests requests to each host per
+// per, for sources whose http section sets no rate_limit, so bulk downloads
+// do not get the client banned. Requests over the limit wait for their turn.
+// Tenant engines share the limit. A zero requests removes it.
+func (e *Engine) SetRateLimit(requests int, per time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rateLimit = nil
+	if requests > 0 && per > 0 {
+		e.rateLimit = extras.NewRateLimiter(requests, per)
+	}
+	if e.HTTP.RateLimit == nil {
+		e.moduleConfig.RateLimit = e.rateLimit
+	}
+	e.compiledCache.clear()
+}
+
+// SetChallengeSolver forwards the GETs of rules answered with an anti-bot
+// challenge page, such as Cloudflare's, to the FlareSolverr server at
+// endpoint, e.g. "http://localhost:8191", and returns the solved page to the
+// rule (see extras.ChallengeSolver). An empty endpoint turns solving off.
+// Tenant engines created afterwards share the solver.
+func (e *Engine) SetChallengeSolver(endpoint string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.moduleConfig.Solver = nil
+	if endpoint != "" {
+		e.moduleConfig.Solver = extras.NewChallengeSolver(endpoint)
+	}
+	e.compiledCache.clear()
+}
+
+// SetBrowser lets rules render pages with JavaScript in b through the
+// browser module, and sets features.browser_available. A nil b, the
+// default, leaves the module without a browser. The caller closes b once
+// done with the engine; tenant engines created afterwards share it.
+func (e *Engine) SetBrowser(b *extras.Browser) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.moduleConfig.Browser = b
+	e.compiledCache.clear()
+}
+
+// SetProxy sends the requests of the req module through the proxy at
+// proxyURL, e.g. "socks5://127.0.0.1:1080", taking precedence over the
+// source's http.proxy. An empty proxyURL falls back to http.proxy. Tenant
+// engines created afterwards inherit the proxy.
+func (e *Engine) SetProxy(proxyURL string) error {
+	if proxyURL != "" {
+		if u, err := url.Parse(proxyURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return withCode(CodeConfigInvalid, fmt.Errorf("invalid proxy '%s'", proxyURL))
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.proxy = proxyURL
+	e.moduleConfig.Proxy = cmp.Or(proxyURL, e.HTTP.Proxy)
+	e.rebuildClient()
+	e.compiledCache.clear()
+	return nil
+}
+
+// SetDownloadDir lets rules write files with req.download, such as cover
+// images, to paths inside dir. An empty dir, the default, disables
+// downloads. Tenant engines created afterwards inherit the directory.
+func (e *Engine) SetDownloadDir(dir string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.moduleConfig.DownloadDir = dir
+	e.compiledCache.clear()
+}
+
+// SetHTTPRecorder records the responses to req module requests as files in
+// dir and replays them on later runs, as selected by mode, so rule tests are
+// hermetic. An empty dir turns recording off. Tenant engines created
+// afterwards inherit the recorder.
+func (e *Engine) SetHTTPRecorder(dir string, mode extras.RecordMode) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.moduleConfig.Recorder = nil
+	if dir != "" {
+		e.moduleConfig.Recorder = &extras.Recorder{Dir: dir, Mode: mode}
+	}
+	e.rebuildClient()
+	e.compiledCache.clear()
+}
+
+// SetHTTPTransport makes the req module send its requests through rt instead
+// of the network, e.g. a mock in unit tests or a transport routing traffic
+// through the application's own stack. The engine's host allowlist, recorder
+// and signer still apply. A nil rt restores the network.
+func (e *Engine) SetHTTPTransport(rt http.RoundTripper) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.moduleConfig.Transport = rt
+	e.rebuildClient()
+	e.compiledCache.clear()
+}
+
+// SetHTTPClient makes the req module use client, configured by the
+// application, for every request of the source's rules, including those of
+// tenant engines. The engine does not modify it, so the source's http
+// section, the host allowlist, recorder and signer settings and the session
+// cookie jar (see ExportCookies) do not apply. A nil client
+// restores the engine's own client.
+func (e *Engine) SetHTTPClient(client *req.Client) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.httpClient = client
+	e.rebuildClient()
+	e.compiledCache.clear()
+}
+
+// rebuildClient replaces the req module client after a configuration change.
+// The caller must hold e.mu.
+func (e *Engine) rebuildClient() {
+	if e.httpClient != nil {
+		e.moduleConfig.Client = e.httpClient
+		return
+	}
+	e.moduleConfig.Client = extras.NewClient(e.moduleConfig)
 }
 
 // Rule represents an individual rule from the YAML.
 type Rule struct {
 	Imports []string `yaml:"imports"`
 	Code    string   `yaml:"code"`
+
+	// Needs lists rules run before this one; their results are available to
+	// the code as deps["<rule>"].
+	Needs []string `yaml:"needs"`
+
+	// Description, Params and Returns document the rule for host tooling;
+	// they are not used when running it.
+	Description string      `yaml:"description"`
+	Params      []RuleParam `yaml:"params"`
+	Returns     string      `yaml:"returns"`
+
+	// Timeout aborts a run of the rule that takes longer, e.g. "30s". It
+	// takes precedence over the max_execution_time limit.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Limits overrides the engine limits (see SetLimits) for this rule.
+	Limits *Limits `yaml:"limits"`
+
+	// Tests are run by RunTests.
+	Tests []RuleTest `yaml:"tests"`
+
+	pos sourcePos
+}
+
+// RuleParam documents an env key read by a rule.
+type RuleParam struct {
+	Name        string `yaml:"name"`
+	Type        string `yaml:"type"`
+	Description string `yaml:"description"`
+	Required    bool   `yaml:"required"`
+}
+
+// RuleDoc is the documentation of a rule as returned by DescribeRule.
+type RuleDoc struct {
+	Name        string
+	Description string
+	Params      []RuleParam
+	Returns     string
+	Imports     []string
+	Needs       []string
+}
+
+// HTTPConfig is the http section of the YAML, configuring the req module
+// client for the source.
+//
+//	http:
+//	  impersonate: firefox
+//	  user_agent: MyReader/1.0
+//	  headers: {Accept-Language: ja}
+//	  timeout: 20s
+//	  proxy: socks5://127.0.0.1:1080
+//	  max_redirects: 3
+//	  random_identity: true
+type HTTPConfig struct {
+	// Protocol is one of "http1", "http2", "http3" or empty for the default.
+	Protocol string `yaml:"protocol"`
+	// Impersonate is the browser the client mimics: "chrome" (the default),
+	// "firefox", "safari" or "none" (see extras.Config.Impersonate).
+	Impersonate string `yaml:"impersonate"`
+	// UserAgent replaces the User-Agent of the impersonated browser.
+	UserAgent string `yaml:"user_agent"`
+	// Headers are sent with every request unless the script sets them.
+	Headers map[string]string `yaml:"headers"`
+	// Timeout, when set, is the default timeout of the source's requests,
+	// taking precedence over SetHTTPTimeout.
+	Timeout time.Duration `yaml:"timeout"`
+	// Proxy is the URL of a proxy for the source's requests. Its host must
+	// have been allowed by the application with SetAllowedHosts; SetProxy
+	// takes precedence.
+	Proxy string `yaml:"proxy"`
+	// MaxRedirects limits the redirects followed per request; zero keeps
+	// the default and a negative value follows none.
+	MaxRedirects int `yaml:"max_redirects"`
+	// Retry, when set, is the retry policy of the source's requests, taking
+	// precedence over SetRetryPolicy.
+	Retry *RetryConfig `yaml:"retry"`
+	// RateLimit, when set, limits the requests per host, taking precedence
+	// over SetRateLimit.
+	RateLimit *RateLimitConfig `yaml:"rate_limit"`
+	// Memoize makes a rule run reuse the response of a GET it repeats
+	// instead of sending it again (see extras.Config.MemoizeGets).
+	Memoize bool `yaml:"memoize"`
+	// RandomIdentity gives every rule run a random User-Agent of the
+	// impersonated browser, Accept-Language and viewport hint, seeded with
+	// the novel of the env so runs for one novel share their identity (see
+	// identitySeed and extras.RandomIdentity).
+	RandomIdentity bool `yaml:"random_identity"`
+}
+
+// RetryConfig is the retry subsection of the http section (see
+// extras.RetryPolicy):
+//
+//	retry:
+//	  attempts: 4
+//	  backoff: 1s
+//	  max_backoff: 20s
+//	  jitter: false
+//	  statuses: [429, 502, 503]
+type RetryConfig struct {
+	Attempts   int           `yaml:"attempts"`
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+	Jitter     *bool         `yaml:"jitter"`
+	Statuses   []int         `yaml:"statuses"`
+}
+
+// policy returns the retry policy described by c.
+func (c RetryConfig) policy() extras.RetryPolicy {
+	return extras.RetryPolicy{
+		MaxAttempts: c.Attempts,
+		BaseDelay:   c.Backoff,
+		MaxDelay:    c.MaxBackoff,
+		NoJitter:    c.Jitter != nil && !*c.Jitter,
+		Statuses:    c.Statuses,
+	}
+}
+
+// RateLimitConfig is the rate_limit subsection of the http section: at most
+// Requests requests to each host per Per, e.g.
+//
+//	rate_limit: {requests: 2, per: 1s}
+type RateLimitConfig struct {
+	Requests int           `yaml:"requests"`
+	Per      time.Duration `yaml:"per"`
+}
+
+// SecurityConfig is the security section of the YAML.
+type SecurityConfig struct {
+	// AllowedHosts are hosts, besides those of Metadata.Sources, that the req
+	// module may send requests to; subdomains are included. Sources listing
+	// neither may contact any host.
+	AllowedHosts []string `yaml:"allowed_hosts"`
 }
 
 // YAMLData represents the overall YAML structure.
 type YAMLData struct {
-	Metadata  Metadata          `yaml:"anko"`
-	Env       map[string]any    `yaml:"env"`
+	Metadata Metadata       `yaml:"anko"`
+	Env      map[string]any `yaml:"env"`
+	// Secrets maps env keys to the names of secrets resolved into them at
+	// load time (see SecretProvider).
+	Secrets   map[string]string `yaml:"secrets"`
 	Rules     map[string]Rule   `yaml:"rules"`
 	Functions map[string]string `yaml:"functions"`
+	Schemas   map[string]Schema `yaml:"schemas"`
+	// Selectors are named constants, typically XPath expressions, exposed
+	// to the rules as the immutable map selectors. Hosts can override them
+	// with OverrideSelector.
+	Selectors map[string]string `yaml:"selectors"`
+	HTTP      HTTPConfig        `yaml:"http"`
+	Security  SecurityConfig    `yaml:"security"`
+	Chapters  ChapterConfig     `yaml:"chapters"`
+	Warm      []string          `yaml:"warm"`
+	Changelog []ChangelogEntry  `yaml:"changelog"`
 }
 
 // LoadFile loads and parses the YAML file and populates the Engine.
@@ -84,133 +561,626 @@ func (e *Engine) LoadFile(filename string) error {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		e.Logger.Error("Error reading YAML file", "error", err)
-		return fmt.Errorf("error reading YAML file: %w", err)
+		return withCode(CodeIO, fmt.Errorf("error reading YAML file: %w", err))
+	}
+	if err := e.verifyFile(filename, data, os.ReadFile); err != nil {
+		return err
+	}
+	if err := e.loadBytes(data, filename); err != nil {
+		return err
+	}
+	e.Logger.Debug("anko loaded", "filename", filename)
+	return nil
+}
+
+// LoadReader reads a YAML source definition from r and populates the Engine.
+func (e *Engine) LoadReader(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		e.Logger.Error("Error reading YAML", "error", err)
+		return withCode(CodeIO, fmt.Errorf("error reading YAML: %w", err))
+	}
+	return e.LoadBytes(data)
+}
+
+// LoadFS loads the YAML file at path from fsys, e.g. an embed.FS.
+func (e *Engine) LoadFS(fsys fs.FS, path string) error {
+	data, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		e.Logger.Error("Error reading YAML file", "error", err)
+		return withCode(CodeIO, fmt.Errorf("error reading YAML file: %w", err))
+	}
+	if err := e.verifyFile(path, data, func(name string) ([]byte, error) { return fs.ReadFile(fsys, name) }); err != nil {
+		return err
 	}
+	if err := e.loadBytes(data, path); err != nil {
+		return err
+	}
+	e.Logger.Debug("anko loaded", "filename", path)
+	return nil
+}
+
+// LoadBytes parses a YAML source definition and populates the Engine.
+// The data may hold several "---" separated documents, which are merged as
+// described in LoadDir.
+func (e *Engine) LoadBytes(data []byte) error {
+	return e.loadBytes(data, "")
+}
+
+// loadBytes is LoadBytes with the name of the file the data was read from,
+// used to report rule errors at their YAML position.
+func (e *Engine) loadBytes(data []byte, file string) error {
 	var y YAMLData
-	if err := yaml.Unmarshal(data, &y); err != nil {
-		e.Logger.Error("Error parsing YAML file", "error", err)
-		return fmt.Errorf("error parsing YAML: %w", err)
+	if err := e.decodeDocuments(&y, data, file); err != nil {
+		return err
+	}
+	return e.apply(y)
+}
+
+// apply validates a parsed definition and makes it the Engine's source.
+func (e *Engine) apply(y YAMLData) error {
+	if !slices.Contains(extras.Protocols, y.HTTP.Protocol) {
+		e.Logger.Error("Unknown HTTP protocol", "protocol", y.HTTP.Protocol)
+		return withCode(CodeConfigInvalid, fmt.Errorf("unknown http.protocol '%s'", y.HTTP.Protocol))
+	}
+	if !slices.Contains(extras.Impersonations, y.HTTP.Impersonate) {
+		e.Logger.Error("Unknown HTTP impersonation profile", "impersonate", y.HTTP.Impersonate)
+		return withCode(CodeConfigInvalid, fmt.Errorf("unknown http.impersonate '%s'", y.HTTP.Impersonate))
+	}
+	if rl := y.HTTP.RateLimit; rl != nil && (rl.Requests <= 0 || rl.Per <= 0) {
+		e.Logger.Error("Invalid HTTP rate limit", "requests", rl.Requests, "per", rl.Per)
+		return withCode(CodeConfigInvalid, errors.New("http.rate_limit needs positive requests and per"))
+	}
+	if y.HTTP.Proxy != "" {
+		u, err := url.Parse(y.HTTP.Proxy)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			e.Logger.Error("Invalid HTTP proxy", "proxy", y.HTTP.Proxy)
+			return withCode(CodeConfigInvalid, fmt.Errorf("invalid http.proxy '%s'", y.HTTP.Proxy))
+		}
+		// The proxy sees all traffic of the source, cookies and credentials
+		// included, so the source cannot choose it: only hosts granted by
+		// the application with SetAllowedHosts may serve as proxies.
+		e.mu.Lock()
+		granted := slices.Clone(e.allowedHosts)
+		e.mu.Unlock()
+		if !extras.HostAllowed(u.Hostname(), granted) {
+			e.Logger.Error("HTTP proxy not allowed", "proxy", y.HTTP.Proxy)
+			return withCode(CodeConfigInvalid, fmt.Errorf("http.proxy '%s' is not an allowed host", y.HTTP.Proxy))
+		}
 	}
+	chapters, err := y.Chapters.compile()
+	if err != nil {
+		e.Logger.Error("Invalid chapters section", "error", err)
+		return err
+	}
+	env, err := e.resolveEnv(y.Env, y.Secrets)
+	if err != nil {
+		e.Logger.Error("Cannot resolve source secrets", "error", err)
+		return err
+	}
+	if err := checkModules(y.Rules); err != nil {
+		e.Logger.Error("Source imports unavailable modules", "error", err)
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(y.Schemas)) {
+		if err := y.Schemas[name].validate("schemas." + name); err != nil {
+			e.Logger.Error("Invalid schema", "rule", name, "error", err)
+			return err
+		}
+	}
+	for _, c := range y.Metadata.Capabilities {
+		if _, ok := Capabilities[c]; !ok {
+			e.Logger.Error("Unknown capability", "capability", c)
+			return withCode(CodeConfigInvalid, fmt.Errorf("unknown capability '%s'", c))
+		}
+	}
+	if d := y.Metadata.Deprecated; d != nil {
+		e.Logger.Warn("Source is deprecated", "source", y.Metadata.Identifier, "reason", d.Reason, "replacement", d.ReplacementIdentifier)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	e.Metadata = y.Metadata
-	e.Env = y.Env
+	e.Env = env
 	e.Rules = y.Rules
 	e.Functions = y.Functions
-	e.Logger.Debug("anko loaded", "filename", filename)
+	e.Schemas = y.Schemas
+	e.Selectors = y.Selectors
+	e.Changelog = y.Changelog
+	e.HTTP = y.HTTP
+	e.Security = y.Security
+	e.Chapters = y.Chapters
+	e.chapterPatterns = chapters
+	e.Warm = y.Warm
+	e.moduleConfig.Protocol = y.HTTP.Protocol
+	e.moduleConfig.MemoizeGets = y.HTTP.Memoize
+	e.moduleConfig.RandomIdentity = y.HTTP.RandomIdentity
+	e.moduleConfig.Impersonate = y.HTTP.Impersonate
+	e.moduleConfig.UserAgent = y.HTTP.UserAgent
+	e.moduleConfig.Headers = y.HTTP.Headers
+	e.moduleConfig.Proxy = y.HTTP.Proxy
+	if e.proxy != "" {
+		e.moduleConfig.Proxy = e.proxy
+	}
+	e.moduleConfig.MaxRedirects = y.HTTP.MaxRedirects
+	e.moduleConfig.HTTPTimeout = e.httpTimeout
+	if y.HTTP.Timeout > 0 {
+		e.moduleConfig.HTTPTimeout = y.HTTP.Timeout
+	}
+	e.moduleConfig.Retry = e.retryPolicy
+	if y.HTTP.Retry != nil {
+		e.moduleConfig.Retry = y.HTTP.Retry.policy()
+	}
+	e.moduleConfig.RateLimit = e.rateLimit
+	if rl := y.HTTP.RateLimit; rl != nil {
+		e.moduleConfig.RateLimit = extras.NewRateLimiter(rl.Requests, rl.Per)
+	}
+	e.moduleConfig.AllowedHosts = e.hostAllowlist()
+	e.moduleConfig.Credentials = e.sourceCredentials()
+	e.rebuildClient()
+	e.warm = nil
+	e.mirror = mirrorState{}
+	e.throttle = newThrottle(y.Metadata.Concurrency)
+	e.compiledCache.clear()
+	e.codeOffsets = make(map[string]int)
+	e.ruleModules = make(map[string][]string)
+	e.tenants = nil
+	e.cursors = nil
+	if e.precompile {
+		return e.precompileRules()
+	}
 	return nil
 }
 
+// Precompile compiles every rule now instead of on its first run and stores
+// the results in the cache, so the first call on a cold engine does not pay
+// the compile latency. Compile errors of all failing rules are joined into
+// the returned error. With caching disabled the rules are only checked.
+func (e *Engine) Precompile() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.precompileRules()
+}
+
+// precompileRules implements Precompile. The caller must hold e.mu.
+func (e *Engine) precompileRules() error {
+	names := make([]string, 0, len(e.Rules))
+	for name := range e.Rules {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var errs []error
+	for _, name := range names {
+		compiled, err := e.compileRule(context.Background(), name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if e.CacheEnabled {
+			e.compiledCache.put(name, compiled)
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // RunRule compiles (or reuses a cached) rule and runs it.
 // It returns the compiled Tengo script and an error.
+// When Metadata.Sources is set, base_url is filled from the first reachable
+// mirror and rotated after repeated network or HTTP failures.
+// Cached scripts are cloned for every run, so RunRule is safe to call from
+// multiple goroutines.
 func (e *Engine) RunRule(ruleName string) (*tengo.Compiled, error) {
+	return e.runRule(ruleName, nil)
+}
+
+// RunRuleWithEnv runs a rule with env merged over Engine.Env. The merged env
+// is injected into the script at run time, so Engine.Env is left untouched
+// and the cached compilation is reused for every env.
+func (e *Engine) RunRuleWithEnv(ruleName string, env map[string]any) (*tengo.Compiled, error) {
+	return e.runRule(ruleName, env)
+}
+
+// RunRuleContext is RunRuleWithEnv with a context: cancelling ctx aborts the
+// script and the HTTP requests and sleeps in flight in its modules.
+func (e *Engine) RunRuleContext(ctx context.Context, ruleName string, env map[string]any) (*tengo.Compiled, error) {
+	return e.runRuleContext(ctx, ruleName, env)
+}
+
+func (e *Engine) runRule(ruleName string, env map[string]any) (*tengo.Compiled, error) {
+	return e.runRuleContext(context.Background(), ruleName, env)
+}
+
+// runRuleContext runs the rules ruleName needs and then ruleName itself, all
+// with the same env and context, in an anko.RunRule span.
+func (e *Engine) runRuleContext(ctx context.Context, ruleName string, env map[string]any) (*tengo.Compiled, error) {
+	e.mu.Lock()
+	ctx, span := e.startSpan(ctx, e.tracer(), "anko.RunRule", ruleName)
+	e.mu.Unlock()
+	compiled, err := e.runWithNeeds(ctx, ruleName, env)
+	endSpan(span, err)
+	return compiled, err
+}
+
+// runWithNeeds implements runRuleContext.
+func (e *Engine) runWithNeeds(ctx context.Context, ruleName string, env map[string]any) (*tengo.Compiled, error) {
+	e.mu.Lock()
+	order, err := e.needsOrder(ruleName)
+	needs := make(map[string][]string, len(order))
+	for _, name := range order {
+		needs[name] = e.Rules[name].Needs
+	}
+	e.mu.Unlock()
+	if err != nil {
+		e.Logger.Error("Cannot resolve rule dependencies", "rule", ruleName, "error", err)
+		return nil, err
+	}
+
+	results := make(map[string]any, len(order))
+	depsFor := func(name string) map[string]any {
+		if len(needs[name]) == 0 {
+			return nil
+		}
+		deps := make(map[string]any, len(needs[name]))
+		for _, dep := range needs[name] {
+			deps[dep] = results[dep]
+		}
+		return deps
+	}
+	for _, dep := range order[:len(order)-1] {
+		compiled, err := e.runSingle(ctx, dep, env, depsFor(dep))
+		if err != nil {
+			return nil, fmt.Errorf("dependency of rule '%s': %w", ruleName, err)
+		}
+		results[dep] = compiled.Get("result").Value()
+	}
+	return e.runSingle(ctx, ruleName, env, depsFor(ruleName))
+}
+
+// runSingle prepares the script under the engine lock and runs it with env
+// and, for rules with needs, deps without holding the lock. The rule's
+// context modules are rebuilt for the run from a fresh invocation, bound to a
+// context derived from ctx that ends with the run.
+func (e *Engine) runSingle(ctx context.Context, ruleName string, env map[string]any, deps map[string]any) (*tengo.Compiled, error) {
+	start := time.Now()
+	e.mu.Lock()
+	hooks := e.hooks
+	limits := e.ruleLimits(ruleName)
+	tracer := e.tracer()
+	e.mu.Unlock()
+
+	p, err := e.prepareRule(ctx, ruleName, env)
+	compiled := p.compiled
+	if err == nil {
+		e.warmUp(ctx)
+	}
+	ran := err == nil
+	if ran {
+		for _, h := range hooks {
+			h.BeforeRun(ruleName, p.env)
+		}
+		e.mu.Lock()
+		spanCtx, span := e.startSpan(ctx, tracer, "anko.Run", ruleName)
+		e.mu.Unlock()
+		// The rule's time limit starts once the throttle lets it run, so
+		// that time spent queued does not count against it.
+		var inv *extras.Invocation
+		if err = p.throttle.acquire(spanCtx); err != nil {
+			err = withCode(CodeCanceled, err)
+		} else {
+			inv, err = e.startRun(ctx, spanCtx, compiled, p, deps, limits)
+			p.throttle.release()
+		}
+		endSpan(span, err)
+		var signals runSignals
+		if inv != nil {
+			signals = runSignals{status: inv.LastStatus(), challenged: inv.Challenged()}
+		}
+		if s, ok := ctx.Value(signalsKey{}).(*runSignals); ok {
+			*s = signals
+		}
+		if err != nil {
+			e.mu.Lock()
+			err = e.mapErrorPositions(ruleName, err)
+			e.mu.Unlock()
+			e.Logger.Error("Engine error", withPrefixes("rule", ruleName, err)...)
+			err = withCode(runtimeCode(err), fmt.Errorf("failed to run rule '%s': %w", ruleName, err))
+			err = withHint(classifyFailure(Code(err), signals), err)
+		}
+	}
+
+	elapsed := time.Since(start)
+	e.mu.Lock()
+	if ran {
+		e.recordMirrorResult(err)
+	}
+	slow := e.recordRun(ruleName, elapsed, err)
+	report := RunReport{Rule: ruleName, Started: start, Duration: elapsed, Code: Code(err), Hint: Hint(err), Slow: slow > 0}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	e.recordHistory(report)
+	e.mu.Unlock()
+
+	if len(hooks) > 0 {
+		var result any
+		if err == nil {
+			result = compiled.Get("result").Value()
+		}
+		for _, h := range hooks {
+			h.AfterRun(ruleName, result, err, elapsed)
+			if sh, ok := h.(SlowRunHook); ok && slow > 0 {
+				sh.SlowRun(ruleName, elapsed, slow)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return compiled, nil
+}
+
+// startRun sets the globals of the prepared run p on compiled and runs it
+// under spanCtx within the time limit of limits. It returns the invocation
+// of the run's modules with the run's error.
+func (e *Engine) startRun(ctx, spanCtx context.Context, compiled *tengo.Compiled, p preparedRun, deps map[string]any, limits Limits) (*extras.Invocation, error) {
+	timeout := limits.MaxExecutionTime
+	runCtx, cancel := context.WithCancel(spanCtx)
+	defer cancel()
+	if timeout > 0 {
+		runCtx, cancel = context.WithTimeout(runCtx, timeout)
+		defer cancel()
+	}
+	err := compiled.Set("env", createEnvVariable(p.env, p.converters))
+	if err == nil && deps != nil {
+		err = compiled.Set("deps", newConversion(p.converters).object(deps, 0))
+	}
+	if err == nil && p.translate != nil {
+		err = compiled.Set("translate", p.translate(runCtx))
+	}
+	p.cfg.MaxRequests = limits.MaxRequests
+	if p.cfg.RandomIdentity {
+		id := extras.RandomIdentity(p.cfg.Impersonate, identitySeed(p.env))
+		p.cfg.Identity = &id
+	}
+	if now, ok := ctx.Value(clockKey{}).(func() time.Time); ok {
+		p.cfg.Now = now
+	}
+	inv := extras.NewInvocation(runCtx, e.Logger, p.cfg)
+	for name, module := range extras.ModuleObjects(inv, p.modules) {
+		if err == nil {
+			err = compiled.Set(name, module)
+		}
+	}
+	if err == nil {
+		err = runLimited(ctx, runCtx, compiled, timeout)
+	}
+	return inv, err
+}
+
+// identitySeed returns the seed of the random identity of a run with env:
+// its "novel", or that of the env of a standard rule, such as content.novel.
+// It is empty, drawing a fresh identity, when there is none.
+func identitySeed(env map[string]any) string {
+	if novel, ok := env["novel"].(string); ok {
+		return novel
+	}
+	for _, key := range slices.Sorted(maps.Keys(env)) {
+		if m, ok := env[key].(map[string]any); ok {
+			if novel, ok := m["novel"].(string); ok {
+				return novel
+			}
+		}
+	}
+	return ""
+}
+
+// preparedRun is a script ready to run together with what the run needs.
+type preparedRun struct {
+	compiled *tengo.Compiled
+	// env is Engine.Env merged with the run's env.
+	env      map[string]any
+	throttle *throttle
+	// modules are the context modules the script holds as globals, built
+	// with cfg.
+	modules []string
+	cfg     extras.Config
+	// converters convert env and deps values for the script.
+	converters []Converter
+	// translate builds the translate global of the run, when there is one.
+	translate func(ctx context.Context) *tengo.UserFunction
+}
+
+// prepareRule returns a runnable script for ruleName, a clone of the cached
+// compilation, or with the cache disabled of the batch's (see
+// RunRuleBatch), when available, together with Engine.Env merged with env and
+// the throttle the run must pass.
+func (e *Engine) prepareRule(ctx context.Context, ruleName string, env map[string]any) (preparedRun, error) {
+	e.ensureMirror()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p := preparedRun{env: make(map[string]any, len(e.Env)+len(env)), throttle: e.throttle, cfg: e.moduleConfig, converters: e.converters}
+	p.translate = e.translateFunction()
+	for k, v := range e.Env {
+		p.env[k] = v
+	}
+	for k, v := range env {
+		p.env[k] = v
+	}
+
 	if e.CacheEnabled {
-		if compiledCache, ok := e.compiledCache[ruleName]; ok {
+		if compiled, ok := e.compiledCache.get(ruleName); ok {
 			e.Logger.Info("Running cached rule", "rule", ruleName)
-			compiledCache.Run()
-			return compiledCache, nil
+			p.compiled, p.modules = compiled.Clone(), e.ruleModules[ruleName]
+			return p, nil
 		}
 	}
+	if !e.CacheEnabled {
+		compiled, ok, err := batchCompiled(ctx, ruleName, func() (*tengo.Compiled, error) {
+			return e.compileRule(ctx, ruleName)
+		})
+		if err != nil {
+			return preparedRun{}, err
+		}
+		if ok {
+			p.compiled, p.modules = compiled, e.ruleModules[ruleName]
+			return p, nil
+		}
+	}
+	compiled, err := e.compileRule(ctx, ruleName)
+	if err != nil {
+		return preparedRun{}, err
+	}
+	p.compiled, p.modules = compiled, e.ruleModules[ruleName]
+	if e.CacheEnabled {
+		e.compiledCache.put(ruleName, compiled)
+		p.compiled = compiled.Clone()
+	}
+	return p, nil
+}
+
+// compileRule builds the preamble for ruleName and compiles it together with
+// the rule code, in spans that are children of ctx. The caller must hold e.mu.
+func (e *Engine) compileRule(ctx context.Context, ruleName string) (*tengo.Compiled, error) {
 	rule, exists := e.Rules[ruleName]
 	if !exists {
 		e.Logger.Error("Rule not found", "rule", ruleName)
-		return nil, fmt.Errorf("rule '%s' not found", ruleName)
+		return nil, withCode(CodeRuleNotFound, fmt.Errorf("rule '%s' not found", ruleName))
 	}
 
-	preamble, allowedModules := buildPreamble(rule, e.Functions, e.Logger, e.denyLibs)
+	start := time.Now()
+	tracer := e.tracer()
+	_, span := e.startSpan(ctx, tracer, "anko.buildPreamble", ruleName)
+	preamble, allowedModules := buildPreamble(rule, e.Functions, e.Logger, e.denyLibs, e.Metadata.Capabilities)
+	span.End()
 	finalCode := preamble + "\n" + rule.Code
+	e.codeOffsets[ruleName] = strings.Count(preamble, "\n") + 1
 	e.Logger.Debug("Compiling rule", "rule", ruleName, "code", finalCode)
 
 	script := tengo.NewScript([]byte(finalCode))
-	script.SetImports(extras.GetCustomModuleMap(allowedModules, e.Logger))
-	script.Add("env", createEnvVariable(e.Env))
-	script.Add("url_encode", addURLEncode())
-	script.Add("to_title_case", addToTitleCase())
-
-	compiled, err := script.Compile()
-	if err != nil {
-		e.Logger.Error("Failed to compile rule", "rule", ruleName)
-		return nil, fmt.Errorf("failed to compile rule '%s': %w", ruleName, err)
+	inv := extras.NewInvocation(context.Background(), e.Logger, e.moduleConfig)
+	script.SetImports(extras.GetCustomModuleMap(inv, allowedModules))
+	e.ruleLimits(ruleName).apply(script)
+	script.Add("env", createEnvVariable(e.Env, e.converters))
+	modules := extras.ModuleObjects(inv, allowedModules)
+	for name, module := range modules {
+		script.Add(name, module)
 	}
-	if e.CacheEnabled {
-		e.compiledCache[ruleName] = compiled
+	e.ruleModules[ruleName] = slices.Sorted(maps.Keys(modules))
+	for name, fn := range e.funcs {
+		script.Add(name, fn)
+	}
+	if len(e.hostFuncs) > 0 {
+		script.Add("host", createHostVariable(e.hostFuncs, e.converters))
+	}
+	if len(rule.Needs) > 0 {
+		script.Add("deps", &tengo.ImmutableMap{})
+	}
+	if len(e.Selectors) > 0 || len(e.selectorOverrides) > 0 {
+		script.Add("selectors", createSelectorsVariable(e.effectiveSelectors()))
+	}
+	script.Add("features", e.createFeaturesVariable())
+	if translate := e.translateFunction(); translate != nil {
+		script.Add("translate", translate(context.Background()))
 	}
 
-	err = compiled.Run()
+	_, span = e.startSpan(ctx, tracer, "anko.Compile", ruleName)
+	compiled, err := script.Compile()
+	endSpan(span, err)
+	for _, h := range e.hooks {
+		if ch, ok := h.(CompileHook); ok {
+			ch.AfterCompile(ruleName, time.Since(start), err)
+		}
+	}
 	if err != nil {
-		e.Logger.Error("Engine error", withPrefixes("rule", ruleName, err)...)
-		return nil, fmt.Errorf("failed to run rule '%s': %w", ruleName, err)
+		e.Logger.Error("Failed to compile rule", "rule", ruleName)
+		return nil, withCode(CodeCompile, fmt.Errorf("failed to compile rule '%s': %w", ruleName, e.mapErrorPositions(ruleName, err)))
 	}
 	return compiled, nil
 }
 
 // RunRuleAndGetResult runs a rule and returns the Tengo variable "result".
 func (e *Engine) RunRuleAndGetResult(ruleName string) (*tengo.Variable, error) {
-	compiled, err := e.RunRule(ruleName)
+	return e.runRuleAndGetResult(ruleName, nil)
+}
+
+func (e *Engine) runRuleAndGetResult(ruleName string, env map[string]any) (*tengo.Variable, error) {
+	return e.runRuleAndGetResultContext(context.Background(), ruleName, env)
+}
+
+func (e *Engine) runRuleAndGetResultContext(ctx context.Context, ruleName string, env map[string]any) (*tengo.Variable, error) {
+	compiled, err := e.runRuleContext(ctx, ruleName, env)
 	if err != nil {
 		return nil, err
 	}
 	resultVar := compiled.Get("result")
 	if resultVar == nil {
 		e.Logger.Error("Rule did not set 'result'", "rule", ruleName)
-		return nil, errors.New("rule did not set the global variable 'result'")
+		return nil, withCode(CodeNoResult, errors.New("rule did not set the global variable 'result'"))
 	}
 	return resultVar, nil
 }
 
+// RunRuleJSON runs a rule with env merged over Engine.Env, as RunRuleWithEnv
+// does, and returns its "result" encoded as JSON. Map keys are sorted, so the
+// encoding of a given result is deterministic.
+func (e *Engine) RunRuleJSON(ruleName string, env map[string]any) (json.RawMessage, error) {
+	resultVar, err := e.runRuleAndGetResult(ruleName, env)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(resultVar.Value())
+	if err != nil {
+		e.Logger.Error("Cannot encode result", "rule", ruleName, "error", err)
+		return nil, fmt.Errorf("cannot encode result of rule '%s': %w", ruleName, err)
+	}
+	return data, nil
+}
+
 // --- Novel Scraping Rule Functions ---
 
-// SearchRule executes a search rule and validates that each result item meets the schema. THIS COMMENT NEED TO BE UPDATED
+// ruleEnvKey returns the env key under which the rule helpers pass the
+// parameters of ruleName: its name, or chapter_list for chapter-list, which
+// is not a valid script identifier.
+func ruleEnvKey(ruleName string) string {
+	if ruleName == "chapter-list" {
+		return "chapter_list"
+	}
+	return ruleName
+}
+
+// SearchRule runs the search rule with envVars as env.search and returns its
+// results, each a map holding at least title and url. A string query in
+// envVars is also passed encoded; see SearchEnv. The rule may also return a
+// Page; its cursor is ignored (see NextPage). Errors carry a hint (see Hint).
 func (e *Engine) SearchRule(envVars map[string]any) ([]map[string]any, error) {
+	page, err := e.searchPage(envVars)
+	return page.Items, err
+}
+
+// searchPage runs the search rule as SearchRule does and returns the page
+// it returned, cursor included.
+func (e *Engine) searchPage(envVars map[string]any) (_ Page, err error) {
 	const ruleName = "search"
-	if e.CacheEnabled {
-		key := serializeEnv(envVars)
-		if prev, ok := e.lastInputs[ruleName]; !ok || prev != key {
-			delete(e.compiledCache, ruleName)
-			e.lastInputs[ruleName] = key
-		}
-	}
-	e.AddEnvVar(ruleName, envVars)
-	resultVar, err := e.RunRuleAndGetResult(ruleName)
+	ctx, signals := withSignals(context.Background())
+	defer func() { err = signals.hint(err) }()
+	resultVar, err := e.runRuleAndGetResultContext(ctx, ruleName, map[string]any{ruleName: SearchEnv(envVars)})
 	if err != nil {
-		return nil, err
+		return Page{}, err
 	}
-	arr := resultVar.Array()
-	required := []string{"title", "url"}
-	for i, item := range arr {
-		m, ok := item.(map[string]any)
-		if !ok {
-			e.Logger.Error("SearchRule", "message", "item is not a map", "item", i)
-			return nil, fmt.Errorf("SearchRule: item %d is not a map", i)
-		}
-		for _, key := range required {
-			if _, exists := m[key]; !exists {
-				e.Logger.Error("SearchRule", "message", "missing required key", "key", key)
-				return nil, fmt.Errorf("SearchRule: item %d missing required key: %s", i, key)
-			}
-		}
-	}
-	out := make([]map[string]any, 0, len(arr))
-	for _, item := range arr {
-		if m, ok := item.(map[string]any); ok {
-			out = append(out, m)
-		} else {
-			e.Logger.Warn("SearchRule", "message", "skipped non-map item", "item", item)
-		}
+	page, err := e.collectPage("SearchRule", resultVar.Value(), []string{"title", "url"})
+	for _, item := range page.Items {
+		e.taxonomy.record(item)
 	}
-	return out, nil
+	return page, err
 }
 
-// NovelInfoRule executes a novel info rule and validates that the result meets the schema. THIS COMMENT NEED TO BE UPDATED
-func (e *Engine) NovelInfoRule(envVars map[string]any) (map[string]any, error) {
+// NovelInfoRule runs the info rule with envVars as env.info and returns the
+// novel it describes, a map holding title, cover, author, description,
+// status and genres, the latter an array. Errors carry a hint (see Hint).
+func (e *Engine) NovelInfoRule(envVars map[string]any) (_ map[string]any, err error) {
 	const ruleName = "info"
-	if e.CacheEnabled {
-		key := serializeEnv(envVars)
-		if prev, ok := e.lastInputs[ruleName]; !ok || prev != key {
-			delete(e.compiledCache, ruleName)
-			e.lastInputs[ruleName] = key
-		}
-	}
-	e.AddEnvVar(ruleName, envVars)
-	resultVar, err := e.RunRuleAndGetResult(ruleName)
+	ctx, signals := withSignals(context.Background())
+	defer func() { err = signals.hint(err) }()
+	resultVar, err := e.runRuleAndGetResultContext(ctx, ruleName, map[string]any{ruleName: envVars})
 	if err != nil {
 		return nil, err
 	}
@@ -218,80 +1188,162 @@ func (e *Engine) NovelInfoRule(envVars map[string]any) (map[string]any, error) {
 	required := []string{"title", "cover", "author", "description", "status", "genres"}
 	for _, key := range required {
 		if val, exists := info[key]; !exists {
-			return nil, fmt.Errorf("NovelInfoRule: missing required key: %s", key)
+			return nil, withCode(CodeValidationMissingKey, fmt.Errorf("NovelInfoRule: missing required key: %s", key))
 		} else if key == "genres" {
 			if _, ok := val.([]any); !ok {
-				return nil, fmt.Errorf("NovelInfoRule: key 'genres' is not an array")
+				return nil, withCode(CodeValidationType, fmt.Errorf("NovelInfoRule: key 'genres' is not an array"))
 			}
 		}
 	}
+	e.canonicalize(info, "url", "cover")
+	e.taxonomy.record(info)
 	return info, nil
 }
 
-// ChapterListRule executes a chapter list rule and validates its output. THIS COMMENT NEED TO BE UPDATED
-func (e *Engine) ChapterListRule(envVars map[string]any) ([]map[string]any, error) {
+// ChapterListRule runs the chapter-list rule with envVars as
+// env.chapter_list and returns the chapters, each a map holding at least
+// title and url, with chapters split into parts merged as set by the
+// chapters section (see ChapterConfig). The rule may also return a Page; its
+// cursor is ignored (see NextPage). Errors carry a hint (see Hint).
+// An empty chapter list is not an error, but is logged as a warning with the
+// hint of its likely cause, usually selectors no longer matching the site.
+func (e *Engine) ChapterListRule(envVars map[string]any) (_ []map[string]any, err error) {
 	const ruleName = "chapter-list"
-	if e.CacheEnabled {
-		key := serializeEnv(envVars)
-		if prev, ok := e.lastInputs[ruleName]; !ok || prev != key {
-			delete(e.compiledCache, ruleName)
-			e.lastInputs[ruleName] = key
-		}
+	ctx, signals := withSignals(context.Background())
+	defer func() { err = signals.hint(err) }()
+	resultVar, err := e.runRuleAndGetResultContext(ctx, ruleName, map[string]any{ruleEnvKey(ruleName): envVars})
+	if err != nil {
+		return nil, err
 	}
-	e.AddEnvVar("chapter_list", envVars)
-	resultVar, err := e.RunRuleAndGetResult(ruleName)
+	page, err := e.collectPage("ChapterListRule", resultVar.Value(), []string{"title", "url"})
 	if err != nil {
 		return nil, err
 	}
-	arr := resultVar.Array()
-	required := []string{"title", "url"}
-	for i, item := range arr {
-		m, ok := item.(map[string]any)
-		if !ok {
-			return nil, fmt.Errorf("ChapterListRule: item %d is not a map", i)
-		}
-		for _, key := range required {
-			if _, exists := m[key]; !exists {
-				return nil, fmt.Errorf("ChapterListRule: item %d missing required key: %s", i, key)
-			}
-		}
+	if len(page.Items) == 0 {
+		e.Logger.Warn("ChapterListRule", "message", "no chapters found", "hint", classifyFailure(CodeNoResult, *signals))
 	}
-	out := make([]map[string]any, 0, len(arr))
-	for _, item := range arr {
-		if m, ok := item.(map[string]any); ok {
-			out = append(out, m)
-		} else {
-			e.Logger.Warn("ChapterListRule: skipped non-map item", "item", item)
-		}
+	e.mu.Lock()
+	re := e.chapterPatterns.merge
+	e.mu.Unlock()
+	return mergeParts(re, page.Items), nil
+}
+
+// ContentRule runs the content rule with envVars as env.content, checks
+// the required keys of its result and shapes the content according to the
+// engine's ContentPolicy. Results are text chapters {title, content} or image
+// chapters {title, images}, such as comics (see NewChapterImages). For a
+// chapter merged from parts (see ChapterConfig), envVars holds the parts,
+// and the rule runs once per part with its URL as url. Before the policy,
+// the content is translated (see WithTranslator) and the glossary of the
+// novel in envVars["novel"] is applied (see SetGlossary). Errors carry a
+// hint (see Hint).
+func (e *Engine) ContentRule(envVars map[string]any) (_ map[string]any, err error) {
+	ctx, signals := withSignals(context.Background())
+	defer func() { err = signals.hint(err) }()
+	var content map[string]any
+	if parts, ok := envVars["parts"].([]any); ok && len(parts) > 0 {
+		content, err = e.contentParts(ctx, envVars, parts)
+	} else {
+		content, err = e.contentOnce(ctx, envVars)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := e.translateContent(ctx, content); err != nil {
+		return nil, err
+	}
+	if err := e.applyGlossary(envVars, content); err != nil {
+		return nil, err
 	}
-	return out, nil
+	if err := e.applyContentPolicy(content); err != nil {
+		return nil, err
+	}
+	return content, nil
 }
 
-// ContentRule executes a content rule and validates that required keys exist. THIS COMMENT NEED TO BE UPDATED
-func (e *Engine) ContentRule(envVars map[string]any) (map[string]any, error) {
+// contentOnce runs the content rule with envVars under ctx and checks its
+// result.
+func (e *Engine) contentOnce(ctx context.Context, envVars map[string]any) (map[string]any, error) {
 	const ruleName = "content"
-	if e.CacheEnabled {
-		key := serializeEnv(envVars)
-		if prev, ok := e.lastInputs[ruleName]; !ok || prev != key {
-			delete(e.compiledCache, ruleName)
-			e.lastInputs[ruleName] = key
-		}
-	}
-	e.AddEnvVar(ruleName, envVars)
-	resultVar, err := e.RunRuleAndGetResult(ruleName)
+	resultVar, err := e.runRuleAndGetResultContext(ctx, ruleName, map[string]any{ruleName: envVars})
 	if err != nil {
 		return nil, err
 	}
 	content := resultVar.Map()
-	required := []string{"title", "content"}
-	for _, key := range required {
-		if _, exists := content[key]; !exists {
-			return nil, fmt.Errorf("ContentRule: missing required key: %s", key)
+	if _, exists := content["title"]; !exists {
+		return nil, withCode(CodeValidationMissingKey, fmt.Errorf("ContentRule: missing required key: title"))
+	}
+	if _, exists := content["images"]; exists {
+		referer, _ := envVars["url"].(string)
+		if err := normalizeImages(content, referer); err != nil {
+			return nil, err
 		}
+	} else if _, exists := content["content"]; !exists {
+		return nil, withCode(CodeValidationMissingKey, fmt.Errorf("ContentRule: missing required key: content"))
 	}
 	return content, nil
 }
 
+// canonicalize rewrites the given URL keys of m in canonical form when URL
+// canonicalization is enabled. Values that fail to parse are left untouched.
+func (e *Engine) canonicalize(m map[string]any, keys ...string) {
+	if !e.canonicalURLs {
+		return
+	}
+	for _, key := range keys {
+		raw, ok := m[key].(string)
+		if !ok {
+			continue
+		}
+		canonical, err := extras.CanonicalURL(raw)
+		if err != nil {
+			e.Logger.Warn("Cannot canonicalize URL", "url", raw, "error", err)
+			continue
+		}
+		m[key] = canonical
+	}
+}
+
+// DescribeRule returns the documentation declared for ruleName in the YAML.
+func (e *Engine) DescribeRule(ruleName string) (RuleDoc, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rule, exists := e.Rules[ruleName]
+	if !exists {
+		return RuleDoc{}, withCode(CodeRuleNotFound, fmt.Errorf("rule '%s' not found", ruleName))
+	}
+	return RuleDoc{
+		Name:        ruleName,
+		Description: rule.Description,
+		Params:      slices.Clone(rule.Params),
+		Returns:     rule.Returns,
+		Imports:     slices.Clone(rule.Imports),
+		Needs:       slices.Clone(rule.Needs),
+	}, nil
+}
+
+// RuleNames returns the names of the loaded rules in sorted order.
+func (e *Engine) RuleNames() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	names := make([]string, 0, len(e.Rules))
+	for name := range e.Rules {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Deprecation reports whether the loaded source is deprecated and why.
+func (e *Engine) Deprecation() (Deprecation, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.Metadata.Deprecated == nil {
+		return Deprecation{}, false
+	}
+	return *e.Metadata.Deprecated, true
+}
+
 // GetMetadata returns the metadata loaded from the YAML.
 func (e *Engine) GetMetadata() Metadata {
 	return e.Metadata
@@ -300,6 +1352,12 @@ func (e *Engine) GetMetadata() Metadata {
 // AddEnvVar adds or updates a key-value pair in the Engine's Env map.
 // It initializes the Env map if it is nil.
 func (e *Engine) AddEnvVar(key string, value any) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.addEnvVar(key, value)
+}
+
+func (e *Engine) addEnvVar(key string, value any) {
 	if e.Env == nil {
 		e.Env = make(map[string]any)
 	}
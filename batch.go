@@ -0,0 +1,74 @@
+package anko
+
+import (
+	"context"
+	"sync"
+
+	"github.com/d5/tengo/v2"
+)
+
+// BatchResult is the outcome of one run of RunRuleBatch: the rule's result,
+// or the error of the run.
+type BatchResult struct {
+	Result any
+	Err    error
+}
+
+// batchKey is the context key of the compilations shared by the runs of a
+// batch.
+type batchKey struct{}
+
+// batchScripts holds the scripts compiled for a batch, so its runs clone
+// them even when the cache is disabled.
+type batchScripts struct {
+	mu       sync.Mutex
+	compiled map[string]*tengo.Compiled
+}
+
+// RunRuleBatch runs ruleName once per env of envs, each merged over
+// Engine.Env as in RunRuleWithEnv, and returns the results in the order of
+// envs, e.g. to resolve hundreds of short URLs with a rule. The rule is
+// compiled once and every run gets a clone. At most concurrency runs are in
+// flight, clamped by Parallelism, and failed runs do not stop the others.
+func (e *Engine) RunRuleBatch(ruleName string, envs []map[string]any, concurrency int) []BatchResult {
+	ctx := context.WithValue(context.Background(), batchKey{}, &batchScripts{compiled: make(map[string]*tengo.Compiled)})
+	out := make([]BatchResult, len(envs))
+	sem := make(chan struct{}, e.Parallelism(concurrency))
+	var wg sync.WaitGroup
+	for i, env := range envs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			resultVar, err := e.runRuleAndGetResultContext(ctx, ruleName, env)
+			if err != nil {
+				out[i].Err = err
+				return
+			}
+			out[i].Result = resultVar.Value()
+		}()
+	}
+	wg.Wait()
+	return out
+}
+
+// batchCompiled returns a clone of the compilation of ruleName shared by the
+// batch of ctx, compiling it with compile on first use. ok is false outside
+// of batches.
+func batchCompiled(ctx context.Context, ruleName string, compile func() (*tengo.Compiled, error)) (compiled *tengo.Compiled, ok bool, err error) {
+	b, ok := ctx.Value(batchKey{}).(*batchScripts)
+	if !ok {
+		return nil, false, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, found := b.compiled[ruleName]
+	if !found {
+		if c, err = compile(); err != nil {
+			return nil, true, err
+		}
+		b.compiled[ruleName] = c
+	}
+	return c.Clone(), true, nil
+}
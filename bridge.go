@@ -0,0 +1,215 @@
+package anko
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Bridge exposes the sources of a SourceManager through a JSON contract
+// modelled on reader extension formats (Tachiyomi, Aidoku), so reader apps
+// can drive anko sources as if they were native extensions.
+//
+// A request is a JSON object:
+//
+//	{"id": "1", "method": "search", "source": "<identifier>", "params": {"query": "foo"}}
+//
+// and the reply echoes the id:
+//
+//	{"id": "1", "ok": true, "data": ...}
+//	{"id": "1", "ok": false, "error": "...", "code": "ANKO_RULE_NOT_FOUND"}
+//
+// code is the stable ErrorCode of the failure (see Code), for localizing the
+// error on the frontend.
+//
+// Methods and the shape of data:
+//
+//	sources   -> [{"id", "name", "version", "lang", "baseUrl", "capabilities", "deprecated"}] (source ignored)
+//	search    -> {"novels": [{"title", "url", "cover"}], "hasNextPage", "cursor"}
+//	details   -> {"title", "url", "cover", "author", "description", "status", "genres"}
+//	chapters  -> [{"name", "url", "number"}]
+//	content   -> {"title", "content"} or, for image chapters, {"title", "images": [{"url", "referer"}]}
+//
+// capabilities is only present for sources declaring them. deprecated is only
+// present for deprecated sources and holds the reason and the replacement
+// source id. search takes params.query and, for the pages after the first,
+// the cursor returned with the previous page as params.cursor; cursor is only
+// present when hasNextPage is true (see Page). details, chapters and content
+// take params.url.
+type Bridge struct {
+	Manager *SourceManager
+}
+
+// BridgeRequest is a single call in the bridge contract.
+type BridgeRequest struct {
+	ID     string         `json:"id"`
+	Method string         `json:"method"`
+	Source string         `json:"source"`
+	Params map[string]any `json:"params"`
+}
+
+// BridgeResponse is the reply to a BridgeRequest.
+type BridgeResponse struct {
+	ID    string `json:"id"`
+	OK    bool   `json:"ok"`
+	Data  any    `json:"data,omitempty"`
+	Error string `json:"error,omitempty"`
+	Code  string `json:"code,omitempty"`
+	// Hint is the ErrorHint of a failed call, if any.
+	Hint string `json:"hint,omitempty"`
+}
+
+// NewBridge creates a Bridge over the given SourceManager.
+func NewBridge(m *SourceManager) *Bridge {
+	return &Bridge{Manager: m}
+}
+
+// Handle decodes a JSON request, dispatches it and returns the JSON reply.
+func (b *Bridge) Handle(data []byte) []byte {
+	var req BridgeRequest
+	var resp BridgeResponse
+	if err := json.Unmarshal(data, &req); err != nil {
+		resp = BridgeResponse{Error: fmt.Sprintf("invalid request: %v", err), Code: string(CodeBridgeRequest)}
+	} else {
+		resp = b.Do(req)
+	}
+	out, err := json.Marshal(resp)
+	if err != nil {
+		out, _ = json.Marshal(BridgeResponse{ID: req.ID, Error: fmt.Sprintf("cannot encode reply: %v", err)})
+	}
+	return out
+}
+
+// Serve reads newline-delimited requests from r and writes one reply line per
+// request to w until r is exhausted.
+func (b *Bridge) Serve(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if _, err := w.Write(append(b.Handle(scanner.Bytes()), '\n')); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Do dispatches a decoded request.
+func (b *Bridge) Do(req BridgeRequest) BridgeResponse {
+	data, err := b.dispatch(req)
+	if err != nil {
+		return BridgeResponse{ID: req.ID, Error: err.Error(), Code: string(Code(err)), Hint: string(Hint(err))}
+	}
+	return BridgeResponse{ID: req.ID, OK: true, Data: data}
+}
+
+func (b *Bridge) dispatch(req BridgeRequest) (any, error) {
+	if req.Method == "sources" {
+		sources := b.Manager.List()
+		out := make([]map[string]any, len(sources))
+		for i, md := range sources {
+			baseURL := ""
+			if len(md.Sources) > 0 {
+				baseURL = md.Sources[0]
+			}
+			out[i] = map[string]any{
+				"id":      md.Identifier,
+				"name":    md.Name,
+				"version": md.Version,
+				"lang":    md.Language,
+				"baseUrl": baseURL,
+			}
+			if md.Capabilities != nil {
+				out[i]["capabilities"] = md.Capabilities
+			}
+			if d := md.Deprecated; d != nil {
+				out[i]["deprecated"] = map[string]any{
+					"reason":      d.Reason,
+					"replacement": d.ReplacementIdentifier,
+				}
+			}
+		}
+		return out, nil
+	}
+
+	e, ok := b.Manager.Get(req.Source)
+	if !ok {
+		return nil, withCode(CodeSourceNotFound, fmt.Errorf("unknown source '%s'", req.Source))
+	}
+	switch req.Method {
+	case "search":
+		page, err := e.searchPage(req.Params)
+		if err != nil {
+			return nil, err
+		}
+		novels := make([]map[string]any, len(page.Items))
+		for i, r := range page.Items {
+			novels[i] = map[string]any{
+				"title": stringValue(r["title"]),
+				"url":   stringValue(r["url"]),
+				"cover": stringValue(r["cover"]),
+			}
+		}
+		data := map[string]any{"novels": novels, "hasNextPage": !page.Done()}
+		if !page.Done() {
+			data["cursor"] = page.Cursor
+		}
+		return data, nil
+	case "details":
+		info, err := e.NovelInfoRule(req.Params)
+		if err != nil {
+			return nil, err
+		}
+		n := NewNovelInfo(info)
+		if n.URL == "" {
+			n.URL = stringValue(req.Params["url"])
+		}
+		return map[string]any{
+			"title":       n.Title,
+			"url":         n.URL,
+			"cover":       n.Cover,
+			"author":      n.Author,
+			"description": n.Description,
+			"status":      n.Status,
+			"genres":      n.Genres,
+		}, nil
+	case "chapters":
+		items, err := e.ChapterListRule(req.Params)
+		if err != nil {
+			return nil, err
+		}
+		chapters := make([]map[string]any, len(items))
+		for i, c := range NewChapters(items) {
+			chapters[i] = map[string]any{
+				"name":   c.Title,
+				"url":    c.URL,
+				"number": i + 1,
+			}
+		}
+		return chapters, nil
+	case "content":
+		content, err := e.ContentRule(req.Params)
+		if err != nil {
+			return nil, err
+		}
+		if images := NewChapterImages(content); images != nil {
+			out := make([]map[string]any, len(images))
+			for i, img := range images {
+				out[i] = map[string]any{"url": img.URL, "referer": img.Referer}
+			}
+			return map[string]any{
+				"title":  stringValue(content["title"]),
+				"images": out,
+			}, nil
+		}
+		return map[string]any{
+			"title":   stringValue(content["title"]),
+			"content": stringValue(content["content"]),
+		}, nil
+	default:
+		return nil, withCode(CodeBridgeMethod, fmt.Errorf("unknown method '%s'", req.Method))
+	}
+}
@@ -0,0 +1,127 @@
+package anko
+
+import (
+	"container/list"
+	"time"
+
+	"github.com/d5/tengo/v2"
+)
+
+// CacheStats reports the activity of the compiled rule cache.
+type CacheStats struct {
+	Hits      int
+	Misses    int
+	Evictions int
+	Size      int
+}
+
+// ruleCache is a least recently used cache of compiled rules, bounded by
+// size (0 means unbounded) and, when ttl is set, by entry age. It is guarded
+// by Engine.mu.
+type ruleCache struct {
+	size  int
+	ttl   time.Duration
+	order *list.List
+	items map[string]*list.Element
+	stats CacheStats
+}
+
+type cacheEntry struct {
+	name     string
+	compiled *tengo.Compiled
+	added    time.Time
+	used     time.Time
+}
+
+func newRuleCache() *ruleCache {
+	return &ruleCache{order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *ruleCache) get(name string) (*tengo.Compiled, bool) {
+	el, ok := c.items[name]
+	if ok && c.ttl > 0 && time.Since(el.Value.(*cacheEntry).added) > c.ttl {
+		c.remove(el)
+		c.stats.Evictions++
+		ok = false
+	}
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	el.Value.(*cacheEntry).used = time.Now()
+	c.order.MoveToFront(el)
+	return el.Value.(*cacheEntry).compiled, true
+}
+
+func (c *ruleCache) put(name string, compiled *tengo.Compiled) {
+	if el, ok := c.items[name]; ok {
+		c.remove(el)
+	}
+	now := time.Now()
+	c.items[name] = c.order.PushFront(&cacheEntry{name: name, compiled: compiled, added: now, used: now})
+	c.trim()
+}
+
+// trim evicts the least recently used entries beyond the size limit.
+func (c *ruleCache) trim() {
+	for c.size > 0 && c.order.Len() > c.size {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+// reap evicts the expired entries and, when idle is positive, those not used
+// for idle, and returns their number.
+func (c *ruleCache) reap(idle time.Duration) int {
+	n := 0
+	for el := c.order.Back(); el != nil; {
+		prev := el.Prev()
+		entry := el.Value.(*cacheEntry)
+		if c.ttl > 0 && time.Since(entry.added) > c.ttl || idle > 0 && time.Since(entry.used) > idle {
+			c.remove(el)
+			c.stats.Evictions++
+			n++
+		}
+		el = prev
+	}
+	return n
+}
+
+func (c *ruleCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*cacheEntry).name)
+}
+
+// clear drops every entry, keeping the limits and statistics.
+func (c *ruleCache) clear() {
+	c.order.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+// SetCacheSize bounds the compiled rule cache to n rules, evicting the least
+// recently used ones first. n <= 0 removes the bound.
+func (e *Engine) SetCacheSize(n int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.compiledCache.size = max(n, 0)
+	e.compiledCache.trim()
+}
+
+// SetCacheTTL makes cached compilations expire d after they were stored.
+// d <= 0 disables expiry.
+func (e *Engine) SetCacheTTL(d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.compiledCache.ttl = max(d, 0)
+}
+
+// CacheStats returns the hit, miss and eviction counts of the compiled rule
+// cache and its current size.
+func (e *Engine) CacheStats() CacheStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	stats := e.compiledCache.stats
+	stats.Size = e.compiledCache.order.Len()
+	return stats
+}
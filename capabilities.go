@@ -0,0 +1,41 @@
+package anko
+
+import "slices"
+
+// Capabilities maps the capability names a source may declare in its anko
+// metadata to the modules they grant. Modules not listed here, such as the
+// pure stdlib modules and log, need no capability. A source without a
+// capabilities list is granted every capability.
+//
+// system grants Tengo's os module, which reads and writes arbitrary files,
+// reads the environment and runs processes: a source declaring it has the
+// privileges of the host process.
+var Capabilities = map[string][]string{
+	"network": {"req", "cookies"},
+	"html":    {"html"},
+	"crypto":  {"crypto"},
+	"formats": {"proto", "pdf", "archive"},
+	"system":  {"os"},
+	"browser": {"browser"},
+}
+
+// requiredCapability returns the capability granting module, if any.
+func requiredCapability(module string) (string, bool) {
+	for name, modules := range Capabilities {
+		if slices.Contains(modules, module) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// capabilityAllowed reports whether module may be imported by a source
+// declaring caps, and the capability it requires. A nil caps, i.e. a source
+// without a capabilities list, allows every module.
+func capabilityAllowed(module string, caps []string) (string, bool) {
+	capability, gated := requiredCapability(module)
+	if !gated || caps == nil {
+		return capability, true
+	}
+	return capability, slices.Contains(caps, capability)
+}
@@ -0,0 +1,73 @@
+package anko
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ChangelogEntry is one release in the changelog section of the YAML:
+//
+//	changelog:
+//	  - version: 1.2.0
+//	    date: 2024-05-01
+//	    changes:
+//	      - Search follows the new site layout
+type ChangelogEntry struct {
+	Version string   `yaml:"version"`
+	Date    string   `yaml:"date"`
+	Changes []string `yaml:"changes"`
+}
+
+// ChangesSince returns the changelog entries of e newer than version, newest
+// first. Update checkers pass the installed source's Metadata.Version to the
+// engine loaded from the remote copy to show what an update brings.
+func (e *Engine) ChangesSince(version string) []ChangelogEntry {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var out []ChangelogEntry
+	for _, entry := range e.Changelog {
+		if compareVersions(entry.Version, version) > 0 {
+			out = append(out, entry)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return compareVersions(out[i].Version, out[j].Version) > 0
+	})
+	return out
+}
+
+// DiffChangelog returns the entries of the remote source that are newer than
+// the installed one, newest first.
+func DiffChangelog(installed, remote *Engine) []ChangelogEntry {
+	return remote.ChangesSince(installed.GetMetadata().Version)
+}
+
+// compareVersions compares dotted version strings segment by segment,
+// numerically where both segments are numbers. A leading "v" is ignored and
+// missing segments count as 0.
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := range max(len(as), len(bs)) {
+		x, y := "0", "0"
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xn, errX := strconv.Atoi(x)
+		yn, errY := strconv.Atoi(y)
+		switch {
+		case errX == nil && errY == nil && xn != yn:
+			if xn < yn {
+				return -1
+			}
+			return 1
+		case (errX != nil || errY != nil) && x != y:
+			return strings.Compare(x, y)
+		}
+	}
+	return 0
+}
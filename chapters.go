@@ -0,0 +1,191 @@
+package anko
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ancientcatz/anko/extras"
+)
+
+// ChapterConfig is the chapters section of the YAML, for sites whose pages
+// do not map one to one to chapters:
+//
+//	chapters:
+//	  split_heading: '^Chapter \d+'
+//	  merge_parts: '\((\d+)/\d+\)$'
+//
+// SplitHeading matches the headings at which SplitContent splits a page
+// holding several chapters (see extras.SplitHTML). MergeParts matches the
+// part marker of chapters published in several pages, such as
+// "Chapter 10 (1/3)"; its first group, if any, is the part number.
+// ChapterListRule merges consecutive chapters whose titles are equal
+// without the marker into one, listing the URLs of its parts in order as
+// parts, and ContentRule joins the content of the parts of such a chapter.
+type ChapterConfig struct {
+	SplitHeading string `yaml:"split_heading"`
+	MergeParts   string `yaml:"merge_parts"`
+}
+
+// chapterPatterns are the compiled expressions of a ChapterConfig.
+type chapterPatterns struct {
+	split, merge *regexp.Regexp
+}
+
+// compile compiles the expressions of c.
+func (c ChapterConfig) compile() (chapterPatterns, error) {
+	var p chapterPatterns
+	var err error
+	if c.SplitHeading != "" {
+		if p.split, err = regexp.Compile(c.SplitHeading); err != nil {
+			return p, withCode(CodeConfigInvalid, fmt.Errorf("invalid chapters.split_heading: %w", err))
+		}
+	}
+	if c.MergeParts != "" {
+		if p.merge, err = regexp.Compile(c.MergeParts); err != nil {
+			return p, withCode(CodeConfigInvalid, fmt.Errorf("invalid chapters.merge_parts: %w", err))
+		}
+	}
+	return p, nil
+}
+
+// chapterPart splits title into the title without the part marker and the
+// part number, which is zero when the marker has no number.
+func chapterPart(re *regexp.Regexp, title string) (base string, part int, ok bool) {
+	m := re.FindStringSubmatchIndex(title)
+	if m == nil {
+		return "", 0, false
+	}
+	if len(m) >= 4 && m[2] >= 0 {
+		part, _ = strconv.Atoi(title[m[2]:m[3]])
+	}
+	return strings.TrimSpace(title[:m[0]] + title[m[1]:]), part, true
+}
+
+// mergeParts merges the runs of consecutive chapters that are parts of the
+// same chapter according to re.
+func mergeParts(re *regexp.Regexp, chapters []map[string]any) []map[string]any {
+	if re == nil {
+		return chapters
+	}
+	type part struct {
+		chapter map[string]any
+		number  int
+	}
+	var out []map[string]any
+	var run []part
+	var runBase string
+	flush := func() {
+		if len(run) == 1 {
+			out = append(out, run[0].chapter)
+		} else if len(run) > 1 {
+			slices.SortStableFunc(run, func(a, b part) int { return cmp.Compare(a.number, b.number) })
+			merged := maps.Clone(run[0].chapter)
+			merged["title"] = runBase
+			urls := make([]any, len(run))
+			for i, p := range run {
+				urls[i] = p.chapter["url"]
+			}
+			merged["url"] = urls[0]
+			merged["parts"] = urls
+			out = append(out, merged)
+		}
+		run = nil
+	}
+	for _, ch := range chapters {
+		title, _ := ch["title"].(string)
+		base, number, ok := chapterPart(re, title)
+		if !ok {
+			flush()
+			out = append(out, ch)
+			continue
+		}
+		if len(run) > 0 && base != runBase {
+			flush()
+		}
+		runBase = base
+		run = append(run, part{ch, number})
+	}
+	flush()
+	return out
+}
+
+// SplitContent splits the content of a ContentRule result at the headings
+// matched by the source's chapters.split_heading and returns one result per
+// chapter, each with the heading as title. Results without string content
+// or matching headings, and all results of sources without split_heading,
+// are returned whole.
+func (e *Engine) SplitContent(content map[string]any) ([]map[string]any, error) {
+	e.mu.Lock()
+	re := e.chapterPatterns.split
+	e.mu.Unlock()
+	src, ok := content["content"].(string)
+	if re == nil || !ok {
+		return []map[string]any{content}, nil
+	}
+	sections, err := extras.SplitHTML(src, re)
+	if err != nil {
+		return nil, fmt.Errorf("SplitContent: %w", err)
+	}
+	if len(sections) == 1 {
+		return []map[string]any{content}, nil
+	}
+	out := make([]map[string]any, len(sections))
+	for i, s := range sections {
+		ch := maps.Clone(content)
+		if s.Title != "" {
+			ch["title"] = s.Title
+		}
+		ch["content"] = s.HTML
+		out[i] = ch
+	}
+	return out, nil
+}
+
+// contentParts runs the content rule for every part of a chapter merged by
+// ChapterListRule and joins their content or images. The title is the chapter's, or
+// that of the first part without its marker. The parts run under ctx.
+func (e *Engine) contentParts(ctx context.Context, envVars map[string]any, parts []any) (map[string]any, error) {
+	e.mu.Lock()
+	re := e.chapterPatterns.merge
+	e.mu.Unlock()
+	var merged map[string]any
+	var content []string
+	var images []any
+	for _, url := range parts {
+		env := maps.Clone(envVars)
+		delete(env, "parts")
+		env["url"] = url
+		part, err := e.contentOnce(ctx, env)
+		if err != nil {
+			return nil, err
+		}
+		if merged == nil {
+			merged = part
+		}
+		if s, ok := part["content"].(string); ok {
+			content = append(content, s)
+		}
+		if imgs, ok := part["images"].([]any); ok {
+			images = append(images, imgs...)
+		}
+	}
+	if images != nil {
+		merged["images"] = images
+	} else {
+		merged["content"] = strings.Join(content, "\n")
+	}
+	if title, ok := envVars["title"].(string); ok {
+		merged["title"] = title
+	} else if title, ok := merged["title"].(string); ok && re != nil {
+		if base, _, ok := chapterPart(re, title); ok {
+			merged["title"] = base
+		}
+	}
+	return merged, nil
+}
@@ -0,0 +1,29 @@
+package anko
+
+import (
+	"context"
+	"time"
+)
+
+// SetClock makes now the clock of anko.now and times.now in every rule, e.g.
+// a fixed time so rules computing relative dates or date-based URLs run
+// deterministically. A nil now restores the system clock.
+func (e *Engine) SetClock(now func() time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.moduleConfig.Now = now
+}
+
+// clockKey is the context key of a run's clock, which takes precedence over
+// the engine clock.
+type clockKey struct{}
+
+// withClock returns ctx with now as the clock of the runs it starts.
+func withClock(ctx context.Context, now func() time.Time) context.Context {
+	return context.WithValue(ctx, clockKey{}, now)
+}
+
+// fixedClock returns a clock always reading t.
+func fixedClock(t time.Time) func() time.Time {
+	return func() time.Time { return t }
+}
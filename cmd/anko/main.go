@@ -0,0 +1,399 @@
+// Command anko runs, validates and inspects anko source definitions from the
+// command line, so a YAML source can be tried out without writing a Go
+// program around the engine.
+//
+// Usage:
+//
+//	anko run <source.yaml> <rule> [--env key=value]...
+//	anko validate <source.yaml>
+//	anko inspect <source.yaml>
+//	anko test <source.yaml>
+//	anko repl <source.yaml>
+//
+// Results are printed to stdout as JSON; logs go to stderr. repl starts an
+// interactive Tengo prompt in the scope of the source's rules.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/ancientcatz/anko"
+	"github.com/ancientcatz/anko/extras"
+	"github.com/ancientcatz/anko/repl"
+	"github.com/charmbracelet/log"
+)
+
+const usage = `usage:
+  anko run <source.yaml> <rule> [--env key=value]...
+  anko validate <source.yaml>
+  anko inspect <source.yaml>
+  anko test <source.yaml>
+  anko repl <source.yaml>
+
+Flags accepted by every command:
+  --log-level level   debug, info, warn or error (default warn)
+  --cassettes dir     record HTTP responses in dir and replay them
+  --record mode       auto, replay or record (default auto)
+`
+
+// errUsage is returned for invalid command lines.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	err := run(os.Args[1:], os.Stdout, os.Stderr)
+	switch {
+	case errors.Is(err, errUsage):
+		if err != errUsage {
+			fmt.Fprintln(os.Stderr, "anko:", err)
+		}
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "anko:", err)
+		os.Exit(1)
+	}
+}
+
+// run dispatches the command in args.
+func run(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "run":
+		return runCmd(args[1:], stdout, stderr)
+	case "validate":
+		return validateCmd(args[1:], stdout, stderr)
+	case "inspect":
+		return inspectCmd(args[1:], stdout, stderr)
+	case "test":
+		return testCmd(args[1:], stdout, stderr)
+	case "repl":
+		return replCmd(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown command '%s'", errUsage, args[0])
+	}
+}
+
+// envFlag collects repeated --env key=value flags.
+type envFlag map[string]any
+
+func (f envFlag) String() string { return "" }
+
+// Set stores a key=value pair. Values that are valid JSON, such as numbers
+// and booleans, are decoded; anything else is kept as a string.
+func (f envFlag) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got '%s'", s)
+	}
+	var v any
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		v = value
+	}
+	f[key] = v
+	return nil
+}
+
+// novelEnvKeys are the env keys the novel rules read their parameters from,
+// as set by Engine.SearchRule and its siblings.
+var novelEnvKeys = map[string]string{
+	"search":       "search",
+	"info":         "info",
+	"chapter-list": "chapter_list",
+	"content":      "content",
+}
+
+func runCmd(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("run", stderr)
+	env := envFlag{}
+	fs.Var(env, "env", "set an env `key=value` for the rule; may be repeated")
+	pos, logger, err := parseArgs(fs, args, stderr)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 2 {
+		return errUsage
+	}
+	e, err := load(fs, pos[0], logger)
+	if err != nil {
+		return err
+	}
+	rule := pos[1]
+	var runEnv map[string]any = env
+	if rule == "search" {
+		runEnv = anko.SearchEnv(env)
+	}
+	if key, ok := novelEnvKeys[rule]; ok {
+		runEnv = map[string]any{key: runEnv}
+	}
+	result, err := e.RunRuleJSON(rule, runEnv)
+	if err != nil {
+		return err
+	}
+	return writeJSON(stdout, result)
+}
+
+// validateReport is the output of the validate command.
+type validateReport struct {
+	Valid  bool        `json:"valid"`
+	Errors []ruleError `json:"errors"`
+}
+
+type ruleError struct {
+	Rule    string `json:"rule"`
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func validateCmd(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("validate", stderr)
+	pos, logger, err := parseArgs(fs, args, stderr)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return errUsage
+	}
+	e, err := load(fs, pos[0], logger)
+	if err != nil {
+		return err
+	}
+	report := validateReport{Errors: []ruleError{}}
+	for _, re := range e.Validate() {
+		report.Errors = append(report.Errors, ruleError(re))
+	}
+	report.Valid = len(report.Errors) == 0
+	if err := writeJSON(stdout, report); err != nil {
+		return err
+	}
+	if !report.Valid {
+		return fmt.Errorf("%d rule errors", len(report.Errors))
+	}
+	return nil
+}
+
+// inspectReport is the output of the inspect command.
+type inspectReport struct {
+	Metadata metadata  `json:"metadata"`
+	Rules    []ruleDoc `json:"rules"`
+}
+
+type metadata struct {
+	Name         string   `json:"name"`
+	Version      string   `json:"version"`
+	Author       string   `json:"author,omitempty"`
+	Language     string   `json:"language,omitempty"`
+	Identifier   string   `json:"identifier"`
+	Sources      []string `json:"sources,omitempty"`
+	Capabilities []string `json:"capabilities,omitempty"`
+	Deprecated   string   `json:"deprecated,omitempty"`
+}
+
+type ruleDoc struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Imports     []string         `json:"imports,omitempty"`
+	Needs       []string         `json:"needs,omitempty"`
+	Params      []anko.RuleParam `json:"params,omitempty"`
+	Returns     string           `json:"returns,omitempty"`
+}
+
+func inspectCmd(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("inspect", stderr)
+	pos, logger, err := parseArgs(fs, args, stderr)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return errUsage
+	}
+	e, err := load(fs, pos[0], logger)
+	if err != nil {
+		return err
+	}
+	md := e.GetMetadata()
+	report := inspectReport{
+		Metadata: metadata{
+			Name:         md.Name,
+			Version:      md.Version,
+			Author:       md.Author,
+			Language:     md.Language,
+			Identifier:   md.Identifier,
+			Sources:      md.Sources,
+			Capabilities: md.Capabilities,
+		},
+		Rules: []ruleDoc{},
+	}
+	if d, ok := e.Deprecation(); ok {
+		report.Metadata.Deprecated = d.Reason
+	}
+	for _, name := range e.RuleNames() {
+		doc, err := e.DescribeRule(name)
+		if err != nil {
+			return err
+		}
+		report.Rules = append(report.Rules, ruleDoc{
+			Name:        doc.Name,
+			Description: doc.Description,
+			Imports:     doc.Imports,
+			Needs:       doc.Needs,
+			Params:      doc.Params,
+			Returns:     doc.Returns,
+		})
+	}
+	return writeJSON(stdout, report)
+}
+
+// testReport is the output of the test command.
+type testReport struct {
+	Passed bool         `json:"passed"`
+	Tests  []testResult `json:"tests"`
+}
+
+type testResult struct {
+	Rule       string   `json:"rule"`
+	Name       string   `json:"name"`
+	Passed     bool     `json:"passed"`
+	Failures   []string `json:"failures,omitempty"`
+	DurationMS int64    `json:"duration_ms"`
+}
+
+func testCmd(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("test", stderr)
+	pos, logger, err := parseArgs(fs, args, stderr)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return errUsage
+	}
+	e, err := load(fs, pos[0], logger)
+	if err != nil {
+		return err
+	}
+	report := testReport{Passed: true, Tests: []testResult{}}
+	failed := 0
+	for _, r := range e.RunTests() {
+		report.Tests = append(report.Tests, testResult{
+			Rule:       r.Rule,
+			Name:       r.Name,
+			Passed:     r.Passed(),
+			Failures:   r.Failures,
+			DurationMS: r.Duration.Milliseconds(),
+		})
+		if !r.Passed() {
+			failed++
+		}
+	}
+	report.Passed = failed == 0
+	if err := writeJSON(stdout, report); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tests failed", failed, len(report.Tests))
+	}
+	return nil
+}
+
+func replCmd(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("repl", stderr)
+	pos, logger, err := parseArgs(fs, args, stderr)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return errUsage
+	}
+	e, err := load(fs, pos[0], logger)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := repl.Run(ctx, e, os.Stdin, stdout); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.String("log-level", "warn", "log `level`: debug, info, warn or error")
+	fs.String("cassettes", "", "record and replay HTTP responses in `dir`")
+	fs.String("record", "auto", "recording `mode` with --cassettes: auto, replay or record")
+	return fs
+}
+
+// parseArgs parses args with fs, allowing flags before, between and after
+// the positional arguments, which it returns together with a logger writing
+// to stderr at the requested level.
+func parseArgs(fs *flag.FlagSet, args []string, stderr io.Writer) ([]string, *slog.Logger, error) {
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, nil, errUsage
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		pos = append(pos, args[0])
+		args = args[1:]
+	}
+	level, err := log.ParseLevel(fs.Lookup("log-level").Value.String())
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", errUsage, err)
+	}
+	handler := log.NewWithOptions(stderr, log.Options{Level: level, ReportTimestamp: true})
+	return pos, slog.New(handler), nil
+}
+
+// recordModes maps the values of the --record flag to recorder modes.
+var recordModes = map[string]extras.RecordMode{
+	"auto":   extras.RecordAuto,
+	"replay": extras.RecordReplay,
+	"record": extras.RecordRecord,
+}
+
+// load creates an engine for the source definition in filename, recording
+// HTTP responses as requested by the flags in fs.
+func load(fs *flag.FlagSet, filename string, logger *slog.Logger) (*anko.Engine, error) {
+	e := anko.NewEngine(logger)
+	if err := e.LoadFile(filename); err != nil {
+		return nil, err
+	}
+	if dir := fs.Lookup("cassettes").Value.String(); dir != "" {
+		mode, ok := recordModes[fs.Lookup("record").Value.String()]
+		if !ok {
+			return nil, fmt.Errorf("%w: --record must be auto, replay or record", errUsage)
+		}
+		e.SetHTTPRecorder(dir, mode)
+	}
+	return e, nil
+}
+
+// writeJSON writes v to w as indented JSON.
+func writeJSON(w io.Writer, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
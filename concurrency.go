@@ -0,0 +1,94 @@
+package anko
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Concurrency is a source-declared limit on parallel work against its site.
+// The engine enforces it regardless of how much parallelism the host asks for.
+type Concurrency struct {
+	MaxParallel int `yaml:"max_parallel"`
+	DelayMs     int `yaml:"delay_ms"`
+}
+
+// throttle bounds the number of concurrent runs and spaces their starts.
+// A nil *throttle imposes no limit.
+type throttle struct {
+	slots chan struct{}
+	delay time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// newThrottle returns a throttle for c, or nil when c declares no limit.
+func newThrottle(c Concurrency) *throttle {
+	if c.MaxParallel <= 0 && c.DelayMs <= 0 {
+		return nil
+	}
+	t := &throttle{delay: time.Duration(c.DelayMs) * time.Millisecond}
+	if c.MaxParallel > 0 {
+		t.slots = make(chan struct{}, c.MaxParallel)
+	}
+	return t
+}
+
+// acquire blocks until a slot is free and the configured delay has passed
+// since the previous start, or until ctx is done, returning ctx.Err()
+// without holding a slot then.
+func (t *throttle) acquire(ctx context.Context) error {
+	if t == nil {
+		return ctx.Err()
+	}
+	if t.slots != nil {
+		select {
+		case t.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if t.delay <= 0 {
+		return nil
+	}
+	t.mu.Lock()
+	start := time.Now()
+	if t.next.After(start) {
+		start = t.next
+	}
+	t.next = start.Add(t.delay)
+	t.mu.Unlock()
+	timer := time.NewTimer(time.Until(start))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		t.release()
+		return ctx.Err()
+	}
+}
+
+// release frees the slot taken by acquire.
+func (t *throttle) release() {
+	if t == nil || t.slots == nil {
+		return
+	}
+	<-t.slots
+}
+
+// Parallelism clamps a requested degree of parallelism to the source's
+// max_parallel limit. Batch and download subsystems must size their worker
+// pools with it.
+func (e *Engine) Parallelism(requested int) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if requested < 1 {
+		requested = 1
+	}
+	if limit := e.Metadata.Concurrency.MaxParallel; limit > 0 && requested > limit {
+		return limit
+	}
+	return requested
+}
@@ -0,0 +1,107 @@
+package anko
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/ancientcatz/anko/extras"
+)
+
+// ContentFormat is the form in which ContentRule returns chapter content.
+type ContentFormat int
+
+const (
+	// ContentFullHTML returns the content as the rule produced it.
+	ContentFullHTML ContentFormat = iota
+	// ContentLimitedHTML keeps only the tags of ContentPolicy.AllowedTags,
+	// dropping scripts, styles, event handlers and the like.
+	ContentLimitedHTML
+	// ContentPlainText strips all markup, keeping paragraphs and line
+	// breaks.
+	ContentPlainText
+	// ContentNarration returns plain text for text-to-speech engines, with
+	// bracketed notes removed and numbers spelled out (see
+	// extras.NarrationText).
+	ContentNarration
+	// ContentSSML returns the narration text as an SSML document.
+	ContentSSML
+)
+
+// ContentPolicy describes the content a host application can render, so
+// every source's output is shaped the same way whatever HTML the site
+// serves.
+type ContentPolicy struct {
+	Format ContentFormat
+	// AllowedTags are the tags kept by ContentLimitedHTML. When empty,
+	// extras.DefaultAllowedTags are kept.
+	AllowedTags []string
+}
+
+// SetContentPolicy applies p to the content key of every ContentRule result.
+// The zero policy returns content unchanged.
+func (e *Engine) SetContentPolicy(p ContentPolicy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p.AllowedTags = slices.Clone(p.AllowedTags)
+	e.contentPolicy = p
+}
+
+// applyContentPolicy rewrites the content of a ContentRule result according
+// to the engine's policy. Content that is not a string is left untouched.
+func (e *Engine) applyContentPolicy(result map[string]any) error {
+	e.mu.Lock()
+	p := e.contentPolicy
+	e.mu.Unlock()
+	src, ok := result["content"].(string)
+	if !ok {
+		return nil
+	}
+	var err error
+	switch p.Format {
+	case ContentLimitedHTML:
+		result["content"], err = extras.SanitizeHTML(src, p.AllowedTags...)
+	case ContentPlainText:
+		result["content"], err = extras.HTMLToText(src)
+	case ContentNarration:
+		result["content"], err = extras.NarrationText(src)
+	case ContentSSML:
+		result["content"], err = extras.NarrationSSML(src)
+	}
+	if err != nil {
+		return fmt.Errorf("ContentRule: applying content policy: %w", err)
+	}
+	return nil
+}
+
+// normalizeImages checks the images of an image chapter result and rewrites
+// them as maps with a url and a referer. Images may be URL strings or maps
+// with a url and an optional referer; the referer defaults to the chapter's
+// URL.
+func normalizeImages(result map[string]any, referer string) error {
+	items, ok := result["images"].([]any)
+	if !ok {
+		return withCode(CodeValidationType, fmt.Errorf("ContentRule: key 'images' is not an array"))
+	}
+	images := make([]any, len(items))
+	for i, item := range items {
+		image := map[string]any{"referer": referer}
+		switch v := item.(type) {
+		case string:
+			image["url"] = v
+		case map[string]any:
+			u, ok := v["url"].(string)
+			if !ok {
+				return withCode(CodeValidationType, fmt.Errorf("ContentRule: images[%d] has no string url", i))
+			}
+			image["url"] = u
+			if r, ok := v["referer"].(string); ok {
+				image["referer"] = r
+			}
+		default:
+			return withCode(CodeValidationType, fmt.Errorf("ContentRule: images[%d] is not a URL or a map", i))
+		}
+		images[i] = image
+	}
+	result["images"] = images
+	return nil
+}
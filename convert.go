@@ -0,0 +1,198 @@
+package anko
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/d5/tengo/v2"
+)
+
+// Converter converts a Go value into a tengo.Object. It reports false for
+// values it does not handle.
+type Converter func(v any) (tengo.Object, bool)
+
+// maxConvertDepth bounds the nesting of the values converted for scripts;
+// deeper values become undefined.
+const maxConvertDepth = 64
+
+// RegisterConverter adds a Converter consulted before the built-in
+// conversions whenever a Go value is passed to the engine's scripts, e.g.
+// through AddEnvVar, RunRuleWithEnv or a host function result. Converters
+// registered later take precedence. Tenant engines created afterwards
+// inherit them. Cached compilations are dropped so later runs use c.
+func (e *Engine) RegisterConverter(c Converter) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.converters = append([]Converter{c}, e.converters...)
+	e.compiledCache.clear()
+}
+
+// toTengoObject converts a Go value into the corresponding tengo.Object with
+// the built-in conversions only; see conversion.
+func toTengoObject(v any) tengo.Object {
+	return newConversion(nil).object(v, 0)
+}
+
+// conversion converts Go values into tengo.Objects, consulting converters
+// first. Slices, arrays and maps of any element type become arrays and maps,
+// structs become maps of their exported fields (named as in fieldName) and
+// pointers are followed. Values with no Tengo counterpart fall back to their
+// string representation. A value referring back to itself, through a
+// pointer, map or slice, becomes undefined where it recurs, as do values
+// nested deeper than maxConvertDepth.
+type conversion struct {
+	converters []Converter
+	// path holds the pointers, maps and slices being converted, from the
+	// outermost value down.
+	path map[convertRef]bool
+}
+
+// convertRef identifies a pointer, map or slice by its address and type.
+type convertRef struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+func newConversion(converters []Converter) *conversion {
+	return &conversion{converters: converters, path: make(map[convertRef]bool)}
+}
+
+// object converts v, found at the given nesting depth.
+func (c *conversion) object(v any, depth int) tengo.Object {
+	if depth > maxConvertDepth {
+		return tengo.UndefinedValue
+	}
+	for _, conv := range c.converters {
+		if obj, ok := conv(v); ok {
+			return obj
+		}
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return tengo.UndefinedValue
+	case tengo.Object:
+		return v
+	case string:
+		return &tengo.String{Value: v}
+	case bool:
+		if v {
+			return tengo.TrueValue
+		}
+		return tengo.FalseValue
+	case int:
+		return &tengo.Int{Value: int64(v)}
+	case time.Time:
+		return &tengo.Time{Value: v}
+	case time.Duration:
+		return &tengo.Int{Value: int64(v)}
+	case []byte:
+		return &tengo.Bytes{Value: v}
+	case error:
+		return &tengo.Error{Value: &tengo.String{Value: v.Error()}}
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice:
+		if rv.IsNil() {
+			break
+		}
+		ref := convertRef{rv.Pointer(), rv.Type()}
+		if c.path[ref] {
+			return tengo.UndefinedValue
+		}
+		c.path[ref] = true
+		defer delete(c.path, ref)
+	}
+
+	switch v := v.(type) {
+	case []any:
+		arr := make([]tengo.Object, len(v))
+		for i, e := range v {
+			arr[i] = c.object(e, depth+1)
+		}
+		return &tengo.Array{Value: arr}
+	case map[string]any:
+		mm := make(map[string]tengo.Object, len(v))
+		for kk, vv := range v {
+			mm[kk] = c.object(vv, depth+1)
+		}
+		return &tengo.ImmutableMap{Value: mm}
+	}
+	return c.reflect(rv, depth)
+}
+
+// reflect converts the values object has no direct case for.
+func (c *conversion) reflect(rv reflect.Value, depth int) tengo.Object {
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return tengo.UndefinedValue
+		}
+		return c.object(rv.Elem().Interface(), depth+1)
+	case reflect.String:
+		return &tengo.String{Value: rv.String()}
+	case reflect.Bool:
+		return c.object(rv.Bool(), depth)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &tengo.Int{Value: rv.Int()}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &tengo.Int{Value: int64(rv.Uint())}
+	case reflect.Float32, reflect.Float64:
+		return &tengo.Float{Value: rv.Float()}
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return &tengo.Array{}
+		}
+		arr := make([]tengo.Object, rv.Len())
+		for i := range arr {
+			arr[i] = c.object(rv.Index(i).Interface(), depth+1)
+		}
+		return &tengo.Array{Value: arr}
+	case reflect.Map:
+		mm := make(map[string]tengo.Object, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			mm[fmt.Sprint(iter.Key().Interface())] = c.object(iter.Value().Interface(), depth+1)
+		}
+		return &tengo.ImmutableMap{Value: mm}
+	case reflect.Struct:
+		mm := make(map[string]tengo.Object, rv.NumField())
+		rt := rv.Type()
+		for i := range rt.NumField() {
+			f := rt.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, ok := fieldName(f)
+			if !ok {
+				continue
+			}
+			mm[name] = c.object(rv.Field(i).Interface(), depth+1)
+		}
+		return &tengo.ImmutableMap{Value: mm}
+	case reflect.Invalid:
+		return tengo.UndefinedValue
+	default:
+		// fallback: string representation
+		return &tengo.String{Value: fmt.Sprintf("%v", rv.Interface())}
+	}
+}
+
+// fieldName returns the map key for a struct field, taken from its anko, yaml
+// or json tag when present. ok is false for fields tagged "-".
+func fieldName(f reflect.StructField) (string, bool) {
+	for _, key := range []string{"anko", "yaml", "json"} {
+		tag, _, _ := strings.Cut(f.Tag.Get(key), ",")
+		if tag == "-" {
+			return "", false
+		}
+		if tag != "" {
+			return tag, true
+		}
+	}
+	return f.Name, true
+}
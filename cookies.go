@@ -0,0 +1,24 @@
+package anko
+
+import "github.com/ancientcatz/anko/extras"
+
+// ExportCookies returns the cookies of the engine's HTTP session, e.g. to
+// persist a login across restarts with ImportCookies. Expired cookies are
+// left out. Tenant engines have cookies of their own.
+func (e *Engine) ExportCookies() []extras.Cookie {
+	return e.cookieJar().Export()
+}
+
+// ImportCookies adds cookies, typically from ExportCookies, to the engine's
+// HTTP session, replacing those with the same domain, path and name.
+func (e *Engine) ImportCookies(cookies []extras.Cookie) {
+	e.cookieJar().Import(cookies)
+}
+
+// cookieJar returns the session cookie jar, which is kept when the HTTP
+// client is rebuilt.
+func (e *Engine) cookieJar() *extras.CookieJar {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.moduleConfig.Jar
+}
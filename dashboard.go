@@ -0,0 +1,144 @@
+package anko
+
+import "time"
+
+// Health classifies how well a source has been working lately.
+type Health string
+
+const (
+	// HealthUnknown sources have not run yet.
+	HealthUnknown Health = "unknown"
+	// HealthOK sources fail less often than DashboardOptions.DegradedRate.
+	HealthOK Health = "ok"
+	// HealthDegraded sources fail at least as often as
+	// DashboardOptions.DegradedRate.
+	HealthDegraded Health = "degraded"
+	// HealthFailing sources fail at least as often as
+	// DashboardOptions.FailingRate.
+	HealthFailing Health = "failing"
+)
+
+// DashboardOptions configure how Dashboard rates sources. Zero fields take
+// their defaults.
+type DashboardOptions struct {
+	// Window is the number of latest runs per rule the error rate and
+	// latency are computed from; it is bounded by the history size (see
+	// SetHistorySize). Defaults to the history size.
+	Window int
+	// DegradedRate and FailingRate are the error rates, between 0 and 1, at
+	// which a source is degraded or failing. They default to 0.2 and 0.5.
+	DegradedRate float64
+	FailingRate  float64
+}
+
+// SourceStatus is the state of one source in a Dashboard.
+type SourceStatus struct {
+	ID         string
+	Name       string
+	Version    string
+	Deprecated bool
+	Health     Health
+	// Mirror is the base URL in use.
+	Mirror string
+	// Runs and Failures count every run since the engine was created.
+	Runs     int
+	Failures int
+	// ErrorRate and AvgLatency cover the runs in the window. Without run
+	// history they cover every run.
+	ErrorRate  float64
+	AvgLatency time.Duration
+	// LastSuccess and LastFailure are zero when there was no such run.
+	LastSuccess time.Time
+	LastFailure time.Time
+	LastError   string
+}
+
+// Dashboard is a snapshot of the state of every source of a SourceManager,
+// in registration order, together with the number of sources per health,
+// for rendering a sources page in a host application.
+type Dashboard struct {
+	Generated time.Time
+	Sources   []SourceStatus
+	Health    map[Health]int
+}
+
+// Dashboard returns a snapshot of the health of every registered source,
+// rated as configured by opts.
+func (m *SourceManager) Dashboard(opts DashboardOptions) Dashboard {
+	if opts.DegradedRate <= 0 {
+		opts.DegradedRate = 0.2
+	}
+	if opts.FailingRate <= 0 {
+		opts.FailingRate = 0.5
+	}
+	_, engines := m.snapshot()
+	d := Dashboard{
+		Generated: time.Now(),
+		Sources:   make([]SourceStatus, len(engines)),
+		Health:    make(map[Health]int),
+	}
+	for i, e := range engines {
+		d.Sources[i] = e.status(opts)
+		d.Health[d.Sources[i].Health]++
+	}
+	return d
+}
+
+// status returns the SourceStatus of e rated with opts.
+func (e *Engine) status(opts DashboardOptions) SourceStatus {
+	stats := e.Stats()
+	e.mu.Lock()
+	s := SourceStatus{
+		ID:          e.Metadata.Identifier,
+		Name:        e.Metadata.Name,
+		Version:     e.Metadata.Version,
+		Deprecated:  e.Metadata.Deprecated != nil,
+		Mirror:      stats.Mirror,
+		Runs:        stats.Runs,
+		Failures:    stats.Failures,
+		LastSuccess: stats.LastSuccess,
+		LastFailure: stats.LastFailure,
+		LastError:   stats.LastError,
+	}
+	window := opts.Window
+	if window <= 0 {
+		window = e.historySize
+	}
+	var recent []RunReport
+	for _, h := range e.history {
+		recent = append(recent, h.latest(window)...)
+	}
+	e.mu.Unlock()
+
+	var runs, failures int
+	var total time.Duration
+	if len(recent) > 0 {
+		for _, r := range recent {
+			runs++
+			total += r.Duration
+			if r.Error != "" {
+				failures++
+			}
+		}
+	} else {
+		runs, failures = stats.Runs, stats.Failures
+		for _, rs := range stats.Rules {
+			total += rs.Total
+		}
+	}
+	if runs == 0 {
+		s.Health = HealthUnknown
+		return s
+	}
+	s.ErrorRate = float64(failures) / float64(runs)
+	s.AvgLatency = total / time.Duration(runs)
+	switch {
+	case s.ErrorRate >= opts.FailingRate:
+		s.Health = HealthFailing
+	case s.ErrorRate >= opts.DegradedRate:
+		s.Health = HealthDegraded
+	default:
+		s.Health = HealthOK
+	}
+	return s
+}
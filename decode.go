@@ -0,0 +1,197 @@
+package anko
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// RunRuleInto runs a rule with env merged over Engine.Env, as RunRuleWithEnv
+// does, and decodes its "result" into out, which must be a non-nil pointer.
+// Struct fields are matched by their anko, yaml or json tag, falling back to
+// the field name compared case-insensitively:
+//
+//	type Chapter struct {
+//		Title string `anko:"title"`
+//		URL   string `anko:"url"`
+//	}
+//	var chapters []Chapter
+//	err := e.RunRuleInto("chapter-list", env, &chapters)
+//
+// Keys without a matching field are ignored and missing keys leave the field
+// unchanged.
+func (e *Engine) RunRuleInto(ruleName string, env map[string]any, out any) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("RunRuleInto: out must be a non-nil pointer, got %T", out)
+	}
+	resultVar, err := e.runRuleAndGetResult(ruleName, env)
+	if err != nil {
+		return err
+	}
+	if err := decodeValue("result", resultVar.Value(), rv.Elem()); err != nil {
+		e.Logger.Error("Cannot decode result", "rule", ruleName, "error", err)
+		return fmt.Errorf("RunRuleInto: rule '%s': %w", ruleName, err)
+	}
+	return nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// decodeValue stores the Go form of a Tengo value, as returned by
+// tengo.ToInterface, into out. path names the value in errors.
+func decodeValue(path string, in any, out reflect.Value) error {
+	if in == nil {
+		return nil
+	}
+	if out.Type() == timeType {
+		switch v := in.(type) {
+		case time.Time:
+			out.Set(reflect.ValueOf(v))
+		case string:
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			out.Set(reflect.ValueOf(t))
+		default:
+			return decodeError(path, in, out)
+		}
+		return nil
+	}
+
+	switch out.Kind() {
+	case reflect.Pointer:
+		if out.IsNil() {
+			out.Set(reflect.New(out.Type().Elem()))
+		}
+		return decodeValue(path, in, out.Elem())
+	case reflect.Interface:
+		v := reflect.ValueOf(in)
+		if !v.Type().AssignableTo(out.Type()) {
+			return decodeError(path, in, out)
+		}
+		out.Set(v)
+	case reflect.String:
+		switch v := in.(type) {
+		case string:
+			out.SetString(v)
+		case []byte:
+			out.SetString(string(v))
+		default:
+			return decodeError(path, in, out)
+		}
+	case reflect.Bool:
+		v, ok := in.(bool)
+		if !ok {
+			return decodeError(path, in, out)
+		}
+		out.SetBool(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, ok := in.(int64)
+		if !ok || out.OverflowInt(v) {
+			return decodeError(path, in, out)
+		}
+		out.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, ok := in.(int64)
+		if !ok || v < 0 || out.OverflowUint(uint64(v)) {
+			return decodeError(path, in, out)
+		}
+		out.SetUint(uint64(v))
+	case reflect.Float32, reflect.Float64:
+		switch v := in.(type) {
+		case float64:
+			out.SetFloat(v)
+		case int64:
+			out.SetFloat(float64(v))
+		default:
+			return decodeError(path, in, out)
+		}
+	case reflect.Slice:
+		if out.Type().Elem().Kind() == reflect.Uint8 {
+			switch v := in.(type) {
+			case []byte:
+				out.SetBytes(v)
+				return nil
+			case string:
+				out.SetBytes([]byte(v))
+				return nil
+			}
+		}
+		arr, ok := in.([]any)
+		if !ok {
+			return decodeError(path, in, out)
+		}
+		s := reflect.MakeSlice(out.Type(), len(arr), len(arr))
+		for i, item := range arr {
+			if err := decodeValue(fmt.Sprintf("%s[%d]", path, i), item, s.Index(i)); err != nil {
+				return err
+			}
+		}
+		out.Set(s)
+	case reflect.Array:
+		arr, ok := in.([]any)
+		if !ok || len(arr) > out.Len() {
+			return decodeError(path, in, out)
+		}
+		for i, item := range arr {
+			if err := decodeValue(fmt.Sprintf("%s[%d]", path, i), item, out.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		m, ok := in.(map[string]any)
+		if !ok || out.Type().Key().Kind() != reflect.String {
+			return decodeError(path, in, out)
+		}
+		if out.IsNil() {
+			out.Set(reflect.MakeMapWithSize(out.Type(), len(m)))
+		}
+		for k, v := range m {
+			elem := reflect.New(out.Type().Elem()).Elem()
+			if err := decodeValue(path+"."+k, v, elem); err != nil {
+				return err
+			}
+			out.SetMapIndex(reflect.ValueOf(k).Convert(out.Type().Key()), elem)
+		}
+	case reflect.Struct:
+		m, ok := in.(map[string]any)
+		if !ok {
+			return decodeError(path, in, out)
+		}
+		rt := out.Type()
+		for i := range rt.NumField() {
+			f := rt.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, ok := fieldName(f)
+			if !ok {
+				continue
+			}
+			key, exists := name, false
+			if _, exists = m[name]; !exists {
+				for k := range m {
+					if strings.EqualFold(k, name) {
+						key, exists = k, true
+						break
+					}
+				}
+			}
+			if exists {
+				if err := decodeValue(path+"."+key, m[key], out.Field(i)); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		return decodeError(path, in, out)
+	}
+	return nil
+}
+
+func decodeError(path string, in any, out reflect.Value) error {
+	return withCode(CodeValidationType, fmt.Errorf("%s: cannot decode %T into %s", path, in, out.Type()))
+}
@@ -0,0 +1,196 @@
+package anko
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The areas of a CacheManager, each a directory under its root.
+const (
+	// CacheHTTP is for HTTP responses cached by the host.
+	CacheHTTP = "http"
+	// CacheContent is for chapter content cached by the host.
+	CacheContent = "content"
+	// CacheCovers holds the files rules download with req.download.
+	CacheCovers = "covers"
+	// CacheBytecode is for compiled rules persisted by the host.
+	CacheBytecode = "bytecode"
+	// CacheSources holds the definitions downloaded by LoadURL.
+	CacheSources = "sources"
+)
+
+// CacheUsage reports the disk usage of a CacheManager.
+type CacheUsage struct {
+	Root   string
+	Budget int64
+	// Total is the size of all cached files, in bytes.
+	Total int64
+	Files int
+	// Areas breaks Total down by area.
+	Areas map[string]int64
+	// Evictions is the number of files evicted since the manager was
+	// created.
+	Evictions int
+}
+
+// CacheManager keeps the on-disk caches of one or more engines under a
+// single root directory, one area per kind of data, within a total size
+// budget. When a cache write takes the total over the budget, the least
+// recently used files of all areas are evicted until it fits again. Files
+// are used when written or touched, as tracked by their modification time.
+type CacheManager struct {
+	root   string
+	budget int64
+
+	mu        sync.Mutex
+	evictions int
+}
+
+// NewCacheManager creates a CacheManager rooted at root, creating the
+// directory. budget is the total size limit in bytes; zero or less means no
+// limit.
+func NewCacheManager(root string, budget int64) (*CacheManager, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &CacheManager{root: root, budget: max(budget, 0)}, nil
+}
+
+// Dir returns the directory of area, creating it.
+func (m *CacheManager) Dir(area string) (string, error) {
+	dir := filepath.Join(m.root, area)
+	return dir, os.MkdirAll(dir, 0o755)
+}
+
+// Touch marks the cached file at path as used, so it is evicted after files
+// used less recently.
+func (m *CacheManager) Touch(path string) {
+	touchFile(path)
+}
+
+// touchFile sets the modification time of the file at path to now, which
+// CacheManager takes as its last use.
+func touchFile(path string) {
+	now := time.Now()
+	os.Chtimes(path, now, now)
+}
+
+// cachedFile is a file found by CacheManager.scan.
+type cachedFile struct {
+	path string
+	area string
+	size int64
+	used time.Time
+}
+
+// scan lists the files under the root.
+func (m *CacheManager) scan() ([]cachedFile, error) {
+	var files []cachedFile
+	err := filepath.WalkDir(m.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(m.root, path)
+		area, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+		files = append(files, cachedFile{path: path, area: area, size: info.Size(), used: info.ModTime()})
+		return nil
+	})
+	return files, err
+}
+
+// Usage returns the current disk usage of the caches.
+func (m *CacheManager) Usage() (CacheUsage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	files, err := m.scan()
+	return m.usage(files), err
+}
+
+func (m *CacheManager) usage(files []cachedFile) CacheUsage {
+	u := CacheUsage{Root: m.root, Budget: m.budget, Files: len(files), Areas: make(map[string]int64), Evictions: m.evictions}
+	for _, f := range files {
+		u.Total += f.size
+		u.Areas[f.area] += f.size
+	}
+	return u
+}
+
+// Trim evicts the least recently used files until the caches fit the
+// budget, and returns the resulting usage.
+func (m *CacheManager) Trim() (CacheUsage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	files, err := m.scan()
+	if err != nil {
+		return m.usage(files), err
+	}
+	total := int64(0)
+	for _, f := range files {
+		total += f.size
+	}
+	if m.budget == 0 || total <= m.budget {
+		return m.usage(files), nil
+	}
+	slices.SortFunc(files, func(a, b cachedFile) int {
+		return a.used.Compare(b.used)
+	})
+	kept := files[:0]
+	for i, f := range files {
+		if total <= m.budget {
+			kept = append(kept, files[i:]...)
+			break
+		}
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			kept = append(kept, f)
+			continue
+		}
+		total -= f.size
+		m.evictions++
+	}
+	return m.usage(kept), nil
+}
+
+// WithCacheManager keeps the on-disk caches of the engine and its tenants
+// in m: files downloaded by rules go to its covers area, unless
+// SetDownloadDir chooses another directory, and definitions loaded with
+// LoadURL to its sources area, unless WithCacheDir is given. The caches are
+// trimmed to m's budget after every write, and Stats reports their usage.
+func WithCacheManager(m *CacheManager) Option {
+	return func(e *Engine) {
+		e.cacheManager = m
+		if dir, err := m.Dir(CacheCovers); err == nil {
+			e.moduleConfig.DownloadDir = dir
+		} else {
+			e.Logger.Error("Cannot create cache directory", "dir", dir, "error", err)
+		}
+	}
+}
+
+// trimCache trims the caches of the engine's CacheManager, if any.
+func (e *Engine) trimCache() {
+	e.mu.Lock()
+	m := e.cacheManager
+	e.mu.Unlock()
+	if m == nil {
+		return
+	}
+	if _, err := m.Trim(); err != nil {
+		e.Logger.Warn("Cannot trim cache", "root", m.root, "error", err)
+	}
+}
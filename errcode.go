@@ -0,0 +1,108 @@
+package anko
+
+import (
+	"errors"
+	"net"
+	"net/url"
+
+	"github.com/ancientcatz/anko/extras"
+	"github.com/d5/tengo/v2"
+)
+
+// ErrorCode is a stable, machine-readable identifier of an error class, for
+// frontends that localize messages or branch on the kind of failure. The
+// values never change once released; messages may.
+type ErrorCode string
+
+// Error codes returned by Code.
+const (
+	CodeUnknown ErrorCode = "ANKO_UNKNOWN"
+
+	CodeYAMLInvalid    ErrorCode = "ANKO_YAML_INVALID"
+	CodeConfigInvalid  ErrorCode = "ANKO_CONFIG_INVALID"
+	CodeIO             ErrorCode = "ANKO_IO"
+	CodeSecretNotFound ErrorCode = "ANKO_SECRET_NOT_FOUND"
+
+	CodeRuleNotFound      ErrorCode = "ANKO_RULE_NOT_FOUND"
+	CodeRuleDependency    ErrorCode = "ANKO_RULE_DEPENDENCY"
+	CodeCompile           ErrorCode = "ANKO_COMPILE_ERROR"
+	CodeModuleUnavailable ErrorCode = "ANKO_MODULE_UNAVAILABLE"
+	CodeRuntime           ErrorCode = "ANKO_RUNTIME_ERROR"
+	CodeRuleTimeout       ErrorCode = "ANKO_RULE_TIMEOUT"
+	CodeCanceled          ErrorCode = "ANKO_CANCELED"
+	CodeResourceLimit     ErrorCode = "ANKO_RESOURCE_LIMIT"
+	CodeNoResult          ErrorCode = "ANKO_NO_RESULT"
+
+	CodeHTTPTimeout ErrorCode = "ANKO_HTTP_TIMEOUT"
+	CodeHTTP        ErrorCode = "ANKO_HTTP_ERROR"
+	CodeHostDenied  ErrorCode = "ANKO_HTTP_HOST_NOT_ALLOWED"
+
+	CodeValidationMissingKey ErrorCode = "ANKO_VALIDATION_MISSING_KEY"
+	CodeValidationType       ErrorCode = "ANKO_VALIDATION_TYPE"
+
+	CodeSourceNotFound   ErrorCode = "ANKO_SOURCE_NOT_FOUND"
+	CodeSourceInvalid    ErrorCode = "ANKO_SOURCE_INVALID"
+	CodeSourceExists     ErrorCode = "ANKO_SOURCE_EXISTS"
+	CodeRemoteInsecure   ErrorCode = "ANKO_REMOTE_INSECURE"
+	CodeRemoteFetch      ErrorCode = "ANKO_REMOTE_FETCH"
+	CodeRemoteChecksum   ErrorCode = "ANKO_REMOTE_CHECKSUM"
+	CodeRemoteSigned     ErrorCode = "ANKO_REMOTE_SIGNATURE"
+	CodeSourceUnsigned   ErrorCode = "ANKO_SOURCE_UNSIGNED"
+	CodeSignatureInvalid ErrorCode = "ANKO_SIGNATURE_INVALID"
+
+	CodeBridgeRequest ErrorCode = "ANKO_BRIDGE_INVALID_REQUEST"
+	CodeBridgeMethod  ErrorCode = "ANKO_BRIDGE_UNKNOWN_METHOD"
+	CodeLibrarySync   ErrorCode = "ANKO_LIBRARY_SYNC"
+)
+
+// codedError attaches an ErrorCode to an error without changing its message.
+type codedError struct {
+	code ErrorCode
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// withCode attaches code to err; a nil err stays nil.
+func withCode(code ErrorCode, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &codedError{code: code, err: err}
+}
+
+// Code returns the code of err: the outermost code attached by anko, or
+// CodeUnknown when err carries none. A nil error has the empty code.
+func Code(err error) ErrorCode {
+	if err == nil {
+		return ""
+	}
+	var ce *codedError
+	if errors.As(err, &ce) {
+		return ce.code
+	}
+	return CodeUnknown
+}
+
+// runtimeCode classifies an error returned while running a rule's script by
+// what caused it inside the script.
+func runtimeCode(err error) ErrorCode {
+	var ce *codedError
+	var netErr net.Error
+	var urlErr *url.Error
+	switch {
+	case errors.As(err, &ce):
+		return ce.code
+	case errors.Is(err, extras.ErrHostNotAllowed):
+		return CodeHostDenied
+	case errors.Is(err, tengo.ErrObjectAllocLimit), errors.Is(err, extras.ErrRequestLimit):
+		return CodeResourceLimit
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return CodeHTTPTimeout
+	case errors.As(err, &urlErr):
+		return CodeHTTP
+	default:
+		return CodeRuntime
+	}
+}
@@ -0,0 +1,189 @@
+package extras
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/d5/tengo/v2"
+)
+
+// Default limits of the archive module, overridable per call with the
+// max_files and max_bytes options.
+const (
+	DefaultArchiveMaxFiles = 1000
+	DefaultArchiveMaxBytes = 64 << 20
+)
+
+// archiveLimits bound the number of files and the total uncompressed size an
+// archive may expand to.
+type archiveLimits struct {
+	maxFiles int
+	maxBytes int64
+}
+
+// archiveModule implements the archive module.
+func archiveModule(_ *Invocation) map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"unzip": &tengo.UserFunction{
+			Name: "unzip",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				data, limits, err := archiveArgs("archive.unzip", args)
+				if err != nil {
+					return nil, err
+				}
+				files, err := Unzip(data, limits.maxFiles, limits.maxBytes)
+				if err != nil {
+					return nil, fmt.Errorf("archive.unzip: %w", err)
+				}
+				return filesToTengo(files), nil
+			},
+		},
+		"untar_gz": &tengo.UserFunction{
+			Name: "untar_gz",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				data, limits, err := archiveArgs("archive.untar_gz", args)
+				if err != nil {
+					return nil, err
+				}
+				files, err := UntarGz(data, limits.maxFiles, limits.maxBytes)
+				if err != nil {
+					return nil, fmt.Errorf("archive.untar_gz: %w", err)
+				}
+				return filesToTengo(files), nil
+			},
+		},
+	}
+}
+
+// archiveArgs reads the (data, options) arguments shared by the archive
+// functions.
+func archiveArgs(fn string, args []tengo.Object) ([]byte, archiveLimits, error) {
+	limits := archiveLimits{maxFiles: DefaultArchiveMaxFiles, maxBytes: DefaultArchiveMaxBytes}
+	if len(args) < 1 || len(args) > 2 {
+		return nil, limits, fmt.Errorf("%s: expected 1 or 2 arguments", fn)
+	}
+	data, ok := tengo.ToByteSlice(args[0])
+	if !ok {
+		return nil, limits, fmt.Errorf("%s: first argument must be bytes", fn)
+	}
+	if len(args) == 2 {
+		m, ok := args[1].(*tengo.Map)
+		if !ok {
+			return nil, limits, fmt.Errorf("%s: options must be a map", fn)
+		}
+		if v, ok := m.Value["max_files"]; ok {
+			n, ok := tengo.ToInt(v)
+			if !ok || n <= 0 || n > DefaultArchiveMaxFiles {
+				return nil, limits, fmt.Errorf("%s: options.max_files must be between 1 and %d", fn, DefaultArchiveMaxFiles)
+			}
+			limits.maxFiles = n
+		}
+		if v, ok := m.Value["max_bytes"]; ok {
+			n, ok := tengo.ToInt64(v)
+			if !ok || n <= 0 || n > DefaultArchiveMaxBytes {
+				return nil, limits, fmt.Errorf("%s: options.max_bytes must be between 1 and %d", fn, DefaultArchiveMaxBytes)
+			}
+			limits.maxBytes = n
+		}
+	}
+	return data, limits, nil
+}
+
+func filesToTengo(files map[string][]byte) *tengo.Map {
+	m := make(map[string]tengo.Object, len(files))
+	for name, data := range files {
+		m[name] = &tengo.Bytes{Value: data}
+	}
+	return &tengo.Map{Value: m}
+}
+
+var errArchiveTooLarge = errors.New("archive exceeds the size limit")
+
+// readLimited reads r, failing once the total read across an archive would
+// exceed the remaining budget.
+func readLimited(r io.Reader, remaining *int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, *remaining+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > *remaining {
+		return nil, errArchiveTooLarge
+	}
+	*remaining -= int64(len(data))
+	return data, nil
+}
+
+// Unzip returns the regular files of a zip archive keyed by path. It fails
+// when the archive holds more than maxFiles files or expands to more than
+// maxBytes, whatever sizes its headers declare.
+func Unzip(data []byte, maxFiles int, maxBytes int64) (map[string][]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte)
+	remaining := maxBytes
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if len(files) >= maxFiles {
+			return nil, fmt.Errorf("archive holds more than %d files", maxFiles)
+		}
+		if f.UncompressedSize64 > uint64(remaining) {
+			return nil, errArchiveTooLarge
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		content, err := readLimited(rc, &remaining)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		files[f.Name] = content
+	}
+	return files, nil
+}
+
+// UntarGz returns the regular files of a gzip-compressed tar archive keyed by
+// path, with the same limits as Unzip.
+func UntarGz(data []byte, maxFiles int, maxBytes int64) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	files := make(map[string][]byte)
+	remaining := maxBytes
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if len(files) >= maxFiles {
+			return nil, fmt.Errorf("archive holds more than %d files", maxFiles)
+		}
+		if hdr.Size > remaining {
+			return nil, errArchiveTooLarge
+		}
+		content, err := readLimited(tr, &remaining)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		files[hdr.Name] = content
+	}
+}
@@ -0,0 +1,152 @@
+package extras
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/d5/tengo/v2"
+	req "github.com/imroc/req/v3"
+)
+
+// Credentials are the credentials of the user at a source, injected by the
+// host so they never appear in rule files. Scripts read them with
+// req.credentials, e.g. to log in or to pass them to req.set_basic_auth;
+// they are never sent unless a script does so.
+type Credentials struct {
+	Username string
+	Password string
+	// Token is a bearer token or an API key.
+	Token string
+}
+
+// requestAuth is the authorization of a req module request: HTTP basic auth
+// or, when bearer is set, a bearer token.
+type requestAuth struct {
+	username string
+	password string
+	bearer   string
+}
+
+// apply sets the Authorization header of r; a nil a sets none.
+func (a *requestAuth) apply(r *req.Request) {
+	switch {
+	case a == nil:
+	case a.bearer != "":
+		r.SetBearerAuthToken(a.bearer)
+	default:
+		r.SetBasicAuth(a.username, a.password)
+	}
+}
+
+// String identifies a for memoization.
+func (a *requestAuth) String() string {
+	if a == nil {
+		return ""
+	}
+	return fmt.Sprintf("%q:%q:%q", a.username, a.password, a.bearer)
+}
+
+// parseAuth reads the auth option of a request: {username, password} for
+// HTTP basic auth or {bearer} for a bearer token.
+func parseAuth(obj tengo.Object) (*requestAuth, error) {
+	m, ok := scriptMap(obj)
+	if !ok {
+		return nil, errors.New("must be a map")
+	}
+	str := func(key string) string {
+		if s, ok := m[key].(*tengo.String); ok {
+			return s.Value
+		}
+		return ""
+	}
+	if bearer := str("bearer"); bearer != "" {
+		return &requestAuth{bearer: bearer}, nil
+	}
+	if _, ok := m["username"]; !ok {
+		return nil, errors.New("needs a username and password or a bearer token")
+	}
+	return &requestAuth{username: str("username"), password: str("password")}, nil
+}
+
+// requestAuth returns the authorization set for the invocation's requests
+// with req.set_basic_auth or req.set_bearer, or nil.
+func (inv *Invocation) requestAuth() *requestAuth {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return inv.auth
+}
+
+// setAuth sets the authorization of the invocation's requests; nil clears
+// it.
+func (inv *Invocation) setAuth(a *requestAuth) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.auth = a
+}
+
+// authFuncs returns the authentication functions of the req module:
+// set_basic_auth(user, pass) and set_bearer(token) authorize the later
+// requests of the invocation, unless they set their own auth option or
+// Authorization header, and empty arguments stop doing so; credentials()
+// returns Config.Credentials as {username, password, token}, or undefined.
+func authFuncs(inv *Invocation) map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"set_basic_auth": &tengo.UserFunction{
+			Name: "set_basic_auth",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 2 {
+					return nil, fmt.Errorf("http.set_basic_auth: expected 2 arguments")
+				}
+				user, ok := args[0].(*tengo.String)
+				if !ok {
+					return nil, fmt.Errorf("http.set_basic_auth: first argument must be a string")
+				}
+				pass, ok := args[1].(*tengo.String)
+				if !ok {
+					return nil, fmt.Errorf("http.set_basic_auth: second argument must be a string")
+				}
+				if user.Value == "" && pass.Value == "" {
+					inv.setAuth(nil)
+				} else {
+					inv.setAuth(&requestAuth{username: user.Value, password: pass.Value})
+				}
+				return tengo.UndefinedValue, nil
+			},
+		},
+		"set_bearer": &tengo.UserFunction{
+			Name: "set_bearer",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 1 {
+					return nil, fmt.Errorf("http.set_bearer: expected 1 argument")
+				}
+				token, ok := args[0].(*tengo.String)
+				if !ok {
+					return nil, fmt.Errorf("http.set_bearer: argument must be a string")
+				}
+				if token.Value == "" {
+					inv.setAuth(nil)
+				} else {
+					inv.setAuth(&requestAuth{bearer: token.Value})
+				}
+				return tengo.UndefinedValue, nil
+			},
+		},
+		"credentials": &tengo.UserFunction{
+			Name: "credentials",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 0 {
+					return nil, tengo.ErrWrongNumArguments
+				}
+				c := inv.Config.Credentials
+				if c == nil {
+					return tengo.UndefinedValue, nil
+				}
+				return &tengo.ImmutableMap{Value: map[string]tengo.Object{
+					"username": &tengo.String{Value: c.Username},
+					"password": &tengo.String{Value: c.Password},
+					"token":    &tengo.String{Value: c.Token},
+				}}, nil
+			},
+		},
+	}
+}
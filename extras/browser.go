@@ -0,0 +1,540 @@
+//go:build !anko_nobrowser
+
+package extras
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d5/tengo/v2"
+)
+
+func init() {
+	ExtraModules["browser"] = browserModule
+}
+
+// DefaultBrowserTimeout bounds page loads and waits of the browser module
+// when Browser.Timeout is zero.
+const DefaultBrowserTimeout = 30 * time.Second
+
+// ErrNoBrowser is returned by the browser module when Config.Browser is not
+// set.
+var ErrNoBrowser = errors.New("no browser configured")
+
+// browserExecutables are the names searched in PATH for Browser.Exec.
+var browserExecutables = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome"}
+
+// Browser is a headless Chrome or Chromium driven over the DevTools protocol,
+// which renders the pages of the browser module. It is started on first use
+// and shared by all invocations, each page being a tab of its own; Close
+// shuts it down.
+type Browser struct {
+	// Exec is the browser executable; when empty, the first of chromium,
+	// chromium-browser, google-chrome, google-chrome-stable and chrome found
+	// in PATH is started.
+	Exec string
+	// Endpoint, when set, is the DevTools endpoint of an already running
+	// browser to use instead of starting one: its websocket URL, e.g.
+	// "ws://127.0.0.1:9222/devtools/browser/<id>", or the URL of its
+	// debugging port, e.g. "http://127.0.0.1:9222".
+	Endpoint string
+	// Args are extra command line flags of a started browser.
+	Args []string
+	// Timeout bounds page loads and waits; zero means
+	// DefaultBrowserTimeout.
+	Timeout time.Duration
+
+	mu      sync.Mutex
+	conn    *cdpConn
+	cmd     *exec.Cmd
+	dataDir string
+}
+
+func (b *Browser) timeout() time.Duration {
+	if b.Timeout <= 0 {
+		return DefaultBrowserTimeout
+	}
+	return b.Timeout
+}
+
+// connect returns the connection to the browser, starting the browser or
+// reconnecting to it when there is none or it was lost.
+func (b *Browser) connect(ctx context.Context) (*cdpConn, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn != nil && !b.conn.closed() {
+		return b.conn, nil
+	}
+	b.stop()
+	wsURL := b.Endpoint
+	if wsURL == "" {
+		var err error
+		if wsURL, err = b.launch(ctx); err != nil {
+			return nil, err
+		}
+	} else if !strings.HasPrefix(wsURL, "ws") {
+		var err error
+		if wsURL, err = debuggerURL(ctx, wsURL); err != nil {
+			return nil, err
+		}
+	}
+	conn, err := dialCDP(ctx, wsURL)
+	if err != nil {
+		b.stop()
+		return nil, err
+	}
+	b.conn = conn
+	return conn, nil
+}
+
+// debuggerURL returns the browser websocket URL of the debugging port at
+// endpoint.
+func debuggerURL(ctx context.Context, endpoint string) (string, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(endpoint, "/")+"/json/version", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var version struct {
+		WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+		return "", fmt.Errorf("%s: %w", endpoint, err)
+	}
+	if version.WebSocketDebuggerURL == "" {
+		return "", fmt.Errorf("%s: no DevTools endpoint", endpoint)
+	}
+	return version.WebSocketDebuggerURL, nil
+}
+
+// launch starts the browser with a fresh profile and returns its websocket
+// URL, which it prints once listening. The caller must hold b.mu.
+func (b *Browser) launch(ctx context.Context) (string, error) {
+	exe := b.Exec
+	if exe == "" {
+		for _, name := range browserExecutables {
+			if path, err := exec.LookPath(name); err == nil {
+				exe = path
+				break
+			}
+		}
+		if exe == "" {
+			return "", errors.New("no Chrome or Chromium executable found")
+		}
+	}
+	dir, err := os.MkdirTemp("", "anko-browser-")
+	if err != nil {
+		return "", err
+	}
+	args := append([]string{
+		"--headless=new",
+		"--remote-debugging-port=0",
+		"--user-data-dir=" + dir,
+		"--no-first-run",
+		"--no-default-browser-check",
+		"--disable-gpu",
+	}, b.Args...)
+	cmd := exec.Command(exe, append(args, "about:blank")...)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	b.cmd, b.dataDir = cmd, dir
+
+	found := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			if u, ok := strings.CutPrefix(scanner.Text(), "DevTools listening on "); ok {
+				found <- strings.TrimSpace(u)
+				break
+			}
+		}
+		close(found)
+		io.Copy(io.Discard, stderr)
+	}()
+	ctx, cancel := context.WithTimeout(ctx, b.timeout())
+	defer cancel()
+	select {
+	case u, ok := <-found:
+		if ok {
+			return u, nil
+		}
+		b.stop()
+		return "", fmt.Errorf("%s exited before listening", exe)
+	case <-ctx.Done():
+		b.stop()
+		return "", fmt.Errorf("starting %s: %w", exe, ctx.Err())
+	}
+}
+
+// stop closes the connection and ends the started browser, if any. The
+// caller must hold b.mu.
+func (b *Browser) stop() {
+	if b.conn != nil {
+		if b.cmd != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			b.conn.call(ctx, "", "Browser.close", nil, nil)
+			cancel()
+		}
+		b.conn.fail(errCDPClosed)
+		b.conn = nil
+	}
+	if b.cmd != nil {
+		done := make(chan struct{})
+		go func(cmd *exec.Cmd) {
+			cmd.Wait()
+			close(done)
+		}(b.cmd)
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			b.cmd.Process.Kill()
+			<-done
+		}
+		b.cmd = nil
+	}
+	if b.dataDir != "" {
+		os.RemoveAll(b.dataDir)
+		b.dataDir = ""
+	}
+}
+
+// Close shuts the browser down, closing its pages. It is started again when
+// used afterwards.
+func (b *Browser) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stop()
+	return nil
+}
+
+// browserPage is a tab of the browser, the page object of the browser
+// module.
+type browserPage struct {
+	tengo.ObjectImpl
+	inv     *Invocation
+	conn    *cdpConn
+	target  string
+	session string
+	url     string
+
+	closeOnce sync.Once
+	stop      func() bool
+}
+
+func (p *browserPage) TypeName() string {
+	return "browser-page"
+}
+
+func (p *browserPage) String() string {
+	return "<browser-page " + p.url + ">"
+}
+
+func (p *browserPage) Copy() tengo.Object {
+	return p
+}
+
+// ctx returns the context of a page operation, bounded by the browser
+// timeout or, when positive, timeout.
+func (p *browserPage) ctx(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = p.inv.Config.Browser.timeout()
+	}
+	return context.WithTimeout(p.inv.Context, timeout)
+}
+
+// evaluate runs the JavaScript expression in the page, awaiting it when it
+// is a promise, and decodes its JSON value into out.
+func (p *browserPage) evaluate(ctx context.Context, expr string, out any) error {
+	var res struct {
+		Result struct {
+			Type  string          `json:"type"`
+			Value json.RawMessage `json:"value"`
+		} `json:"result"`
+		ExceptionDetails *struct {
+			Text      string `json:"text"`
+			Exception struct {
+				Description string `json:"description"`
+			} `json:"exception"`
+		} `json:"exceptionDetails"`
+	}
+	err := p.conn.call(ctx, p.session, "Runtime.evaluate", map[string]any{
+		"expression":    expr,
+		"returnByValue": true,
+		"awaitPromise":  true,
+	}, &res)
+	if err != nil {
+		return err
+	}
+	if e := res.ExceptionDetails; e != nil {
+		if e.Exception.Description != "" {
+			return errors.New(e.Exception.Description)
+		}
+		return errors.New(e.Text)
+	}
+	if len(res.Result.Value) == 0 {
+		res.Result.Value = json.RawMessage("null")
+	}
+	return json.Unmarshal(res.Result.Value, out)
+}
+
+// poll evaluates the boolean expression every 100ms until it is true.
+func (p *browserPage) poll(ctx context.Context, expr string) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		var ok bool
+		if err := p.evaluate(ctx, expr, &ok); err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// close closes the tab, once.
+func (p *browserPage) close() {
+	p.closeOnce.Do(func() {
+		p.stop()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		p.conn.call(ctx, "", "Target.closeTarget", map[string]any{"targetId": p.target}, nil)
+	})
+}
+
+// jsString quotes s as a JavaScript string literal.
+func jsString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func (p *browserPage) IndexGet(index tengo.Object) (tengo.Object, error) {
+	k, ok := index.(*tengo.String)
+	if !ok {
+		return tengo.UndefinedValue, nil
+	}
+	switch k.Value {
+	case "url":
+		return &tengo.String{Value: p.url}, nil
+	case "wait":
+		return &tengo.UserFunction{
+			Name: "wait",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) < 1 || len(args) > 2 {
+					return nil, fmt.Errorf("browser.wait: expected 1 or 2 arguments")
+				}
+				sel, ok := args[0].(*tengo.String)
+				if !ok {
+					return nil, fmt.Errorf("browser.wait: first argument must be a string")
+				}
+				var timeout time.Duration
+				if len(args) == 2 {
+					ms, ok := tengo.ToInt64(args[1])
+					if !ok {
+						return nil, fmt.Errorf("browser.wait: second argument must be an int")
+					}
+					timeout = time.Duration(ms) * time.Millisecond
+				}
+				ctx, cancel := p.ctx(timeout)
+				defer cancel()
+				if err := p.poll(ctx, "document.querySelector("+jsString(sel.Value)+") !== null"); err != nil {
+					return nil, fmt.Errorf("browser.wait: %s: %w", sel.Value, err)
+				}
+				return tengo.TrueValue, nil
+			},
+		}, nil
+	case "html":
+		return &tengo.UserFunction{
+			Name: "html",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 0 {
+					return nil, tengo.ErrWrongNumArguments
+				}
+				ctx, cancel := p.ctx(0)
+				defer cancel()
+				var s string
+				if err := p.evaluate(ctx, "document.documentElement.outerHTML", &s); err != nil {
+					return nil, fmt.Errorf("browser.html: %w", err)
+				}
+				return &tengo.String{Value: s}, nil
+			},
+		}, nil
+	case "click":
+		return &tengo.UserFunction{
+			Name: "click",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 1 {
+					return nil, fmt.Errorf("browser.click: expected 1 argument")
+				}
+				sel, ok := args[0].(*tengo.String)
+				if !ok {
+					return nil, fmt.Errorf("browser.click: argument must be a string")
+				}
+				ctx, cancel := p.ctx(0)
+				defer cancel()
+				var clicked bool
+				expr := "(() => { const el = document.querySelector(" + jsString(sel.Value) + "); if (!el) return false; el.click(); return true })()"
+				if err := p.evaluate(ctx, expr, &clicked); err != nil {
+					return nil, fmt.Errorf("browser.click: %w", err)
+				}
+				if !clicked {
+					return nil, fmt.Errorf("browser.click: no element matches %s", sel.Value)
+				}
+				return tengo.UndefinedValue, nil
+			},
+		}, nil
+	case "eval":
+		return &tengo.UserFunction{
+			Name: "eval",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 1 {
+					return nil, fmt.Errorf("browser.eval: expected 1 argument")
+				}
+				js, ok := args[0].(*tengo.String)
+				if !ok {
+					return nil, fmt.Errorf("browser.eval: argument must be a string")
+				}
+				ctx, cancel := p.ctx(0)
+				defer cancel()
+				var v any
+				if err := p.evaluate(ctx, js.Value, &v); err != nil {
+					return nil, fmt.Errorf("browser.eval: %w", err)
+				}
+				return tengo.FromInterface(v)
+			},
+		}, nil
+	case "close":
+		return &tengo.UserFunction{
+			Name: "close",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				p.close()
+				return tengo.UndefinedValue, nil
+			},
+		}, nil
+	}
+	return tengo.UndefinedValue, nil
+}
+
+// openPage opens rawURL in a new tab and waits until it has loaded. The tab is
+// closed when the invocation ends, if the script does not close it before.
+func (inv *Invocation) openPage(rawURL string) (*browserPage, error) {
+	b := inv.Config.Browser
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid URL %q", rawURL)
+	}
+	if len(inv.Config.AllowedHosts) > 0 && !HostAllowed(u.Hostname(), inv.Config.AllowedHosts) {
+		return nil, fmt.Errorf("%w: %s", ErrHostNotAllowed, u.Hostname())
+	}
+	ctx, cancel := context.WithTimeout(inv.Context, b.timeout())
+	defer cancel()
+	conn, err := b.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var target struct {
+		TargetID string `json:"targetId"`
+	}
+	if err := conn.call(ctx, "", "Target.createTarget", map[string]any{"url": "about:blank"}, &target); err != nil {
+		return nil, err
+	}
+	p := &browserPage{inv: inv, conn: conn, target: target.TargetID, url: rawURL}
+	p.stop = context.AfterFunc(inv.Context, p.close)
+	var attached struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := conn.call(ctx, "", "Target.attachToTarget", map[string]any{"targetId": target.TargetID, "flatten": true}, &attached); err != nil {
+		p.close()
+		return nil, err
+	}
+	p.session = attached.SessionID
+	if err := p.navigate(ctx, rawURL); err != nil {
+		p.close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// navigate presents the invocation's identity, if any, loads rawURL and
+// waits for the document to be complete.
+func (p *browserPage) navigate(ctx context.Context, rawURL string) error {
+	if id := p.inv.Config.Identity; id != nil {
+		if err := p.conn.call(ctx, p.session, "Emulation.setUserAgentOverride", map[string]any{"userAgent": id.UserAgent, "acceptLanguage": id.AcceptLanguage}, nil); err != nil {
+			return err
+		}
+		if err := p.conn.call(ctx, p.session, "Emulation.setDeviceMetricsOverride", map[string]any{"width": id.ViewportWidth, "height": id.ViewportHeight, "deviceScaleFactor": 1, "mobile": false}, nil); err != nil {
+			return err
+		}
+	}
+	var nav struct {
+		ErrorText string `json:"errorText"`
+	}
+	if err := p.conn.call(ctx, p.session, "Page.navigate", map[string]any{"url": rawURL}, &nav); err != nil {
+		return err
+	}
+	if nav.ErrorText != "" {
+		return fmt.Errorf("%s: %s", rawURL, nav.ErrorText)
+	}
+	return p.poll(ctx, `document.readyState === "complete"`)
+}
+
+// browserModule implements the browser module, which renders pages with
+// JavaScript in Config.Browser:
+//
+//	page := browser.open(url)
+//	page.wait("#chapter-content")
+//	doc := html.parse(page.html())
+//
+// Pages also offer click(selector), eval(js), whose result is converted
+// from JSON, url and close().
+func browserModule(inv *Invocation) map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"open": &tengo.UserFunction{
+			Name: "open",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 1 {
+					return nil, fmt.Errorf("browser.open: expected 1 argument")
+				}
+				u, ok := args[0].(*tengo.String)
+				if !ok {
+					return nil, fmt.Errorf("browser.open: argument must be a string")
+				}
+				if inv.Config.Browser == nil {
+					return nil, fmt.Errorf("browser.open: %w", ErrNoBrowser)
+				}
+				p, err := inv.openPage(u.Value)
+				if err != nil {
+					return nil, fmt.Errorf("browser.open: %w", err)
+				}
+				return p, nil
+			},
+		},
+	}
+}
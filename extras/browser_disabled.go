@@ -0,0 +1,32 @@
+//go:build anko_nobrowser
+
+package extras
+
+import (
+	"errors"
+	"time"
+)
+
+func init() {
+	UnavailableModules["browser"] = "build without the anko_nobrowser tag"
+}
+
+// DefaultBrowserTimeout bounds page loads and waits of the browser module
+// when Browser.Timeout is zero.
+const DefaultBrowserTimeout = 30 * time.Second
+
+// ErrNoBrowser is returned by the browser module when Config.Browser is not
+// set.
+var ErrNoBrowser = errors.New("no browser configured")
+
+// Browser configures a headless browser for the browser module, which this
+// build leaves out: it is never started.
+type Browser struct {
+	Exec     string
+	Endpoint string
+	Args     []string
+	Timeout  time.Duration
+}
+
+// Close does nothing, since the browser is never started.
+func (b *Browser) Close() error { return nil }
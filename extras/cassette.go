@@ -0,0 +1,180 @@
+package extras
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	req "github.com/imroc/req/v3"
+)
+
+// RecordMode selects how a Recorder treats requests.
+type RecordMode int
+
+const (
+	// RecordAuto replays recorded responses and records the missing ones.
+	RecordAuto RecordMode = iota
+	// RecordReplay only replays; requests without a recording fail with
+	// ErrNoRecording and never reach the network.
+	RecordReplay
+	// RecordRecord sends every request and records its response, replacing
+	// earlier recordings.
+	RecordRecord
+)
+
+// ErrNoRecording is returned in RecordReplay mode for requests that have not
+// been recorded.
+var ErrNoRecording = errors.New("no recorded response")
+
+// Recorder records HTTP responses of the req module to files in Dir and
+// replays them, VCR style, so rule tests can run without the network.
+// Requests are matched by method, URL and body.
+type Recorder struct {
+	Dir  string
+	Mode RecordMode
+}
+
+// recording is the file format of a recorded response. Bodies that are not
+// valid UTF-8 are stored base64 encoded.
+type recording struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Proto  string      `json:"proto"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+	Base64 bool        `json:"base64,omitempty"`
+}
+
+// wrap returns a round tripper replaying and recording the requests sent
+// through rt.
+func (rec *Recorder) wrap(rt http.RoundTripper) req.HttpRoundTripFunc {
+	return func(r *http.Request) (*http.Response, error) {
+		path, err := rec.path(r)
+		if err != nil {
+			return nil, err
+		}
+		if rec.Mode != RecordRecord {
+			data, err := os.ReadFile(path)
+			switch {
+			case err == nil:
+				return replay(r, data)
+			case !errors.Is(err, os.ErrNotExist):
+				return nil, fmt.Errorf("reading recorded response: %w", err)
+			case rec.Mode == RecordReplay:
+				return nil, fmt.Errorf("%w for %s %s", ErrNoRecording, r.Method, r.URL)
+			}
+		}
+		resp, err := rt.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+		if err := rec.record(path, r, resp); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+// path returns the file recording the response to r. The request body, if
+// any, is read and restored.
+func (rec *Recorder) path(r *http.Request) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", r.Method, r.URL)
+	if r.Body != nil && r.Body != http.NoBody {
+		body, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("reading request body: %w", err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		h.Write(body)
+	}
+	host := strings.NewReplacer(":", "_", "/", "_").Replace(r.URL.Host)
+	return filepath.Join(rec.Dir, host+"-"+hex.EncodeToString(h.Sum(nil))[:16]+".json"), nil
+}
+
+// record writes resp to path and replaces its body with the bytes read.
+func (rec *Recorder) record(path string, r *http.Request, resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("reading response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	rc := recording{
+		Method: r.Method,
+		URL:    r.URL.String(),
+		Status: resp.StatusCode,
+		Proto:  resp.Proto,
+		Header: resp.Header,
+		Body:   string(body),
+	}
+	if !utf8.Valid(body) {
+		rc.Body, rc.Base64 = base64.StdEncoding.EncodeToString(body), true
+	}
+	data, err := json.MarshalIndent(rc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(rec.Dir, 0o755); err != nil {
+		return fmt.Errorf("recording response: %w", err)
+	}
+	tmp, err := os.CreateTemp(rec.Dir, ".recording-*")
+	if err != nil {
+		return fmt.Errorf("recording response: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("recording response: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("recording response: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("recording response: %w", err)
+	}
+	return nil
+}
+
+// replay builds the response to r recorded in data.
+func replay(r *http.Request, data []byte) (*http.Response, error) {
+	var rc recording
+	if err := json.Unmarshal(data, &rc); err != nil {
+		return nil, fmt.Errorf("decoding recorded response: %w", err)
+	}
+	body := []byte(rc.Body)
+	if rc.Base64 {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(rc.Body); err != nil {
+			return nil, fmt.Errorf("decoding recorded response: %w", err)
+		}
+	}
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", rc.Status, http.StatusText(rc.Status)),
+		StatusCode:    rc.Status,
+		Proto:         rc.Proto,
+		Header:        rc.Header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}
+	if resp.Header == nil {
+		resp.Header = make(http.Header)
+	}
+	// An Alt-Svc header would make the client probe the network for HTTP/3.
+	resp.Header.Del("Alt-Svc")
+	resp.ProtoMajor, resp.ProtoMinor, _ = http.ParseHTTPVersion(rc.Proto)
+	return resp, nil
+}
@@ -0,0 +1,137 @@
+//go:build !anko_nobrowser
+
+package extras
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+// errCDPClosed is returned for calls on a closed DevTools connection.
+var errCDPClosed = errors.New("devtools connection closed")
+
+// cdpConn is a connection to the DevTools protocol endpoint of a browser.
+// Calls to page targets go through flat sessions, so one connection serves
+// every page. Events are ignored.
+type cdpConn struct {
+	ws *websocket.Conn
+
+	mu      sync.Mutex
+	next    int64
+	pending map[int64]chan cdpResponse
+	done    chan struct{}
+	err     error
+}
+
+type cdpRequest struct {
+	ID        int64  `json:"id"`
+	SessionID string `json:"sessionId,omitempty"`
+	Method    string `json:"method"`
+	Params    any    `json:"params,omitempty"`
+}
+
+type cdpResponse struct {
+	ID     int64           `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// dialCDP connects to the DevTools websocket at wsURL.
+func dialCDP(ctx context.Context, wsURL string) (*cdpConn, error) {
+	config, err := websocket.NewConfig(wsURL, "http://localhost")
+	if err != nil {
+		return nil, err
+	}
+	ws, err := config.DialContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c := &cdpConn{ws: ws, pending: make(map[int64]chan cdpResponse), done: make(chan struct{})}
+	go c.read()
+	return c, nil
+}
+
+// read delivers responses to their callers until the connection fails.
+func (c *cdpConn) read() {
+	for {
+		var msg cdpResponse
+		if err := websocket.JSON.Receive(c.ws, &msg); err != nil {
+			c.fail(err)
+			return
+		}
+		if msg.ID == 0 {
+			continue
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[msg.ID]
+		delete(c.pending, msg.ID)
+		c.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	}
+}
+
+// fail closes the connection with err, failing the pending calls.
+func (c *cdpConn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+	c.ws.Close()
+}
+
+// closed reports whether the connection is no longer usable.
+func (c *cdpConn) closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err != nil
+}
+
+// call sends method with params to the session, or to the browser when
+// session is empty, and decodes the result into result unless it is nil.
+func (c *cdpConn) call(ctx context.Context, session, method string, params, result any) error {
+	ch := make(chan cdpResponse, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return errCDPClosed
+	}
+	c.next++
+	id := c.next
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+	if err := websocket.JSON.Send(c.ws, cdpRequest{ID: id, SessionID: session, Method: method, Params: params}); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	select {
+	case msg := <-ch:
+		if msg.Error != nil {
+			return fmt.Errorf("%s: %s", method, msg.Error.Message)
+		}
+		if result != nil {
+			return json.Unmarshal(msg.Result, result)
+		}
+		return nil
+	case <-c.done:
+		return fmt.Errorf("%s: %w", method, errCDPClosed)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
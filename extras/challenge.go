@@ -0,0 +1,152 @@
+package extras
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d5/tengo/v2"
+	req "github.com/imroc/req/v3"
+)
+
+// DefaultSolverTimeout bounds how long a ChallengeSolver waits for a
+// challenge to be solved.
+const DefaultSolverTimeout = 60 * time.Second
+
+// ChallengeSolver forwards GETs answered with an anti-bot challenge page,
+// such as Cloudflare's or DDoS-Guard's, to a FlareSolverr endpoint, which
+// solves the challenge in a real browser. The clearance cookies it returns
+// go to the invocation's cookie jar and its User-Agent, which the cookies
+// are bound to, is sent with later requests to the same host, so they pass
+// without solving again. It is shared by all invocations.
+type ChallengeSolver struct {
+	// Endpoint is the URL of the FlareSolverr server, e.g.
+	// "http://localhost:8191".
+	Endpoint string
+	// Timeout bounds the solving of a challenge; zero means
+	// DefaultSolverTimeout.
+	Timeout time.Duration
+
+	client *req.Client
+
+	mu         sync.Mutex
+	userAgents map[string]string
+}
+
+// NewChallengeSolver creates a ChallengeSolver for the FlareSolverr server
+// at endpoint.
+func NewChallengeSolver(endpoint string) *ChallengeSolver {
+	return &ChallengeSolver{Endpoint: strings.TrimSuffix(endpoint, "/"), client: req.C(), userAgents: make(map[string]string)}
+}
+
+// challengePage reports whether r is an anti-bot challenge rather than the
+// page asked for.
+func challengePage(r *http.Response) bool {
+	if r.Header.Get("Cf-Mitigated") == "challenge" {
+		return true
+	}
+	switch r.StatusCode {
+	case http.StatusForbidden, http.StatusServiceUnavailable, http.StatusTooManyRequests:
+	default:
+		return false
+	}
+	server := strings.ToLower(r.Header.Get("Server"))
+	return strings.Contains(server, "cloudflare") || strings.Contains(server, "ddos-guard")
+}
+
+// userAgent returns the User-Agent of the latest solution for host, or "".
+// A nil s has none.
+func (s *ChallengeSolver) userAgent(host string) string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.userAgents[host]
+}
+
+// solverResponse is the reply of FlareSolverr to a request.get command.
+type solverResponse struct {
+	Status   string `json:"status"`
+	Message  string `json:"message"`
+	Solution struct {
+		URL       string            `json:"url"`
+		Status    int               `json:"status"`
+		Headers   map[string]string `json:"headers"`
+		Response  string            `json:"response"`
+		UserAgent string            `json:"userAgent"`
+		Cookies   []struct {
+			Name     string  `json:"name"`
+			Value    string  `json:"value"`
+			Domain   string  `json:"domain"`
+			Path     string  `json:"path"`
+			Expires  float64 `json:"expires"`
+			HTTPOnly bool    `json:"httpOnly"`
+			Secure   bool    `json:"secure"`
+		} `json:"cookies"`
+	} `json:"solution"`
+}
+
+// solve has the challenge of the GET of rawURL solved and returns the
+// solved page as doRequest would have returned the response.
+func (s *ChallengeSolver) solve(fn, rawURL string, inv *Invocation, opts requestOptions) (tengo.Object, error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultSolverTimeout
+	}
+	ctx, cancel := context.WithTimeout(inv.Context, timeout+10*time.Second)
+	defer cancel()
+	inv.Logger.Info(fn+": solving challenge", "url", rawURL, "solver", s.Endpoint)
+	start := time.Now()
+	var out solverResponse
+	r, err := s.client.R().SetContext(ctx).
+		SetBodyJsonMarshal(map[string]any{"cmd": "request.get", "url": rawURL, "maxTimeout": timeout.Milliseconds()}).
+		SetSuccessResult(&out).
+		Post(s.Endpoint + "/v1")
+	if err != nil {
+		return nil, fmt.Errorf("%s: solving challenge: %w", fn, err)
+	}
+	if !r.IsSuccessState() || out.Status != "ok" {
+		return nil, fmt.Errorf("%s: solving challenge: status %d: %s", fn, r.StatusCode, out.Message)
+	}
+	sol := out.Solution
+	inv.noteResponse(sol.Status, false)
+	jar := inv.jar()
+	for _, c := range sol.Cookies {
+		cookie := Cookie{Name: c.Name, Value: c.Value, Domain: strings.TrimPrefix(c.Domain, "."), Path: c.Path, Secure: c.Secure, HTTPOnly: c.HTTPOnly, HostOnly: !strings.HasPrefix(c.Domain, ".")}
+		if c.Expires > 0 {
+			cookie.Expires = time.Unix(int64(c.Expires), 0)
+		}
+		jar.Import([]Cookie{cookie})
+	}
+	if sol.UserAgent != "" {
+		s.mu.Lock()
+		s.userAgents[requestHost(rawURL)] = sol.UserAgent
+		s.mu.Unlock()
+	}
+
+	headers := make(http.Header, len(sol.Headers))
+	for k, v := range sol.Headers {
+		headers.Set(k, v)
+	}
+	result := map[string]tengo.Object{
+		"status":      &tengo.Int{Value: int64(sol.Status)},
+		"headers":     convertHeaders(headers),
+		"url":         &tengo.String{Value: sol.URL},
+		"final_url":   &tengo.String{Value: sol.URL},
+		"redirects":   &tengo.Array{},
+		"proto":       &tengo.String{Value: ""},
+		"duration_ms": &tengo.Int{Value: time.Since(start).Milliseconds()},
+	}
+	if opts.stream {
+		result["stream"] = &ankoResponseBody{body: io.NopCloser(strings.NewReader(sol.Response)), cancel: func() {}}
+	} else {
+		// The solver renders the page as text, already decoded.
+		setBody(inv, fn, rawURL, result, []byte(sol.Response), "text/html; charset=utf-8", opts.bytes)
+	}
+	return &tengo.Map{Value: result}, nil
+}
@@ -0,0 +1,99 @@
+package extras
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// HTMLSection is a part of an HTML fragment split by SplitHTML.
+type HTMLSection struct {
+	// Title is the text of the heading starting the section, empty for
+	// content before the first heading.
+	Title string
+	HTML  string
+}
+
+// SplitHTML splits the HTML fragment src before every element whose text
+// matches heading, e.g. `^Chapter \d+`, so a page holding several chapters
+// can be read as separate ones. Headings are looked for among the children
+// of the fragment, or of the element wrapping all of it. Sections without
+// content besides whitespace are dropped; when no heading matches, src is
+// returned as a single section.
+func SplitHTML(src string, heading *regexp.Regexp) ([]HTMLSection, error) {
+	nodes, err := parseFragment(src)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		wrapper := soleElement(nodes)
+		if wrapper == nil || heading.MatchString(nodeText(wrapper)) {
+			break
+		}
+		nodes = nodes[:0]
+		for c := wrapper.FirstChild; c != nil; c = c.NextSibling {
+			nodes = append(nodes, c)
+		}
+	}
+
+	var sections []HTMLSection
+	var current HTMLSection
+	var b strings.Builder
+	flush := func() {
+		current.HTML = strings.TrimSpace(b.String())
+		b.Reset()
+		if current.HTML != "" {
+			sections = append(sections, current)
+		}
+	}
+	for _, n := range nodes {
+		if n.Type == html.ElementNode {
+			if text := nodeText(n); heading.MatchString(text) {
+				flush()
+				current = HTMLSection{Title: text}
+			}
+		}
+		if err := html.Render(&b, n); err != nil {
+			return nil, err
+		}
+	}
+	flush()
+	if len(sections) <= 1 {
+		return []HTMLSection{{HTML: src}}, nil
+	}
+	return sections, nil
+}
+
+// soleElement returns the only element of nodes when all others are
+// whitespace text.
+func soleElement(nodes []*html.Node) *html.Node {
+	var el *html.Node
+	for _, n := range nodes {
+		switch {
+		case n.Type == html.ElementNode && el == nil:
+			el = n
+		case n.Type == html.TextNode && strings.TrimSpace(n.Data) == "":
+		case n.Type == html.CommentNode:
+		default:
+			return nil
+		}
+	}
+	return el
+}
+
+// nodeText returns the text of n with whitespace collapsed.
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
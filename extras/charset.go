@@ -0,0 +1,42 @@
+package extras
+
+import (
+	"github.com/d5/tengo/v2"
+	"golang.org/x/net/html/charset"
+)
+
+// decodeText returns body decoded to UTF-8 together with the name of the
+// charset it was decoded from. The charset is taken from the charset
+// parameter of the content type ct, a byte order mark or a <meta> tag, in
+// that order; bodies declaring none are UTF-8 when valid, and windows-1252
+// otherwise, as browsers assume. A body that does not decode is returned
+// as is.
+func decodeText(body []byte, ct string) (string, string) {
+	enc, name, _ := charset.DetermineEncoding(body, ct)
+	if name == "utf-8" {
+		return string(body), name
+	}
+	out, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return string(body), name
+	}
+	return string(out), name
+}
+
+// responseContentType returns the Content-Type header of the response map
+// resp, or "" when it has none.
+func responseContentType(resp *tengo.Map) string {
+	headers, ok := resp.Value["headers"].(*tengo.Map)
+	if !ok {
+		return ""
+	}
+	values, ok := headers.Value["Content-Type"].(*tengo.Array)
+	if !ok || len(values.Value) == 0 {
+		return ""
+	}
+	s, _ := values.Value[0].(*tengo.String)
+	if s == nil {
+		return ""
+	}
+	return s.Value
+}
@@ -0,0 +1,312 @@
+package extras
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d5/tengo/v2"
+	"golang.org/x/net/publicsuffix"
+)
+
+// Cookie is a cookie stored in a CookieJar, in a form that can be persisted,
+// e.g. as JSON, and imported again.
+type Cookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Domain is the host that set the cookie, or the domain it was set for.
+	Domain string `json:"domain"`
+	Path   string `json:"path"`
+	// Expires is zero for session cookies.
+	Expires  time.Time `json:"expires,omitzero"`
+	Secure   bool      `json:"secure,omitempty"`
+	HTTPOnly bool      `json:"http_only,omitempty"`
+	// HostOnly cookies are sent to Domain only, not to its subdomains.
+	HostOnly bool `json:"host_only,omitempty"`
+}
+
+// cookieID identifies a cookie in a jar, as RFC 6265 does.
+type cookieID struct{ domain, path, name string }
+
+// CookieJar is a cookie jar whose cookies can be listed, exported and
+// imported, so a login session can outlive the process. Cookies are matched
+// to requests as by net/http/cookiejar with the public suffix list.
+type CookieJar struct {
+	mu      sync.Mutex
+	jar     *cookiejar.Jar
+	cookies map[cookieID]Cookie
+}
+
+// NewCookieJar returns an empty jar.
+func NewCookieJar() *CookieJar {
+	j := &CookieJar{}
+	j.Clear()
+	return j
+}
+
+// SetCookies implements http.CookieJar. Cookies the underlying jar
+// rejects, e.g. for a domain other than u's, are not recorded either.
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jar.SetCookies(u, cookies)
+	now := time.Now()
+	for _, c := range cookies {
+		id, stored := j.entry(u, c)
+		switch {
+		case c.MaxAge < 0, !c.Expires.IsZero() && !c.Expires.After(now):
+			delete(j.cookies, id)
+		case c.MaxAge > 0:
+			stored.Expires = now.Add(time.Duration(c.MaxAge) * time.Second).Round(0)
+			fallthrough
+		default:
+			if j.accepted(stored) {
+				j.cookies[id] = stored
+			}
+		}
+	}
+}
+
+// accepted reports whether the underlying jar holds c, reading it back for
+// its own domain and path. The caller must hold j.mu.
+func (j *CookieJar) accepted(c Cookie) bool {
+	u := &url.URL{Scheme: "http", Host: c.Domain, Path: c.Path}
+	if c.Secure {
+		u.Scheme = "https"
+	}
+	if strings.Contains(c.Domain, ":") {
+		u.Host = "[" + c.Domain + "]"
+	}
+	for _, got := range j.jar.Cookies(u) {
+		if got.Name == c.Name && got.Value == c.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// entry returns the stored form of c, received from u.
+func (j *CookieJar) entry(u *url.URL, c *http.Cookie) (cookieID, Cookie) {
+	stored := Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Domain:   strings.ToLower(u.Hostname()),
+		Path:     c.Path,
+		Expires:  c.Expires,
+		Secure:   c.Secure,
+		HTTPOnly: c.HttpOnly,
+		HostOnly: true,
+	}
+	if d := strings.TrimPrefix(strings.ToLower(c.Domain), "."); d != "" {
+		stored.Domain, stored.HostOnly = d, false
+	}
+	if stored.Path == "" || stored.Path[0] != '/' {
+		stored.Path = "/"
+		if i := strings.LastIndex(u.Path, "/"); i > 0 {
+			stored.Path = u.Path[:i]
+		}
+	}
+	return cookieID{stored.Domain, stored.Path, stored.Name}, stored
+}
+
+// Cookies implements http.CookieJar.
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.jar.Cookies(u)
+}
+
+// Get returns the unexpired cookies that are sent to host, sorted by
+// domain, path and name.
+func (j *CookieJar) Get(host string) []Cookie {
+	host = strings.ToLower(host)
+	var out []Cookie
+	for _, c := range j.Export() {
+		if c.Domain == host || !c.HostOnly && strings.HasSuffix(host, "."+c.Domain) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Export returns all unexpired cookies, sorted by domain, path and name.
+func (j *CookieJar) Export() []Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	out := make([]Cookie, 0, len(j.cookies))
+	for id, c := range j.cookies {
+		if !c.Expires.IsZero() && !c.Expires.After(now) {
+			delete(j.cookies, id)
+			continue
+		}
+		out = append(out, c)
+	}
+	slices.SortFunc(out, func(a, b Cookie) int {
+		return strings.Compare(a.Domain+"\x00"+a.Path+"\x00"+a.Name, b.Domain+"\x00"+b.Path+"\x00"+b.Name)
+	})
+	return out
+}
+
+// Import adds cookies, e.g. from an earlier Export, replacing those with the
+// same domain, path and name.
+func (j *CookieJar) Import(cookies []Cookie) {
+	for _, c := range cookies {
+		scheme := "http"
+		if c.Secure {
+			scheme = "https"
+		}
+		hc := &http.Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Expires:  c.Expires,
+			Secure:   c.Secure,
+			HttpOnly: c.HTTPOnly,
+		}
+		if !c.HostOnly {
+			hc.Domain = c.Domain
+		}
+		j.SetCookies(&url.URL{Scheme: scheme, Host: c.Domain, Path: c.Path}, []*http.Cookie{hc})
+	}
+}
+
+// Clear removes all cookies.
+func (j *CookieJar) Clear() {
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jar = jar
+	j.cookies = make(map[cookieID]Cookie)
+}
+
+// cookiesModule implements the cookies module over the jar of the
+// invocation's HTTP session.
+func cookiesModule(inv *Invocation) map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"get": &tengo.UserFunction{
+			Name: "get",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 1 {
+					return nil, fmt.Errorf("cookies.get: expected 1 argument")
+				}
+				host, ok := tengo.ToString(args[0])
+				if !ok {
+					return nil, fmt.Errorf("cookies.get: argument must be a string")
+				}
+				if u, err := url.Parse(host); err == nil && u.Host != "" {
+					host = u.Hostname()
+				}
+				arr := &tengo.Array{}
+				for _, c := range inv.jar().Get(host) {
+					arr.Value = append(arr.Value, cookieObject(c))
+				}
+				return arr, nil
+			},
+		},
+		"set": &tengo.UserFunction{
+			Name: "set",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) < 3 || len(args) > 4 {
+					return nil, fmt.Errorf("cookies.set: expected 3 or 4 arguments")
+				}
+				var s [3]string
+				for i := range s {
+					str, ok := args[i].(*tengo.String)
+					if !ok {
+						return nil, fmt.Errorf("cookies.set: url, name and value must be strings")
+					}
+					s[i] = str.Value
+				}
+				u, err := url.Parse(s[0])
+				if err != nil || u.Host == "" {
+					return nil, fmt.Errorf("cookies.set: invalid url '%s'", s[0])
+				}
+				c := &http.Cookie{Name: s[1], Value: s[2]}
+				if len(args) == 4 {
+					if err := cookieOptions(c, args[3]); err != nil {
+						return nil, err
+					}
+				}
+				inv.jar().SetCookies(u, []*http.Cookie{c})
+				return tengo.UndefinedValue, nil
+			},
+		},
+		"clear": &tengo.UserFunction{
+			Name: "clear",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 0 {
+					return nil, fmt.Errorf("cookies.clear: expected no arguments")
+				}
+				inv.jar().Clear()
+				return tengo.UndefinedValue, nil
+			},
+		},
+	}
+}
+
+// cookieOptions applies the attributes in the options map of cookies.set
+// to c: domain, path, max_age (seconds), secure and http_only.
+func cookieOptions(c *http.Cookie, obj tengo.Object) error {
+	m, ok := obj.(*tengo.Map)
+	if !ok {
+		return fmt.Errorf("cookies.set: options must be a map")
+	}
+	for key, v := range m.Value {
+		switch key {
+		case "domain", "path":
+			s, ok := tengo.ToString(v)
+			if !ok {
+				return fmt.Errorf("cookies.set: option '%s' must be a string", key)
+			}
+			if key == "domain" {
+				c.Domain = s
+			} else {
+				c.Path = s
+			}
+		case "max_age":
+			n, ok := tengo.ToInt(v)
+			if !ok {
+				return fmt.Errorf("cookies.set: option 'max_age' must be an int")
+			}
+			c.MaxAge = n
+			if n == 0 {
+				c.MaxAge = -1
+			}
+		case "secure":
+			c.Secure = !v.IsFalsy()
+		case "http_only":
+			c.HttpOnly = !v.IsFalsy()
+		default:
+			return fmt.Errorf("cookies.set: unknown option '%s'", key)
+		}
+	}
+	return nil
+}
+
+// cookieObject converts c to a Tengo map.
+func cookieObject(c Cookie) tengo.Object {
+	m := map[string]tengo.Object{
+		"name":      &tengo.String{Value: c.Name},
+		"value":     &tengo.String{Value: c.Value},
+		"domain":    &tengo.String{Value: c.Domain},
+		"path":      &tengo.String{Value: c.Path},
+		"secure":    tengo.FalseValue,
+		"http_only": tengo.FalseValue,
+	}
+	if c.Secure {
+		m["secure"] = tengo.TrueValue
+	}
+	if c.HTTPOnly {
+		m["http_only"] = tengo.TrueValue
+	}
+	if !c.Expires.IsZero() {
+		m["expires"] = &tengo.Time{Value: c.Expires}
+	}
+	return &tengo.ImmutableMap{Value: m}
+}
@@ -0,0 +1,338 @@
+package extras
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/d5/tengo/v2"
+)
+
+// Signer signs an outgoing request of the req module, e.g. by adding a
+// signature header or query parameter. It runs on a copy of every request
+// just before it is sent.
+type Signer func(r *http.Request) error
+
+// hashes maps the algorithm names accepted by the crypto module to their
+// constructors.
+var hashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// HMACHex returns the hex-encoded HMAC of msg with key using the named hash
+// algorithm (md5, sha1, sha256 or sha512).
+func HMACHex(algo string, key, msg []byte) (string, error) {
+	h, ok := hashes[algo]
+	if !ok {
+		return "", fmt.Errorf("unknown hash algorithm '%s'", algo)
+	}
+	mac := hmac.New(h, key)
+	mac.Write(msg)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// CanonicalRequest returns the string signed by crypto.sign_request: the
+// upper-cased method, the URL path, the query sorted by key and value, and
+// the hex SHA-256 of the body, separated by newlines.
+func CanonicalRequest(method, rawURL string, body []byte) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	sum := sha256.Sum256(body)
+	return strings.Join([]string{strings.ToUpper(method), path, strings.Join(pairs, "&"), hex.EncodeToString(sum[:])}, "\n"), nil
+}
+
+// requestBody returns the body of r without consuming it.
+func requestBody(r *http.Request) ([]byte, error) {
+	if r.GetBody == nil {
+		return nil, nil
+	}
+	body, err := r.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// HMACSigner returns a Signer that sets header to the HMAC (with algo) of the
+// request's CanonicalRequest, optionally preceded by prefix and a space,
+// e.g. HMACSigner("sha256", key, "Authorization", "HMAC").
+func HMACSigner(algo string, key []byte, header, prefix string) Signer {
+	return func(r *http.Request) error {
+		body, err := requestBody(r)
+		if err != nil {
+			return err
+		}
+		canonical, err := CanonicalRequest(r.Method, r.URL.String(), body)
+		if err != nil {
+			return err
+		}
+		sig, err := HMACHex(algo, key, []byte(canonical))
+		if err != nil {
+			return err
+		}
+		if prefix != "" {
+			sig = prefix + " " + sig
+		}
+		r.Header.Set(header, sig)
+		return nil
+	}
+}
+
+// cryptoModule implements the crypto module.
+func cryptoModule(_ *Invocation) map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"hmac": &tengo.UserFunction{
+			Name: "hmac",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 3 {
+					return nil, fmt.Errorf("crypto.hmac: expected 3 arguments")
+				}
+				algo, ok := tengo.ToString(args[0])
+				if !ok {
+					return nil, fmt.Errorf("crypto.hmac: algorithm must be a string")
+				}
+				key, ok1 := tengo.ToByteSlice(args[1])
+				msg, ok2 := tengo.ToByteSlice(args[2])
+				if !ok1 || !ok2 {
+					return nil, fmt.Errorf("crypto.hmac: key and message must be strings or bytes")
+				}
+				sig, err := HMACHex(algo, key, msg)
+				if err != nil {
+					return nil, fmt.Errorf("crypto.hmac: %w", err)
+				}
+				return &tengo.String{Value: sig}, nil
+			},
+		},
+		"hash": &tengo.UserFunction{
+			Name: "hash",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 2 {
+					return nil, fmt.Errorf("crypto.hash: expected 2 arguments")
+				}
+				algo, ok := tengo.ToString(args[0])
+				if !ok {
+					return nil, fmt.Errorf("crypto.hash: algorithm must be a string")
+				}
+				data, ok := tengo.ToByteSlice(args[1])
+				if !ok {
+					return nil, fmt.Errorf("crypto.hash: data must be a string or bytes")
+				}
+				h, ok := hashes[algo]
+				if !ok {
+					return nil, fmt.Errorf("crypto.hash: unknown hash algorithm '%s'", algo)
+				}
+				hh := h()
+				hh.Write(data)
+				return &tengo.String{Value: hex.EncodeToString(hh.Sum(nil))}, nil
+			},
+		},
+		"sign_request": &tengo.UserFunction{
+			Name:  "sign_request",
+			Value: signRequest,
+		},
+		"totp": &tengo.UserFunction{
+			Name: "totp",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) < 1 || len(args) > 2 {
+					return nil, fmt.Errorf("crypto.totp: expected 1 or 2 arguments")
+				}
+				secret, ok := tengo.ToString(args[0])
+				if !ok {
+					return nil, fmt.Errorf("crypto.totp: secret must be a string")
+				}
+				opts := totpOptions{digits: 6, period: 30, algo: "sha1"}
+				if len(args) == 2 {
+					m, ok := args[1].(*tengo.Map)
+					if !ok {
+						return nil, fmt.Errorf("crypto.totp: options must be a map")
+					}
+					if v, ok := m.Value["digits"]; ok {
+						opts.digits, _ = tengo.ToInt(v)
+					}
+					if v, ok := m.Value["period"]; ok {
+						opts.period, _ = tengo.ToInt64(v)
+					}
+					if v, ok := m.Value["algo"]; ok {
+						opts.algo, _ = tengo.ToString(v)
+					}
+				}
+				code, err := TOTP(secret, time.Now(), opts.digits, opts.period, opts.algo)
+				if err != nil {
+					return nil, fmt.Errorf("crypto.totp: %w", err)
+				}
+				return &tengo.String{Value: code}, nil
+			},
+		},
+		"timestamp_ms": &tengo.UserFunction{
+			Name: "timestamp_ms",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 0 {
+					return nil, fmt.Errorf("crypto.timestamp_ms: expected no arguments")
+				}
+				return &tengo.Int{Value: time.Now().UnixMilli()}, nil
+			},
+		},
+		"nonce": &tengo.UserFunction{
+			Name: "nonce",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) > 1 {
+					return nil, fmt.Errorf("crypto.nonce: expected at most 1 argument")
+				}
+				n := 16
+				if len(args) == 1 {
+					var ok bool
+					n, ok = tengo.ToInt(args[0])
+					if !ok || n <= 0 || n > 1024 {
+						return nil, fmt.Errorf("crypto.nonce: length must be between 1 and 1024 bytes")
+					}
+				}
+				b := make([]byte, n)
+				if _, err := rand.Read(b); err != nil {
+					return nil, fmt.Errorf("crypto.nonce: %w", err)
+				}
+				return &tengo.String{Value: hex.EncodeToString(b)}, nil
+			},
+		},
+	}
+}
+
+type totpOptions struct {
+	digits int
+	period int64
+	algo   string
+}
+
+// TOTP returns the RFC 6238 time-based one-time password for the base32
+// secret at t, with the given number of digits, period in seconds and hash
+// algorithm (sha1 in most authenticator apps).
+func TOTP(secret string, t time.Time, digits int, period int64, algo string) (string, error) {
+	if digits < 1 || digits > 10 || period <= 0 {
+		return "", fmt.Errorf("invalid digits %d or period %d", digits, period)
+	}
+	h, ok := hashes[algo]
+	if !ok {
+		return "", fmt.Errorf("unknown hash algorithm '%s'", algo)
+	}
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		return "", fmt.Errorf("invalid base32 secret: %w", err)
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/period))
+	mac := hmac.New(h, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", digits, uint64(code)%uint64(math.Pow10(digits))), nil
+}
+
+// signRequest implements crypto.sign_request(opts). opts holds method, url,
+// key and optionally body, algo (default sha256) and scheme:
+//
+//	query          appends the signature as query parameter param (default "signature")
+//	header         sets header (default "X-Signature") to the signature
+//	authorization  sets Authorization to prefix (default "HMAC") and the signature
+//
+// It returns {url, headers, signature, canonical}, ready to pass to req.get or
+// req.post.
+func signRequest(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("crypto.sign_request: expected 1 argument")
+	}
+	opts, ok := args[0].(*tengo.Map)
+	if !ok {
+		return nil, fmt.Errorf("crypto.sign_request: argument must be a map")
+	}
+	str := func(key, def string) string {
+		if v, ok := opts.Value[key]; ok {
+			if s, ok := tengo.ToString(v); ok {
+				return s
+			}
+		}
+		return def
+	}
+	method, rawURL, key := str("method", "GET"), str("url", ""), str("key", "")
+	if rawURL == "" || key == "" {
+		return nil, fmt.Errorf("crypto.sign_request: url and key are required")
+	}
+	var body []byte
+	if v, ok := opts.Value["body"]; ok {
+		body, _ = tengo.ToByteSlice(v)
+	}
+
+	canonical, err := CanonicalRequest(method, rawURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("crypto.sign_request: %w", err)
+	}
+	sig, err := HMACHex(str("algo", "sha256"), []byte(key), []byte(canonical))
+	if err != nil {
+		return nil, fmt.Errorf("crypto.sign_request: %w", err)
+	}
+
+	headers := map[string]tengo.Object{}
+	signedURL := rawURL
+	switch scheme := str("scheme", "query"); scheme {
+	case "query":
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("crypto.sign_request: %w", err)
+		}
+		query := u.Query()
+		query.Set(str("param", "signature"), sig)
+		u.RawQuery = query.Encode()
+		signedURL = u.String()
+	case "header":
+		headers[str("header", "X-Signature")] = &tengo.String{Value: sig}
+	case "authorization":
+		headers["Authorization"] = &tengo.String{Value: str("prefix", "HMAC") + " " + sig}
+	default:
+		return nil, fmt.Errorf("crypto.sign_request: unknown scheme '%s'", scheme)
+	}
+	return &tengo.ImmutableMap{Value: map[string]tengo.Object{
+		"url":       &tengo.String{Value: signedURL},
+		"headers":   &tengo.Map{Value: headers},
+		"signature": &tengo.String{Value: sig},
+		"canonical": &tengo.String{Value: canonical},
+	}}, nil
+}
@@ -0,0 +1,170 @@
+package extras
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/d5/tengo/v2"
+)
+
+// ErrDownloadsDisabled is returned by req.download when Config.DownloadDir is
+// not set.
+var ErrDownloadsDisabled = errors.New("downloads are disabled")
+
+// DownloadInfo describes the progress of a req.download, passed to
+// Config.OnDownload.
+type DownloadInfo struct {
+	URL string
+	// Path is the file written, relative to Config.DownloadDir.
+	Path string
+	// Written is the number of bytes written so far.
+	Written int64
+	// Total is the size announced by the server, or -1 when unknown.
+	Total int64
+	// Done is set on the last report of a download, successful or not.
+	Done bool
+	Err  error
+}
+
+// downloadProgressInterval is the least time between two progress reports
+// of a download before its last.
+const downloadProgressInterval = 250 * time.Millisecond
+
+// downloadFunc implements req.download(url, path[, options]): it GETs url and
+// writes the body to path inside Config.DownloadDir, e.g. for cover images.
+// It returns the response map without body, with the path and size written.
+func downloadFunc(inv *Invocation) *tengo.UserFunction {
+	const fn = "http.download"
+	return &tengo.UserFunction{
+		Name: "download",
+		Value: func(args ...tengo.Object) (tengo.Object, error) {
+			if len(args) < 2 || len(args) > 3 {
+				return nil, fmt.Errorf("%s: expected 2 or 3 arguments", fn)
+			}
+			urlStr, ok := args[0].(*tengo.String)
+			if !ok {
+				return nil, fmt.Errorf("%s: first argument must be a string", fn)
+			}
+			path, ok := args[1].(*tengo.String)
+			if !ok {
+				return nil, fmt.Errorf("%s: second argument must be a string", fn)
+			}
+			var optArg tengo.Object
+			if len(args) == 3 {
+				optArg = args[2]
+			}
+			opts, err := parseRequestOptions(fn, optArg, inv.Config)
+			if err != nil {
+				return nil, err
+			}
+			if inv.Config.DownloadDir == "" {
+				return nil, fmt.Errorf("%s: %w", fn, ErrDownloadsDisabled)
+			}
+			if !filepath.IsLocal(path.Value) {
+				return nil, fmt.Errorf("%s: path %q is outside of the download directory", fn, path.Value)
+			}
+			opts.stream = true
+			res, err := inv.send(fn, http.MethodGet, urlStr.Value, opts)
+			if err != nil {
+				return nil, err
+			}
+			m := res.(*tengo.Map)
+			body, err := m.Value["stream"].(*ankoResponseBody).take()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fn, err)
+			}
+			defer body.Close()
+			delete(m.Value, "stream")
+			if status := m.Value["status"].(*tengo.Int).Value; status < 200 || status > 299 {
+				return nil, fmt.Errorf("%s: %s: status %d", fn, urlStr.Value, status)
+			}
+			total := int64(-1)
+			if h, ok := m.Value["headers"].(*tengo.Map); ok {
+				if v, ok := h.Value["Content-Length"].(*tengo.Array); ok && len(v.Value) > 0 {
+					if n, err := strconv.ParseInt(v.Value[0].(*tengo.String).Value, 10, 64); err == nil {
+						total = n
+					}
+				}
+			}
+			info := DownloadInfo{URL: urlStr.Value, Path: filepath.ToSlash(filepath.Clean(path.Value)), Total: total}
+			written, err := inv.writeDownload(body, path.Value, info)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fn, err)
+			}
+			m.Value["path"] = &tengo.String{Value: info.Path}
+			m.Value["size"] = &tengo.Int{Value: written}
+			return m, nil
+		},
+	}
+}
+
+// writeDownload copies body to path inside Config.DownloadDir, creating its
+// directories, and reports the progress to Config.OnDownload. A partial file
+// is removed. The directory is opened as an os.Root, so symbolic links cannot
+// lead outside of it either.
+func (inv *Invocation) writeDownload(body io.Reader, path string, info DownloadInfo) (written int64, err error) {
+	root, err := os.OpenRoot(inv.Config.DownloadDir)
+	if err != nil {
+		return 0, err
+	}
+	defer root.Close()
+	defer func() {
+		info.Written, info.Done, info.Err = written, true, err
+		inv.reportDownload(info)
+	}()
+	dir := filepath.Dir(filepath.Clean(path))
+	if dir != "." {
+		var parent string
+		for _, elem := range strings.Split(dir, string(filepath.Separator)) {
+			parent = filepath.Join(parent, elem)
+			if err := root.Mkdir(parent, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+				return 0, err
+			}
+		}
+	}
+	f, err := root.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	w := &progressWriter{inv: inv, info: info}
+	written, err = io.Copy(f, io.TeeReader(body, w))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		root.Remove(path)
+	}
+	return written, err
+}
+
+// reportDownload passes info to Config.OnDownload and the logger.
+func (inv *Invocation) reportDownload(info DownloadInfo) {
+	inv.Logger.Debug("http.download: progress", "url", info.URL, "path", info.Path, "written", info.Written, "total", info.Total, "done", info.Done)
+	if observe := inv.Config.OnDownload; observe != nil {
+		observe(info)
+	}
+}
+
+// progressWriter counts the bytes of a download, reporting them at most every
+// downloadProgressInterval.
+type progressWriter struct {
+	inv  *Invocation
+	info DownloadInfo
+	last time.Time
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.info.Written += int64(len(p))
+	if now := time.Now(); now.Sub(w.last) >= downloadProgressInterval {
+		w.last = now
+		w.inv.reportDownload(w.info)
+	}
+	return len(p), nil
+}
@@ -2,11 +2,20 @@
 package extras
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"net/http"
 	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/d5/tengo/v2"
 	"github.com/d5/tengo/v2/stdlib"
+	req "github.com/imroc/req/v3"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ToSet converts a slice of strings into a set.
@@ -27,28 +36,252 @@ func AllExtraModuleNames() []string {
 	return names
 }
 
+// Config carries engine-level settings into the extra modules.
+type Config struct {
+	// HTTPTimeout is the default timeout of req module requests; zero means none.
+	HTTPTimeout time.Duration
+	// Protocol selects the HTTP protocol of the req client: "http1", "http2",
+	// "http3" or "" for the impersonation default.
+	Protocol string
+	// Impersonate selects the browser whose TLS and HTTP fingerprint and
+	// default headers clients built with NewClient mimic: "chrome" (the
+	// default when empty), "firefox", "safari" or "none".
+	Impersonate string
+	// UserAgent, when set, replaces the User-Agent of the impersonated
+	// browser.
+	UserAgent string
+	// RandomIdentity makes the host give every invocation a random Identity
+	// (see RandomIdentity).
+	RandomIdentity bool
+	// Identity, when set, is the client identity of the invocation's req
+	// module requests.
+	Identity *Identity
+	// Headers are sent with every request of clients built with NewClient,
+	// replacing the impersonated browser's headers of the same name.
+	// Request headers set by scripts take precedence.
+	Headers map[string]string
+	// Proxy, when set, is the URL of the proxy clients built with NewClient
+	// send their requests through, e.g. "http://proxy:8080" or
+	// "socks5://127.0.0.1:1080".
+	Proxy string
+	// MaxRedirects limits the redirects clients built with NewClient follow
+	// per request; zero keeps the default of 10 and a negative value follows
+	// none. Scripts override it per request with the max_redirects and
+	// no_follow options.
+	MaxRedirects int
+	// Client is the session client shared by the req module across
+	// invocations. When nil, each invocation gets its own client built with
+	// NewClient, and with it its own cookie jar.
+	Client *req.Client
+	// Jar, when set, is the cookie jar of clients built with NewClient and
+	// of the cookies module, so cookies outlive the client. When nil, each
+	// invocation gets a jar of its own.
+	Jar *CookieJar
+	// Credentials, when set, are the user's credentials at the source,
+	// which scripts read with req.credentials.
+	Credentials *Credentials
+	// Signer, when set, signs every request of clients built with NewClient.
+	Signer Signer
+	// Transport, when set, carries the requests of clients built with
+	// NewClient instead of the network, e.g. a mock in unit tests or an
+	// application's own transport. The host allowlist, recorder and signer
+	// still apply.
+	Transport http.RoundTripper
+	// Recorder, when set, records and replays the responses to requests of
+	// clients built with NewClient.
+	Recorder *Recorder
+	// OnRequest, when set, is called after every request attempt of the req
+	// module, e.g. for metrics.
+	OnRequest func(RequestInfo)
+	// DownloadDir is the directory req.download writes files to; paths
+	// outside of it are refused. When empty, downloads are disabled.
+	DownloadDir string
+	// OnDownload, when set, is called with the progress of every
+	// req.download, ending with a report with Done set.
+	OnDownload func(DownloadInfo)
+	// AllowedHosts, when non-empty, makes clients built with NewClient refuse
+	// requests, including redirects, to hosts other than these and their
+	// subdomains.
+	AllowedHosts []string
+	// Retry is the retry policy of req module requests, which scripts can
+	// override per request; zero fields take DefaultRetryPolicy's values.
+	Retry RetryPolicy
+	// Solver, when set, solves the anti-bot challenges answering req module
+	// GETs.
+	Solver *ChallengeSolver
+	// Browser, when set, renders the pages of the browser module. It is
+	// shared by all invocations.
+	Browser *Browser
+	// RateLimit, when set, spaces the requests of the req module to each
+	// host. It is shared by all invocations.
+	RateLimit *RateLimiter
+	// MaxRequests, when positive, limits the request attempts of the req
+	// module in a single invocation.
+	MaxRequests int
+	// Now, when set, is the clock of anko.now and times.now, e.g. a fixed
+	// time making date-dependent rules deterministic in tests.
+	Now func() time.Time
+	// MemoizeGets makes the req module answer a GET repeated within an
+	// invocation, with the same headers and options, from the response of
+	// the first one instead of sending it again. Only successful (2xx)
+	// responses are reused, never streamed ones.
+	MemoizeGets bool
+	// Tracer, when set, records a client span for every request attempt of
+	// the req module, as a child of the invocation context's span.
+	Tracer trace.Tracer
+}
+
+// Invocation is the state of a single invocation of the extra modules, e.g.
+// one rule run. All modules of the invocation are built from it, so state
+// scoped to the run, such as its HTTP session, request budget and the GETs it
+// has sent, lives here instead of in the module factories.
+type Invocation struct {
+	// Context is the invocation context: modules abandon in-flight I/O and
+	// sleeps once it is done.
+	Context context.Context
+	Logger  *slog.Logger
+	Config  Config
+	// Session is the req module client of the invocation: Config.Client or
+	// a client of its own, e.g. after req.set_impersonate.
+	Session *req.Client
+
+	requests   atomic.Int64
+	lastStatus atomic.Int64
+	challenged atomic.Bool
+	sessionMu  sync.Mutex
+
+	mu   sync.Mutex
+	auth *requestAuth
+	gets map[string]int
+	memo map[string]tengo.Object
+}
+
+// NewInvocation creates the invocation state for modules bound to ctx. A nil
+// ctx means context.Background and a nil logger slog.Default.
+func NewInvocation(ctx context.Context, logger *slog.Logger, cfg Config) *Invocation {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Invocation{Context: ctx, Logger: logger, Config: cfg}
+}
+
+// session returns inv.Session, creating it on first use.
+func (inv *Invocation) session() *req.Client {
+	inv.sessionMu.Lock()
+	defer inv.sessionMu.Unlock()
+	if inv.Session == nil {
+		inv.Session = inv.Config.Client
+	}
+	if inv.Session == nil {
+		cfg := inv.Config
+		cfg.Jar = inv.jar()
+		inv.Session = NewClient(cfg)
+	}
+	return inv.Session
+}
+
+// impersonate replaces the session of the invocation with a client built
+// with NewClient from its Config, impersonating profile instead. The cookie
+// jar is kept.
+func (inv *Invocation) impersonate(profile string) {
+	cfg := inv.Config
+	cfg.Impersonate = profile
+	cfg.Jar = inv.jar()
+	client := NewClient(cfg)
+	inv.sessionMu.Lock()
+	defer inv.sessionMu.Unlock()
+	inv.Session = client
+}
+
+// jar returns the cookie jar of the invocation: Config.Jar or a jar of its
+// own.
+func (inv *Invocation) jar() *CookieJar {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if inv.Config.Jar == nil {
+		inv.Config.Jar = NewCookieJar()
+	}
+	return inv.Config.Jar
+}
+
+// now returns the current time of the invocation's clock.
+func (inv *Invocation) now() time.Time {
+	if inv.Config.Now != nil {
+		return inv.Config.Now()
+	}
+	return time.Now()
+}
+
+// ErrRequestLimit is returned for req module requests beyond
+// Config.MaxRequests.
+var ErrRequestLimit = errors.New("request limit exceeded")
+
+// takeRequest counts a request attempt against the invocation's budget.
+func (inv *Invocation) takeRequest() error {
+	if n := inv.requests.Add(1); inv.Config.MaxRequests > 0 && n > int64(inv.Config.MaxRequests) {
+		return fmt.Errorf("%w: more than %d requests", ErrRequestLimit, inv.Config.MaxRequests)
+	}
+	return nil
+}
+
+// LastStatus returns the status of the latest response to a req module
+// request of the invocation, or zero when none arrived.
+func (inv *Invocation) LastStatus() int {
+	return int(inv.lastStatus.Load())
+}
+
+// Challenged reports whether the latest response to a req module request of
+// the invocation was an anti-bot challenge page left unsolved.
+func (inv *Invocation) Challenged() bool {
+	return inv.challenged.Load()
+}
+
+// noteResponse records the latest response of the invocation for LastStatus
+// and Challenged.
+func (inv *Invocation) noteResponse(status int, challenged bool) {
+	inv.lastStatus.Store(int64(status))
+	inv.challenged.Store(challenged)
+}
+
+// ModuleFunc builds the attribute map of an extra module for an invocation.
+type ModuleFunc func(inv *Invocation) map[string]tengo.Object
+
 // ExtraModules maps extra module names to functions that produce their attribute maps.
-var ExtraModules = map[string]func(*slog.Logger) map[string]tengo.Object{
-	"log":  logModule,
-	"req":  reqModule,
-	"html": htmlModule,
-	"anko": miscModule,
+// Modules with heavy dependencies register themselves unless they are
+// compiled out with their build tag.
+var ExtraModules = map[string]ModuleFunc{
+	"log":     logModule,
+	"req":     reqModule,
+	"html":    htmlModule,
+	"anko":    miscModule,
+	"crypto":  cryptoModule,
+	"archive": archiveModule,
+	"cookies": cookiesModule,
+	"strutil": strutilModule,
 }
 
-// GetExtraModuleMap creates a ModuleMap for the given extra module names using the provided logger.
-func GetExtraModuleMap(logger *slog.Logger, names ...string) *tengo.ModuleMap {
+// UnavailableModules maps the extra modules compiled out of this build to a
+// hint on how to enable them.
+var UnavailableModules = map[string]string{}
+
+// GetExtraModuleMap creates a ModuleMap for the given extra module names
+// built for the invocation inv.
+func GetExtraModuleMap(inv *Invocation, names ...string) *tengo.ModuleMap {
 	modules := tengo.NewModuleMap()
 	for _, name := range names {
 		if fn, ok := ExtraModules[name]; ok {
-			modules.AddBuiltinModule(name, fn(logger))
+			modules.AddBuiltinModule(name, fn(inv))
 		}
 	}
 	return modules
 }
 
 // GetCustomModuleMap returns a ModuleMap that includes standard modules (from stdlib)
-// plus extra modules (only those declared).
-func GetCustomModuleMap(allowedModules []string, logger *slog.Logger) *tengo.ModuleMap {
+// plus extra modules (only those declared), built for the invocation inv.
+func GetCustomModuleMap(inv *Invocation, allowedModules []string) *tengo.ModuleMap {
 	moduleMap := stdlib.GetModuleMap(allowedModules...)
 	var extras []string
 	for _, mod := range allowedModules {
@@ -56,7 +289,83 @@ func GetCustomModuleMap(allowedModules []string, logger *slog.Logger) *tengo.Mod
 			extras = append(extras, mod)
 		}
 	}
-	extraMap := GetExtraModuleMap(logger, extras...)
+	extraMap := GetExtraModuleMap(inv, extras...)
 	moduleMap.AddMap(extraMap)
+	if moduleMap.Get("times") != nil {
+		moduleMap.AddBuiltinModule("times", timesModule(inv))
+	}
 	return moduleMap
 }
+
+// IsContextModule reports whether the module name depends on the invocation
+// context: the extra modules and times, whose sleep is cancellable.
+func IsContextModule(name string) bool {
+	_, ok := ExtraModules[name]
+	return ok || name == "times"
+}
+
+// ModuleObjects returns the context modules among names (see
+// IsContextModule) built for inv, as the values import would return for them.
+// They let a host swap the modules of a compiled script for every run by
+// passing them as globals.
+func ModuleObjects(inv *Invocation, names []string) map[string]tengo.Object {
+	out := make(map[string]tengo.Object)
+	for _, name := range names {
+		var attrs map[string]tengo.Object
+		if fn, ok := ExtraModules[name]; ok {
+			attrs = fn(inv)
+		} else if name == "times" {
+			attrs = timesModule(inv)
+		} else {
+			continue
+		}
+		out[name] = (&tengo.BuiltinModule{Attrs: attrs}).AsImmutableMap(name)
+	}
+	return out
+}
+
+// timesModule is the stdlib times module with a sleep that returns an error
+// as soon as the invocation context is done and, with Config.Now set, a now
+// reading that clock.
+func timesModule(inv *Invocation) map[string]tengo.Object {
+	ctx := inv.Context
+	attrs := make(map[string]tengo.Object, len(stdlib.BuiltinModules["times"]))
+	for k, v := range stdlib.BuiltinModules["times"] {
+		attrs[k] = v
+	}
+	attrs["sleep"] = &tengo.UserFunction{
+		Name: "sleep",
+		Value: func(args ...tengo.Object) (tengo.Object, error) {
+			if len(args) != 1 {
+				return nil, tengo.ErrWrongNumArguments
+			}
+			d, ok := tengo.ToInt64(args[0])
+			if !ok {
+				return nil, tengo.ErrInvalidArgumentType{Name: "first", Expected: "int(compatible)", Found: args[0].TypeName()}
+			}
+			timer := time.NewTimer(time.Duration(d))
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				return tengo.UndefinedValue, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		},
+	}
+	if inv.Config.Now != nil {
+		attrs["now"] = &tengo.UserFunction{Name: "now", Value: nowFunc(inv)}
+	}
+	return attrs
+}
+
+// nowFunc implements anko.now and times.now: it returns the time of the
+// invocation's clock.
+func nowFunc(inv *Invocation) tengo.CallableFunc {
+	return func(args ...tengo.Object) (tengo.Object, error) {
+		if len(args) != 0 {
+			return nil, tengo.ErrWrongNumArguments
+		}
+		return &tengo.Time{Value: inv.now()}, nil
+	}
+}
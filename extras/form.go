@@ -0,0 +1,209 @@
+package extras
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/d5/tengo/v2"
+)
+
+// postFormFunc implements req.post_form(url, fields[, headers[, options]]):
+// it POSTs fields URL-encoded as application/x-www-form-urlencoded. Field
+// values are strings or other scalars; an array value sends the field once
+// per element.
+func postFormFunc(inv *Invocation) *tengo.UserFunction {
+	const fn = "http.post_form"
+	return &tengo.UserFunction{
+		Name: "post_form",
+		Value: func(args ...tengo.Object) (tengo.Object, error) {
+			if len(args) < 2 || len(args) > 4 {
+				return nil, fmt.Errorf("%s: expected 2 to 4 arguments", fn)
+			}
+			urlStr, ok := args[0].(*tengo.String)
+			if !ok {
+				return nil, fmt.Errorf("%s: first argument must be a string", fn)
+			}
+			fields, err := formFields(args[1])
+			if err != nil {
+				return nil, fmt.Errorf("%s: second argument %w", fn, err)
+			}
+			opts, err := headersAndOptions(fn, args[2:], "third", inv.Config)
+			if err != nil {
+				return nil, err
+			}
+			opts.body = []byte(fields.Encode())
+			setContentType(opts.headers, "application/x-www-form-urlencoded")
+			return inv.send(fn, http.MethodPost, urlStr.Value, opts)
+		},
+	}
+}
+
+// postMultipartFunc implements req.post_multipart(url, fields, files[,
+// headers[, options]]): it POSTs fields and files as multipart/form-data.
+// fields are as for post_form. A file is its content, a string or bytes,
+// sent with the field name as file name, or a map {content, filename,
+// content_type}, where content_type defaults to application/octet-stream.
+func postMultipartFunc(inv *Invocation) *tengo.UserFunction {
+	const fn = "http.post_multipart"
+	return &tengo.UserFunction{
+		Name: "post_multipart",
+		Value: func(args ...tengo.Object) (tengo.Object, error) {
+			if len(args) < 3 || len(args) > 5 {
+				return nil, fmt.Errorf("%s: expected 3 to 5 arguments", fn)
+			}
+			urlStr, ok := args[0].(*tengo.String)
+			if !ok {
+				return nil, fmt.Errorf("%s: first argument must be a string", fn)
+			}
+			fields, err := formFields(args[1])
+			if err != nil {
+				return nil, fmt.Errorf("%s: second argument %w", fn, err)
+			}
+			opts, err := headersAndOptions(fn, args[3:], "fourth", inv.Config)
+			if err != nil {
+				return nil, err
+			}
+			body, ct, err := multipartBody(fields, args[2])
+			if err != nil {
+				return nil, fmt.Errorf("%s: third argument %w", fn, err)
+			}
+			opts.body = body
+			setContentType(opts.headers, ct)
+			return inv.send(fn, http.MethodPost, urlStr.Value, opts)
+		},
+	}
+}
+
+// headersAndOptions reads the trailing ([headers[, options]]) arguments of
+// fn, the first of which is the pos argument.
+func headersAndOptions(fn string, args []tengo.Object, pos string, cfg Config) (requestOptions, error) {
+	var optArg tengo.Object
+	if len(args) == 2 {
+		optArg = args[1]
+	}
+	opts, err := parseRequestOptions(fn, optArg, cfg)
+	if err != nil {
+		return opts, err
+	}
+	if len(args) >= 1 {
+		hdrMap, ok := args[0].(*tengo.Map)
+		if !ok {
+			return opts, fmt.Errorf("%s: %s argument must be a map", fn, pos)
+		}
+		for k, v := range hdrMap.Value {
+			opts.headers[k] = strings.Trim(v.String(), `"`)
+		}
+	}
+	return opts, nil
+}
+
+// setContentType sets the Content-Type of headers to ct, replacing one set
+// by the script under any case.
+func setContentType(headers map[string]string, ct string) {
+	for k := range headers {
+		if strings.EqualFold(k, "Content-Type") {
+			delete(headers, k)
+		}
+	}
+	headers["Content-Type"] = ct
+}
+
+// formFields converts a map of form fields to url.Values.
+func formFields(obj tengo.Object) (url.Values, error) {
+	m, ok := scriptMap(obj)
+	if !ok {
+		return nil, errors.New("must be a map")
+	}
+	values := make(url.Values, len(m))
+	for k, v := range m {
+		var items []tengo.Object
+		switch arr := v.(type) {
+		case *tengo.Array:
+			items = arr.Value
+		case *tengo.ImmutableArray:
+			items = arr.Value
+		default:
+			items = []tengo.Object{v}
+		}
+		for _, item := range items {
+			s, ok := tengo.ToString(item)
+			if !ok || item == tengo.UndefinedValue {
+				return nil, fmt.Errorf("field '%s' must be a string or a scalar", k)
+			}
+			values.Add(k, s)
+		}
+	}
+	return values, nil
+}
+
+// scriptMap returns the entries of a Tengo map or immutable map.
+func scriptMap(obj tengo.Object) (map[string]tengo.Object, bool) {
+	switch m := obj.(type) {
+	case *tengo.Map:
+		return m.Value, true
+	case *tengo.ImmutableMap:
+		return m.Value, true
+	}
+	return nil, false
+}
+
+// quoteEscaper escapes the names in a Content-Disposition header, as
+// mime/multipart does.
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// multipartBody encodes fields and the files map as a multipart/form-data
+// body, in key order, and returns it with its content type.
+func multipartBody(fields url.Values, filesObj tengo.Object) ([]byte, string, error) {
+	files, ok := scriptMap(filesObj)
+	if !ok {
+		return nil, "", errors.New("must be a map")
+	}
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for _, k := range slices.Sorted(maps.Keys(fields)) {
+		for _, v := range fields[k] {
+			w.WriteField(k, v)
+		}
+	}
+	for _, k := range slices.Sorted(maps.Keys(files)) {
+		content, filename, ct := files[k], k, "application/octet-stream"
+		if m, ok := scriptMap(content); ok {
+			content = m["content"]
+			if s, ok := m["filename"].(*tengo.String); ok {
+				filename = s.Value
+			}
+			if s, ok := m["content_type"].(*tengo.String); ok {
+				ct = s.Value
+			}
+		}
+		var data []byte
+		switch v := content.(type) {
+		case *tengo.String:
+			data = []byte(v.Value)
+		case *tengo.Bytes:
+			data = v.Value
+		default:
+			return nil, "", fmt.Errorf("file '%s' must be a string, bytes or a map with content", k)
+		}
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quoteEscaper.Replace(k), quoteEscaper.Replace(filename)))
+		h.Set("Content-Type", ct)
+		part, err := w.CreatePart(h)
+		if err != nil {
+			return nil, "", err
+		}
+		part.Write(data)
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), w.FormDataContentType(), nil
+}
@@ -1,13 +1,15 @@
 package extras
 
 import (
+	"bytes"
 	"fmt"
-	"log/slog"
+	"io"
 	"strings"
 
 	"github.com/antchfx/htmlquery"
 	"github.com/d5/tengo/v2"
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
 )
 
 // ankoHtmlNode wraps an *html.Node for Tengo.
@@ -47,7 +49,8 @@ func (node *ankoHtmlNode) IndexGet(index tengo.Object) (tengo.Object, error) {
 	return tengo.UndefinedValue, nil
 }
 
-func htmlModule(logger *slog.Logger) map[string]tengo.Object {
+func htmlModule(inv *Invocation) map[string]tengo.Object {
+	logger := inv.Logger
 	return map[string]tengo.Object{
 		"parse": &tengo.UserFunction{
 			Name: "parse",
@@ -66,6 +69,43 @@ func htmlModule(logger *slog.Logger) map[string]tengo.Object {
 				return &ankoHtmlNode{Value: doc}, nil
 			},
 		},
+		"parse_response": &tengo.UserFunction{
+			Name: "parse_response",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 1 {
+					return nil, fmt.Errorf("html.parse_response: expected 1 argument")
+				}
+				resp, ok := args[0].(*tengo.Map)
+				if !ok {
+					return nil, fmt.Errorf("html.parse_response: argument must be a response map")
+				}
+				var r io.Reader
+				if stream, ok := resp.Value["stream"].(*ankoResponseBody); ok {
+					body, err := stream.take()
+					if err != nil {
+						return nil, fmt.Errorf("html.parse_response: %w", err)
+					}
+					defer body.Close()
+					if r, err = charset.NewReader(body, responseContentType(resp)); err != nil {
+						return nil, fmt.Errorf("html.parse_response: %w", err)
+					}
+				} else if body, ok := resp.Value["body"].(*tengo.String); ok {
+					r = strings.NewReader(body.Value)
+				} else if body, ok := resp.Value["body"].(*tengo.Bytes); ok {
+					var err error
+					if r, err = charset.NewReader(bytes.NewReader(body.Value), responseContentType(resp)); err != nil {
+						return nil, fmt.Errorf("html.parse_response: %w", err)
+					}
+				} else {
+					return nil, fmt.Errorf("html.parse_response: response has neither stream nor body")
+				}
+				doc, err := htmlquery.Parse(r)
+				if err != nil {
+					return nil, fmt.Errorf("html.parse_response: %w", err)
+				}
+				return &ankoHtmlNode{Value: doc}, nil
+			},
+		},
 		"serialize": &tengo.UserFunction{
 			Name: "serialize",
 			Value: func(args ...tengo.Object) (tengo.Object, error) {
@@ -155,6 +195,34 @@ func htmlModule(logger *slog.Logger) map[string]tengo.Object {
 				return &tengo.Array{Value: arr}, nil
 			},
 		},
+		"first_match": &tengo.UserFunction{
+			Name: "first_match",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				node, _, err := firstMatch("html.first_match", args, false)
+				if err != nil {
+					return tengo.UndefinedValue, err
+				}
+				if node == nil {
+					logger.Warn("Runtime", "func", "html.first_match", "message", "none of the provided XPaths matched")
+					return tengo.UndefinedValue, nil
+				}
+				return &ankoHtmlNode{Value: node}, nil
+			},
+		},
+		"first_match_text": &tengo.UserFunction{
+			Name: "first_match_text",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				node, text, err := firstMatch("html.first_match_text", args, true)
+				if err != nil {
+					return tengo.UndefinedValue, err
+				}
+				if node == nil {
+					logger.Warn("Runtime", "func", "html.first_match_text", "message", "none of the provided XPaths matched")
+					return tengo.UndefinedValue, nil
+				}
+				return &tengo.String{Value: text}, nil
+			},
+		},
 		"attr": &tengo.UserFunction{
 			Name: "attr",
 			Value: func(args ...tengo.Object) (tengo.Object, error) {
@@ -194,3 +262,51 @@ func htmlModule(logger *slog.Logger) map[string]tengo.Object {
 		},
 	}
 }
+
+// firstMatch implements html.first_match and html.first_match_text: it tries
+// the XPath expressions of args[1] in order against the node args[0] and
+// returns the first match, or nil when none matches. With text set, matches
+// whose inner text is blank are skipped and the text is returned as well.
+// This encodes the usual "try the new layout, fall back to the old one"
+// pattern of long-lived sources.
+func firstMatch(fn string, args []tengo.Object, text bool) (*html.Node, string, error) {
+	if len(args) != 2 {
+		return nil, "", fmt.Errorf("%s: expected 2 arguments", fn)
+	}
+	doc, ok := args[0].(*ankoHtmlNode)
+	if !ok {
+		return nil, "", fmt.Errorf("%s: first argument must be an html-node", fn)
+	}
+	if doc.Value == nil {
+		return nil, "", fmt.Errorf("%s: cannot search within a nil node", fn)
+	}
+	var xpaths []tengo.Object
+	switch arr := args[1].(type) {
+	case *tengo.Array:
+		xpaths = arr.Value
+	case *tengo.ImmutableArray:
+		xpaths = arr.Value
+	default:
+		return nil, "", fmt.Errorf("%s: second argument must be an array of strings", fn)
+	}
+	for _, obj := range xpaths {
+		xpath, ok := obj.(*tengo.String)
+		if !ok {
+			return nil, "", fmt.Errorf("%s: second argument must be an array of strings", fn)
+		}
+		node, err := htmlquery.Query(doc.Value, xpath.Value)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", fn, err)
+		}
+		if node == nil {
+			continue
+		}
+		if !text {
+			return node, "", nil
+		}
+		if t := htmlquery.InnerText(node); strings.TrimSpace(t) != "" {
+			return node, t, nil
+		}
+	}
+	return nil, "", nil
+}
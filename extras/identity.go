@@ -0,0 +1,103 @@
+package extras
+
+import (
+	"hash/fnv"
+	"math/rand/v2"
+
+	"github.com/d5/tengo/v2"
+)
+
+// Identity is the client identity a run presents to sites when
+// Config.RandomIdentity is set: its User-Agent and Accept-Language are sent
+// with every req module request unless the script sets them, and the
+// viewport is a hint for rendering pages, available to scripts with
+// req.identity.
+type Identity struct {
+	UserAgent      string
+	AcceptLanguage string
+	ViewportWidth  int
+	ViewportHeight int
+}
+
+// identityUserAgents are the User-Agents RandomIdentity picks from, per
+// browser family, so they match the impersonated TLS fingerprint.
+var identityUserAgents = map[string][]string{
+	"chrome": {
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+	},
+	"firefox": {
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:120.0) Gecko/20100101 Firefox/120.0",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:119.0) Gecko/20100101 Firefox/119.0",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:120.0) Gecko/20100101 Firefox/120.0",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0",
+	},
+	"safari": {
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Safari/605.1.15",
+	},
+}
+
+var identityLanguages = []string{
+	"en-US,en;q=0.9",
+	"en-GB,en;q=0.9",
+	"en-US,en;q=0.8",
+	"en-US,en;q=0.9,de;q=0.7",
+	"en-US,en;q=0.9,fr;q=0.8",
+}
+
+var identityViewports = [][2]int{
+	{1920, 1080}, {1536, 864}, {1440, 900}, {1366, 768}, {1280, 720}, {2560, 1440},
+}
+
+// RandomIdentity returns an identity of the browser family of the
+// impersonation profile, Chrome for "" and "none". Identities drawn with the
+// same non-empty seed are equal, so runs for the same novel look like the
+// same visitor; an empty seed draws a new identity every call.
+func RandomIdentity(profile, seed string) Identity {
+	agents, ok := identityUserAgents[profile]
+	if !ok {
+		agents = identityUserAgents["chrome"]
+	}
+	var rng *rand.Rand
+	if seed == "" {
+		rng = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	} else {
+		h := fnv.New64a()
+		h.Write([]byte(seed))
+		rng = rand.New(rand.NewPCG(h.Sum64(), 0))
+	}
+	viewport := identityViewports[rng.IntN(len(identityViewports))]
+	return Identity{
+		UserAgent:      agents[rng.IntN(len(agents))],
+		AcceptLanguage: identityLanguages[rng.IntN(len(identityLanguages))],
+		ViewportWidth:  viewport[0],
+		ViewportHeight: viewport[1],
+	}
+}
+
+// identityFunc implements req.identity(): it returns the identity of the
+// run as a map, or undefined when identities are not randomized.
+func identityFunc(inv *Invocation) *tengo.UserFunction {
+	return &tengo.UserFunction{
+		Name: "identity",
+		Value: func(args ...tengo.Object) (tengo.Object, error) {
+			if len(args) != 0 {
+				return nil, tengo.ErrWrongNumArguments
+			}
+			id := inv.Config.Identity
+			if id == nil {
+				return tengo.UndefinedValue, nil
+			}
+			return &tengo.ImmutableMap{Value: map[string]tengo.Object{
+				"user_agent":      &tengo.String{Value: id.UserAgent},
+				"accept_language": &tengo.String{Value: id.AcceptLanguage},
+				"viewport_width":  &tengo.Int{Value: int64(id.ViewportWidth)},
+				"viewport_height": &tengo.Int{Value: int64(id.ViewportHeight)},
+			}}, nil
+		},
+	}
+}
@@ -2,13 +2,13 @@ package extras
 
 import (
 	"errors"
-	"log/slog"
 
 	"github.com/d5/tengo/v2"
 )
 
 // logModule creates a custom Tengo log module.
-func logModule(logger *slog.Logger) map[string]tengo.Object {
+func logModule(inv *Invocation) map[string]tengo.Object {
+	logger := inv.Logger
 	return map[string]tengo.Object{
 		"debug": &tengo.UserFunction{
 			Name: "debug",
@@ -2,7 +2,7 @@ package extras
 
 import (
 	"fmt"
-	"log/slog"
+	"net"
 	"net/url"
 	"regexp"
 	"sort"
@@ -12,8 +12,12 @@ import (
 )
 
 // miscModule implements the novel module.
-func miscModule(logger *slog.Logger) map[string]tengo.Object {
+func miscModule(inv *Invocation) map[string]tengo.Object {
 	return map[string]tengo.Object{
+		"now": &tengo.UserFunction{
+			Name:  "now",
+			Value: nowFunc(inv),
+		},
 		"title_clean": &tengo.UserFunction{
 			Name: "title_clean",
 			Value: func(args ...tengo.Object) (tengo.Object, error) {
@@ -89,6 +93,23 @@ func miscModule(logger *slog.Logger) map[string]tengo.Object {
 				return &tengo.String{Value: absURL.String()}, nil
 			},
 		},
+		"canonical_url": &tengo.UserFunction{
+			Name: "canonical_url",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 1 {
+					return nil, fmt.Errorf("novel.canonical_url: expected 1 argument")
+				}
+				urlStr, ok := args[0].(*tengo.String)
+				if !ok {
+					return nil, fmt.Errorf("novel.canonical_url: argument must be a string")
+				}
+				canonical, err := CanonicalURL(urlStr.Value)
+				if err != nil {
+					return nil, fmt.Errorf("novel.canonical_url: %w", err)
+				}
+				return &tengo.String{Value: canonical}, nil
+			},
+		},
 		"is_chapter_url": &tengo.UserFunction{
 			Name: "is_chapter_url",
 			Value: func(args ...tengo.Object) (tengo.Object, error) {
@@ -173,3 +194,41 @@ func miscModule(logger *slog.Logger) map[string]tengo.Object {
 		},
 	}
 }
+
+// trackingParams lists query parameters that never affect the page content.
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "dclid": true, "msclkid": true,
+	"yclid": true, "igshid": true, "mc_cid": true, "mc_eid": true,
+	"_ga": true, "_gl": true,
+}
+
+// CanonicalURL normalizes a URL so equivalent links compare equal: the scheme
+// and host are lowercased, default ports and fragments are dropped, tracking
+// parameters are stripped and the remaining query is sorted by key.
+func CanonicalURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	u.Host = host
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Host != "" && u.Path == "" {
+		u.Path = "/"
+	}
+	q := u.Query()
+	for key := range q {
+		if strings.HasPrefix(strings.ToLower(key), "utm_") || trackingParams[strings.ToLower(key)] {
+			q.Del(key)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
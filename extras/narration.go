@@ -0,0 +1,167 @@
+package extras
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// bracketedNote matches notes a narrator should skip: anything in square or
+// lenticular brackets, such as footnote markers and system messages, and
+// translator or editor notes in parentheses.
+var bracketedNote = regexp.MustCompile(`\[[^\]]*\]|【[^】]*】|〔[^〕]*〕|\((?i:TL|T/N|TN|ED|E/N|Note|Translator)\b[^)]*\)`)
+
+// number matches integers, with optional thousands separators, decimals and
+// English ordinal suffixes.
+var number = regexp.MustCompile(`\b\d{1,3}(?:,\d{3})+(?:\.\d+)?\b|\b\d+(?:\.\d+)?(?:st|nd|rd|th)?\b`)
+
+// NarrationText returns the text of the HTML fragment src prepared for a
+// text-to-speech engine: markup and bracketed notes are removed and numbers
+// are spelled out in English, so "Chapter 21 [TL: pun]" is read as
+// "Chapter twenty-one". Paragraphs are separated by blank lines.
+func NarrationText(src string) (string, error) {
+	text, err := HTMLToText(src)
+	if err != nil {
+		return "", err
+	}
+	paragraphs := strings.Split(text, "\n\n")
+	out := paragraphs[:0]
+	for _, p := range paragraphs {
+		if p = narrate(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, "\n\n"), nil
+}
+
+// NarrationSSML returns NarrationText of src as an SSML document, one p
+// element per paragraph and a break for every line break within one.
+func NarrationSSML(src string) (string, error) {
+	text, err := NarrationText(src)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString("<speak>")
+	for _, p := range strings.Split(text, "\n\n") {
+		if p == "" {
+			continue
+		}
+		lines := strings.Split(p, "\n")
+		for i, line := range lines {
+			lines[i] = html.EscapeString(line)
+		}
+		b.WriteString("<p>" + strings.Join(lines, `<break strength="medium"/>`) + "</p>")
+	}
+	b.WriteString("</speak>")
+	return b.String(), nil
+}
+
+// narrate removes the notes of a paragraph and spells out its numbers.
+func narrate(p string) string {
+	p = bracketedNote.ReplaceAllString(p, "")
+	p = number.ReplaceAllStringFunc(p, spellNumber)
+	lines := strings.Split(p, "\n")
+	out := lines[:0]
+	for _, line := range lines {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			out = append(out, line)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// spellNumber spells out a number matched by the number expression. Numbers
+// too large to read naturally are returned unchanged.
+func spellNumber(s string) string {
+	digits := strings.ReplaceAll(s, ",", "")
+	ordinal := false
+	for _, sfx := range []string{"st", "nd", "rd", "th"} {
+		if trimmed, ok := strings.CutSuffix(digits, sfx); ok {
+			digits, ordinal = trimmed, true
+			break
+		}
+	}
+	whole, frac, _ := strings.Cut(digits, ".")
+	n, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || n >= 1e15 {
+		return s
+	}
+	words := numberWords(n)
+	if ordinal && frac == "" {
+		return ordinalWords(words)
+	}
+	if frac != "" {
+		words += " point"
+		for _, d := range frac {
+			words += " " + smallNumbers[d-'0']
+		}
+	}
+	return words
+}
+
+var smallNumbers = []string{
+	"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine",
+	"ten", "eleven", "twelve", "thirteen", "fourteen", "fifteen", "sixteen",
+	"seventeen", "eighteen", "nineteen",
+}
+
+var tens = []string{"", "", "twenty", "thirty", "forty", "fifty", "sixty", "seventy", "eighty", "ninety"}
+
+var scales = []struct {
+	value int64
+	name  string
+}{
+	{1e12, "trillion"}, {1e9, "billion"}, {1e6, "million"}, {1e3, "thousand"},
+}
+
+// numberWords spells out the non-negative n in English.
+func numberWords(n int64) string {
+	if n < 20 {
+		return smallNumbers[n]
+	}
+	var parts []string
+	for _, s := range scales {
+		if n >= s.value {
+			parts = append(parts, numberWords(n/s.value)+" "+s.name)
+			n %= s.value
+		}
+	}
+	if n >= 100 {
+		parts = append(parts, smallNumbers[n/100]+" hundred")
+		n %= 100
+	}
+	switch {
+	case n >= 20 && n%10 != 0:
+		parts = append(parts, tens[n/10]+"-"+smallNumbers[n%10])
+	case n >= 20:
+		parts = append(parts, tens[n/10])
+	case n > 0:
+		parts = append(parts, smallNumbers[n])
+	}
+	return strings.Join(parts, " ")
+}
+
+// irregularOrdinals maps the number words whose ordinal is not formed by
+// adding "th".
+var irregularOrdinals = map[string]string{
+	"one": "first", "two": "second", "three": "third", "five": "fifth",
+	"eight": "eighth", "nine": "ninth", "twelve": "twelfth",
+}
+
+// ordinalWords turns the spelled-out cardinal words into an ordinal.
+func ordinalWords(words string) string {
+	i := strings.LastIndexAny(words, " -") + 1
+	last := words[i:]
+	switch {
+	case irregularOrdinals[last] != "":
+		last = irregularOrdinals[last]
+	case strings.HasSuffix(last, "y"):
+		last = strings.TrimSuffix(last, "y") + "ieth"
+	default:
+		last += "th"
+	}
+	return words[:i] + last
+}
@@ -0,0 +1,788 @@
+//go:build !anko_nopdf
+
+package extras
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/d5/tengo/v2"
+	"golang.org/x/text/encoding/charmap"
+)
+
+func init() {
+	ExtraModules["pdf"] = pdfModule
+}
+
+// pdfModule implements the pdf module.
+func pdfModule(_ *Invocation) map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"text": &tengo.UserFunction{
+			Name: "text",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 1 {
+					return nil, fmt.Errorf("pdf.text: expected 1 argument")
+				}
+				data, ok := tengo.ToByteSlice(args[0])
+				if !ok {
+					return nil, fmt.Errorf("pdf.text: argument must be bytes")
+				}
+				pages, err := PDFText(data)
+				if err != nil {
+					return nil, fmt.Errorf("pdf.text: %w", err)
+				}
+				arr := make([]tengo.Object, len(pages))
+				for i, p := range pages {
+					arr[i] = &tengo.String{Value: p}
+				}
+				return &tengo.Array{Value: arr}, nil
+			},
+		},
+	}
+}
+
+// PDFText extracts the text of every page of an unencrypted PDF, in page
+// order. Only the text drawing operators are interpreted: line breaks follow
+// text positioning and layout such as columns or tables is not restored.
+// Content streams must be uncompressed or FlateDecode compressed. Documents
+// of more than pdfMaxPages pages, or whose streams decompress to more than
+// pdfMaxBytes, fail.
+func PDFText(data []byte) ([]string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("%PDF")) {
+		return nil, errors.New("not a PDF document")
+	}
+	doc := &pdfDoc{objects: make(map[int]any), remaining: pdfMaxBytes}
+	doc.load(data)
+	if doc.err != nil {
+		return nil, doc.err
+	}
+	if doc.encrypted {
+		return nil, errors.New("encrypted PDFs are not supported")
+	}
+	for _, obj := range doc.objects {
+		if d, ok := obj.(pdfDict); ok && d["Encrypt"] != nil {
+			return nil, errors.New("encrypted PDFs are not supported")
+		}
+	}
+
+	root := doc.catalog()
+	if root == nil {
+		return nil, errors.New("document catalog not found")
+	}
+	// Every node of the page tree is visited once, so that nodes listed as
+	// kids more than once, or cycles, cannot blow up the walk.
+	var pages []string
+	visited := make(map[int]bool)
+	var walk func(node pdfDict, resources pdfDict, depth int)
+	walk = func(node pdfDict, resources pdfDict, depth int) {
+		if depth > 64 || len(pages) > pdfMaxPages || doc.err != nil {
+			return
+		}
+		if r, ok := doc.resolve(node["Resources"]).(pdfDict); ok {
+			resources = r
+		}
+		if kids, ok := doc.resolve(node["Kids"]).([]any); ok {
+			for _, kid := range kids {
+				if ref, ok := kid.(pdfRef); ok {
+					if visited[ref.num] {
+						continue
+					}
+					visited[ref.num] = true
+				}
+				if k, ok := doc.resolve(kid).(pdfDict); ok {
+					walk(k, resources, depth+1)
+				}
+			}
+			return
+		}
+		pages = append(pages, doc.pageText(node, resources))
+	}
+	if p, ok := doc.resolve(root["Pages"]).(pdfDict); ok {
+		walk(p, nil, 0)
+	}
+	if doc.err != nil {
+		return nil, doc.err
+	}
+	if len(pages) > pdfMaxPages {
+		return nil, fmt.Errorf("document has more than %d pages", pdfMaxPages)
+	}
+	return pages, nil
+}
+
+// Limits of PDFText: the pages it extracts and the bytes the streams of a
+// document may decompress to, in total.
+const (
+	pdfMaxPages = 10000
+	pdfMaxBytes = 64 << 20
+)
+
+var errPDFTooLarge = errors.New("PDF streams exceed the size limit")
+
+// PDF object model. Numbers are float64, strings pdfString, names pdfName,
+// arrays []any, dictionaries pdfDict and indirect references pdfRef.
+type (
+	pdfName    string
+	pdfString  string
+	pdfKeyword string
+	pdfDict    map[pdfName]any
+	pdfRef     struct{ num int }
+	pdfStream  struct {
+		dict pdfDict
+		data []byte
+	}
+)
+
+type pdfDoc struct {
+	objects map[int]any
+	// encrypted is set when a trailer references an encryption dictionary.
+	encrypted bool
+	// remaining is what the document's streams may still decompress to;
+	// err is set once they went over it.
+	remaining int64
+	err       error
+}
+
+var pdfTrailer = regexp.MustCompile(`\btrailer\b`)
+
+var pdfObjHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// load collects every "N G obj" definition in data, later ones overriding
+// earlier ones as incremental updates do, and then the objects held in
+// object streams.
+func (d *pdfDoc) load(data []byte) {
+	for _, m := range pdfObjHeader.FindAllSubmatchIndex(data, -1) {
+		num, err := strconv.Atoi(string(data[m[2]:m[3]]))
+		if err != nil {
+			continue
+		}
+		lex := &pdfLexer{data: data, pos: m[1]}
+		obj, err := lex.object()
+		if err != nil {
+			continue
+		}
+		if dict, ok := obj.(pdfDict); ok {
+			if s, ok := lex.stream(dict); ok {
+				obj = s
+			}
+		}
+		d.objects[num] = obj
+	}
+	for _, m := range pdfTrailer.FindAllIndex(data, -1) {
+		lex := &pdfLexer{data: data, pos: m[1]}
+		if dict, err := lex.object(); err == nil {
+			if dict, ok := dict.(pdfDict); ok && dict["Encrypt"] != nil {
+				d.encrypted = true
+			}
+		}
+	}
+
+	for _, obj := range d.objects {
+		s, ok := obj.(*pdfStream)
+		if !ok || s.dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		content, err := d.decode(s)
+		if err != nil {
+			continue
+		}
+		n, _ := d.resolve(s.dict["N"]).(float64)
+		first, _ := d.resolve(s.dict["First"]).(float64)
+		header := &pdfLexer{data: content}
+		for range int(n) {
+			num, err1 := header.object()
+			off, err2 := header.object()
+			if err1 != nil || err2 != nil {
+				break
+			}
+			nf, ok1 := num.(float64)
+			of, ok2 := off.(float64)
+			pos := int(first) + int(of)
+			if !ok1 || !ok2 || pos < 0 || pos >= len(content) {
+				continue
+			}
+			if _, exists := d.objects[int(nf)]; exists {
+				continue
+			}
+			if o, err := (&pdfLexer{data: content, pos: pos}).object(); err == nil {
+				d.objects[int(nf)] = o
+			}
+		}
+	}
+}
+
+// resolve follows indirect references.
+func (d *pdfDoc) resolve(v any) any {
+	for range 32 {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = d.objects[ref.num]
+	}
+	return nil
+}
+
+func (d *pdfDoc) catalog() pdfDict {
+	for _, obj := range d.objects {
+		var dict pdfDict
+		switch o := obj.(type) {
+		case pdfDict:
+			dict = o
+		case *pdfStream:
+			dict = o.dict
+		}
+		if dict["Type"] == pdfName("Catalog") {
+			return dict
+		}
+		if root, ok := d.resolve(dict["Root"]).(pdfDict); ok && dict["Type"] == pdfName("XRef") {
+			return root
+		}
+	}
+	return nil
+}
+
+// decode returns the decoded data of s.
+func (d *pdfDoc) decode(s *pdfStream) ([]byte, error) {
+	var filters []any
+	switch f := d.resolve(s.dict["Filter"]).(type) {
+	case nil:
+	case pdfName:
+		filters = []any{f}
+	case []any:
+		filters = f
+	}
+	data := s.data
+	for _, f := range filters {
+		switch d.resolve(f) {
+		case pdfName("FlateDecode"):
+			r, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			out, err := io.ReadAll(io.LimitReader(r, d.remaining+1))
+			if int64(len(out)) > d.remaining {
+				d.err = errPDFTooLarge
+				return nil, d.err
+			}
+			if err != nil && len(out) == 0 {
+				return nil, err
+			}
+			d.remaining -= int64(len(out))
+			data = out
+		default:
+			return nil, fmt.Errorf("unsupported filter %v", f)
+		}
+	}
+	return data, nil
+}
+
+// pageText interprets the content streams of page.
+func (d *pdfDoc) pageText(page, resources pdfDict) string {
+	var content []byte
+	switch c := d.resolve(page["Contents"]).(type) {
+	case *pdfStream:
+		content, _ = d.decode(c)
+	case []any:
+		for _, part := range c {
+			if s, ok := d.resolve(part).(*pdfStream); ok {
+				data, _ := d.decode(s)
+				content = append(append(content, data...), '\n')
+			}
+		}
+	}
+	fonts, _ := d.resolve(resources["Font"]).(pdfDict)
+	loaded := make(map[pdfName]*pdfFont)
+
+	var out strings.Builder
+	var font *pdfFont
+	newline := func() {
+		if out.Len() > 0 && !strings.HasSuffix(out.String(), "\n") {
+			out.WriteByte('\n')
+		}
+	}
+	lex := &pdfLexer{data: content}
+	var operands []any
+	for {
+		obj, err := lex.object()
+		if err != nil {
+			break
+		}
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+		switch op {
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[0].(pdfName); ok {
+					font = loaded[name]
+					if fd, ok := d.resolve(fonts[name]).(pdfDict); ok && font == nil {
+						font = d.font(fd)
+						loaded[name] = font
+					}
+				}
+			}
+		case "Tj":
+			if len(operands) >= 1 {
+				out.WriteString(font.text(operands[len(operands)-1]))
+			}
+		case "'", "\"":
+			newline()
+			if len(operands) >= 1 {
+				out.WriteString(font.text(operands[len(operands)-1]))
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				arr, _ := operands[len(operands)-1].([]any)
+				for _, item := range arr {
+					if n, ok := item.(float64); ok {
+						if n < -200 {
+							out.WriteByte(' ')
+						}
+						continue
+					}
+					out.WriteString(font.text(item))
+				}
+			}
+		case "T*":
+			newline()
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				if ty, ok := operands[1].(float64); ok && ty != 0 {
+					newline()
+				}
+			}
+		case "ET":
+			newline()
+		case "ID":
+			// Skip inline image data up to EI.
+			if i := bytes.Index(content[lex.pos:], []byte("EI")); i >= 0 {
+				lex.pos += i + 2
+			} else {
+				lex.pos = len(content)
+			}
+		}
+		operands = operands[:0]
+	}
+	return strings.TrimSpace(out.String())
+}
+
+// pdfFont maps character codes of a font to text.
+type pdfFont struct {
+	cmap     map[string]string
+	codeLens []int
+	twoByte  bool
+}
+
+func (d *pdfDoc) font(fd pdfDict) *pdfFont {
+	f := &pdfFont{}
+	if enc, ok := d.resolve(fd["Encoding"]).(pdfName); ok && strings.HasPrefix(string(enc), "Identity") {
+		f.twoByte = true
+	}
+	if s, ok := d.resolve(fd["ToUnicode"]).(*pdfStream); ok {
+		if data, err := d.decode(s); err == nil {
+			f.parseCMap(data)
+		}
+	}
+	return f
+}
+
+// parseCMap reads the codespace ranges and bfchar/bfrange mappings of a
+// ToUnicode CMap.
+func (f *pdfFont) parseCMap(data []byte) {
+	f.cmap = make(map[string]string)
+	lex := &pdfLexer{data: data}
+	var operands []any
+	for {
+		obj, err := lex.object()
+		if err != nil {
+			return
+		}
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+		switch op {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				if lo, ok := operands[i].(pdfString); ok {
+					f.codeLens = append(f.codeLens, len(lo))
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					f.cmap[string(src)] = utf16Text(string(dst))
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 || len(lo) > 4 {
+					continue
+				}
+				start, end := codeValue(string(lo)), codeValue(string(hi))
+				if end < start || end-start > 0xffff {
+					continue
+				}
+				for c := start; c <= end; c++ {
+					code := codeBytes(c, len(lo))
+					switch dst := operands[i+2].(type) {
+					case pdfString:
+						r := []rune(utf16Text(string(dst)))
+						if len(r) > 0 {
+							r[len(r)-1] += rune(c - start)
+						}
+						f.cmap[code] = string(r)
+					case []any:
+						if int(c-start) < len(dst) {
+							if s, ok := dst[c-start].(pdfString); ok {
+								f.cmap[code] = utf16Text(string(s))
+							}
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// text decodes a string operand shown with f; f may be nil.
+func (f *pdfFont) text(v any) string {
+	s, ok := v.(pdfString)
+	if !ok {
+		return ""
+	}
+	if f == nil || f.cmap == nil {
+		if f != nil && f.twoByte {
+			return ""
+		}
+		out, _ := charmap.Windows1252.NewDecoder().String(string(s))
+		return out
+	}
+	lens := f.codeLens
+	if len(lens) == 0 {
+		lens = []int{1}
+		if f.twoByte {
+			lens = []int{2}
+		}
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		matched := false
+		for _, n := range lens {
+			if i+n <= len(s) {
+				if t, ok := f.cmap[string(s[i:i+n])]; ok {
+					b.WriteString(t)
+					i += n
+					matched = true
+					break
+				}
+			}
+		}
+		if !matched {
+			i += lens[0]
+		}
+	}
+	return b.String()
+}
+
+func codeValue(s string) uint32 {
+	var v uint32
+	for i := 0; i < len(s); i++ {
+		v = v<<8 | uint32(s[i])
+	}
+	return v
+}
+
+func codeBytes(v uint32, n int) string {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return string(b)
+}
+
+// utf16Text decodes the UTF-16BE destination strings of a CMap.
+func utf16Text(s string) string {
+	if len(s)%2 != 0 {
+		return s
+	}
+	u := make([]uint16, len(s)/2)
+	for i := range u {
+		u[i] = uint16(s[2*i])<<8 | uint16(s[2*i+1])
+	}
+	return string(utf16.Decode(u))
+}
+
+// pdfLexer reads PDF objects and content stream operators.
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+var errPDFEOF = errors.New("unexpected end of PDF data")
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func isPDFDelim(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		l.pos++
+	}
+}
+
+// object reads the next object, turning "N G R" into a pdfRef.
+func (l *pdfLexer) object() (any, error) {
+	obj, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	if n, ok := obj.(float64); ok && n == float64(int(n)) {
+		save := l.pos
+		gen, err1 := l.token()
+		r, err2 := l.token()
+		if _, ok := gen.(float64); ok && err1 == nil && err2 == nil && r == pdfKeyword("R") {
+			return pdfRef{num: int(n)}, nil
+		}
+		l.pos = save
+	}
+	return obj, nil
+}
+
+func (l *pdfLexer) token() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, errPDFEOF
+	}
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		l.pos++
+		start := l.pos
+		for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelim(l.data[l.pos]) {
+			l.pos++
+		}
+		return pdfName(unescapeName(string(l.data[start:l.pos]))), nil
+	case c == '(':
+		return l.literalString()
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		dict := pdfDict{}
+		for {
+			l.skipSpace()
+			if l.pos+1 < len(l.data) && l.data[l.pos] == '>' && l.data[l.pos+1] == '>' {
+				l.pos += 2
+				return dict, nil
+			}
+			key, err := l.token()
+			if err != nil {
+				return nil, err
+			}
+			name, ok := key.(pdfName)
+			if !ok {
+				continue
+			}
+			val, err := l.object()
+			if err != nil {
+				return nil, err
+			}
+			dict[name] = val
+		}
+	case c == '<':
+		l.pos++
+		end := bytes.IndexByte(l.data[l.pos:], '>')
+		if end < 0 {
+			return nil, errPDFEOF
+		}
+		hex := make([]byte, 0, end)
+		for _, h := range l.data[l.pos : l.pos+end] {
+			if !isPDFSpace(h) {
+				hex = append(hex, h)
+			}
+		}
+		l.pos += end + 1
+		if len(hex)%2 == 1 {
+			hex = append(hex, '0')
+		}
+		out := make([]byte, len(hex)/2)
+		for i := range out {
+			v, _ := strconv.ParseUint(string(hex[2*i:2*i+2]), 16, 8)
+			out[i] = byte(v)
+		}
+		return pdfString(out), nil
+	case c == '[':
+		l.pos++
+		var arr []any
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return nil, errPDFEOF
+			}
+			if l.data[l.pos] == ']' {
+				l.pos++
+				return arr, nil
+			}
+			v, err := l.object()
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+	case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+		l.pos++
+		return pdfKeyword(string(c)), nil
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelim(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	if n, err := strconv.ParseFloat(word, 64); err == nil {
+		return n, nil
+	}
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	return pdfKeyword(word), nil
+}
+
+func (l *pdfLexer) literalString() (any, error) {
+	l.pos++
+	var out []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfString(out), nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return nil, errPDFEOF
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for range 2 {
+						if l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7' {
+							v = v*8 + int(l.data[l.pos]-'0')
+							l.pos++
+						}
+					}
+					out = append(out, byte(v))
+				} else {
+					out = append(out, e)
+				}
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+	return nil, errPDFEOF
+}
+
+// stream reads the stream body following dict, if any.
+func (l *pdfLexer) stream(dict pdfDict) (*pdfStream, bool) {
+	save := l.pos
+	kw, err := l.token()
+	if err != nil || kw != pdfKeyword("stream") {
+		l.pos = save
+		return nil, false
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+	if n, ok := dict["Length"].(float64); ok {
+		end := start + int(n)
+		if end <= len(l.data) && bytes.Contains(l.data[end:min(end+32, len(l.data))], []byte("endstream")) {
+			return &pdfStream{dict: dict, data: l.data[start:end]}, true
+		}
+	}
+	end := bytes.Index(l.data[start:], []byte("endstream"))
+	if end < 0 {
+		return nil, false
+	}
+	return &pdfStream{dict: dict, data: bytes.TrimRight(l.data[start:start+end], "\r\n")}, true
+}
+
+// unescapeName decodes #xx escapes in a name.
+func unescapeName(s string) string {
+	if !strings.Contains(s, "#") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '#' && i+2 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,7 @@
+//go:build anko_nopdf
+
+package extras
+
+func init() {
+	UnavailableModules["pdf"] = "build without the anko_nopdf tag"
+}
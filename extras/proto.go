@@ -0,0 +1,157 @@
+//go:build !anko_noproto
+
+package extras
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/d5/tengo/v2"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func init() {
+	ExtraModules["proto"] = protoModule
+}
+
+// protoModule implements the proto module.
+func protoModule(_ *Invocation) map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"decode": &tengo.UserFunction{
+			Name: "decode",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) < 2 || len(args) > 3 {
+					return nil, fmt.Errorf("proto.decode: expected 2 or 3 arguments")
+				}
+				data, ok := tengo.ToByteSlice(args[0])
+				if !ok {
+					return nil, fmt.Errorf("proto.decode: data must be bytes or a string")
+				}
+				descriptor, ok := tengo.ToString(args[1])
+				if !ok {
+					return nil, fmt.Errorf("proto.decode: descriptor must be a base64 string")
+				}
+				message := ""
+				if len(args) == 3 {
+					if message, ok = tengo.ToString(args[2]); !ok {
+						return nil, fmt.Errorf("proto.decode: message name must be a string")
+					}
+				}
+				md, err := messageDescriptor(descriptor, message)
+				if err != nil {
+					return nil, fmt.Errorf("proto.decode: %w", err)
+				}
+				msg := dynamicpb.NewMessage(md)
+				if err := proto.Unmarshal(data, msg); err != nil {
+					return nil, fmt.Errorf("proto.decode: %w", err)
+				}
+				return protoMessageToTengo(msg), nil
+			},
+		},
+	}
+}
+
+// messageDescriptor resolves the message named name (fully qualified, e.g.
+// "api.ChapterList") in a base64-encoded FileDescriptorSet, as produced by
+// protoc --descriptor_set_out. Without a name the first message of the last
+// file is used.
+func messageDescriptor(b64, name string) (protoreflect.MessageDescriptor, error) {
+	raw, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor: %w", err)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("invalid descriptor: %w", err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor: %w", err)
+	}
+	if name == "" {
+		if len(set.File) == 0 {
+			return nil, fmt.Errorf("descriptor holds no files")
+		}
+		fd, err := files.FindFileByPath(set.File[len(set.File)-1].GetName())
+		if err != nil {
+			return nil, err
+		}
+		if fd.Messages().Len() == 0 {
+			return nil, fmt.Errorf("descriptor file %s holds no messages", fd.Path())
+		}
+		return fd.Messages().Get(0), nil
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, err
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message", name)
+	}
+	return md, nil
+}
+
+// protoMessageToTengo converts the set fields of msg into a map keyed by
+// field name.
+func protoMessageToTengo(msg protoreflect.Message) *tengo.Map {
+	m := make(map[string]tengo.Object)
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsList():
+			list := v.List()
+			arr := make([]tengo.Object, list.Len())
+			for i := range arr {
+				arr[i] = protoValueToTengo(fd, list.Get(i))
+			}
+			m[string(fd.Name())] = &tengo.Array{Value: arr}
+		case fd.IsMap():
+			mm := make(map[string]tengo.Object)
+			v.Map().Range(func(k protoreflect.MapKey, mv protoreflect.Value) bool {
+				mm[k.String()] = protoValueToTengo(fd.MapValue(), mv)
+				return true
+			})
+			m[string(fd.Name())] = &tengo.Map{Value: mm}
+		default:
+			m[string(fd.Name())] = protoValueToTengo(fd, v)
+		}
+		return true
+	})
+	return &tengo.Map{Value: m}
+}
+
+// protoValueToTengo converts a singular field value. Enums become their value
+// names and 64-bit unsigned integers are truncated to int64.
+func protoValueToTengo(fd protoreflect.FieldDescriptor, v protoreflect.Value) tengo.Object {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		if v.Bool() {
+			return tengo.TrueValue
+		}
+		return tengo.FalseValue
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return &tengo.String{Value: string(ev.Name())}
+		}
+		return &tengo.Int{Value: int64(v.Enum())}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return &tengo.Int{Value: v.Int()}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return &tengo.Int{Value: int64(v.Uint())}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return &tengo.Float{Value: v.Float()}
+	case protoreflect.StringKind:
+		return &tengo.String{Value: v.String()}
+	case protoreflect.BytesKind:
+		return &tengo.Bytes{Value: v.Bytes()}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return protoMessageToTengo(v.Message())
+	default:
+		return tengo.UndefinedValue
+	}
+}
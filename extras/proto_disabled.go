@@ -0,0 +1,7 @@
+//go:build anko_noproto
+
+package extras
+
+func init() {
+	UnavailableModules["proto"] = "build without the anko_noproto tag"
+}
@@ -0,0 +1,64 @@
+package extras
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the requests of the req module per host with a token
+// bucket: up to Requests requests may be sent at once, and Requests more
+// every Per. Requests over the limit wait for their turn.
+type RateLimiter struct {
+	Requests int
+	Per      time.Duration
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// bucket is the token bucket of one host.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter allowing requests requests to each host
+// every per.
+func NewRateLimiter(requests int, per time.Duration) *RateLimiter {
+	return &RateLimiter{Requests: requests, Per: per, buckets: make(map[string]*bucket)}
+}
+
+// Wait blocks until a request to host may be sent or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context, host string) error {
+	if l == nil || l.Requests <= 0 || l.Per <= 0 {
+		return nil
+	}
+	host = strings.ToLower(host)
+	rate := float64(l.Requests) / float64(l.Per)
+
+	l.mu.Lock()
+	now := time.Now()
+	b, ok := l.buckets[host]
+	if !ok {
+		b = &bucket{tokens: float64(l.Requests), last: now}
+		l.buckets[host] = b
+	}
+	b.tokens = min(b.tokens+float64(now.Sub(b.last))*rate, float64(l.Requests))
+	b.last = now
+	b.tokens--
+	delay := time.Duration(-b.tokens / rate)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	if err := wait(ctx, delay); err != nil {
+		l.mu.Lock()
+		b.tokens++
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package extras
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/d5/tengo/v2"
+	req "github.com/imroc/req/v3"
+)
+
+// defaultMaxRedirects is the number of redirects clients built with
+// NewClient follow per request when Config.MaxRedirects is zero.
+const defaultMaxRedirects = 10
+
+// ErrTooManyRedirects is returned for requests redirected more often than
+// their limit allows. They are not retried.
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// redirectKey is the context key of the redirect limit of a single request,
+// set by the max_redirects and no_follow request options.
+type redirectKey struct{}
+
+// redirectPolicy limits the redirects of a request to the limit in its
+// context or, without one, to limit: negative follows none and zero
+// defaultMaxRedirects. A redirect that is not followed is returned as the
+// response; going over a positive limit is an error.
+func redirectPolicy(limit int) req.RedirectPolicy {
+	return func(r *http.Request, via []*http.Request) error {
+		n := limit
+		if v, ok := r.Context().Value(redirectKey{}).(int); ok {
+			n = v
+			if n == 0 {
+				n = -1
+			}
+		}
+		switch {
+		case n < 0:
+			return http.ErrUseLastResponse
+		case n == 0:
+			n = defaultMaxRedirects
+		}
+		if len(via) > n {
+			return fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, n)
+		}
+		return nil
+	}
+}
+
+// withRedirectLimit returns ctx limiting its requests to n redirects, when
+// n is not negative.
+func withRedirectLimit(ctx context.Context, n int) context.Context {
+	if n < 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, redirectKey{}, n)
+}
+
+// redirectChain returns the URLs resp was redirected from, in order,
+// starting with the requested URL; it is empty without redirects.
+func redirectChain(resp *http.Response) *tengo.Array {
+	urls := []tengo.Object{}
+	for r := resp.Request; r != nil && r.Response != nil && r.Response.Request != nil; r = r.Response.Request {
+		urls = append(urls, &tengo.String{Value: r.Response.Request.URL.String()})
+	}
+	slices.Reverse(urls)
+	return &tengo.Array{Value: urls}
+}
@@ -1,104 +1,807 @@
 package extras
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log/slog"
+	"maps"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/d5/tengo/v2"
+	"github.com/d5/tengo/v2/stdlib/json"
 	req "github.com/imroc/req/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func reqModule(logger *slog.Logger) map[string]tengo.Object {
-	client := req.C().ImpersonateChrome()
-	return map[string]tengo.Object{
+// requestOptions are the per-request settings accepted in an options map.
+type requestOptions struct {
+	headers map[string]string
+	query   map[string]string
+	body    any
+	auth    *requestAuth
+	timeout time.Duration
+	// redirects is the number of redirects the request may follow, or -1
+	// for the client's limit.
+	redirects int
+	retry     RetryPolicy
+	stream    bool
+	bytes     bool
+}
+
+// RequestInfo describes a single request attempt of the req module, as
+// passed to Config.OnRequest. Status is zero when no response arrived.
+type RequestInfo struct {
+	Method   string
+	URL      string
+	Status   int
+	Duration time.Duration
+	Err      error
+}
+
+// parseRequestOptions reads an options map ({headers: {...}, query: {...},
+// body: ..., auth: {...}, timeout: ms, retries: n, retry: {...},
+// max_redirects: n, no_follow: bool, stream: bool, bytes: bool}), falling
+// back to the engine defaults in cfg for unset keys. retries is a shorthand
+// for retry.attempts minus one.
+func parseRequestOptions(fn string, obj tengo.Object, cfg Config) (requestOptions, error) {
+	opts := requestOptions{headers: map[string]string{}, query: map[string]string{}, timeout: cfg.HTTPTimeout, retry: cfg.Retry.withDefaults(), redirects: -1}
+	if obj == nil {
+		return opts, nil
+	}
+	m, ok := obj.(*tengo.Map)
+	if !ok {
+		return opts, fmt.Errorf("%s: options must be a map", fn)
+	}
+	for _, key := range []string{"headers", "query"} {
+		v, ok := m.Value[key]
+		if !ok {
+			continue
+		}
+		values, ok := v.(*tengo.Map)
+		if !ok {
+			return opts, fmt.Errorf("%s: options.%s must be a map", fn, key)
+		}
+		dst := opts.headers
+		if key == "query" {
+			dst = opts.query
+		}
+		for k, v := range values.Value {
+			dst[k] = strings.Trim(v.String(), `"`)
+		}
+	}
+	if v, ok := m.Value["body"]; ok {
+		body, err := scriptBody(v)
+		if err != nil {
+			return opts, fmt.Errorf("%s: options.body %w", fn, err)
+		}
+		opts.body = body
+	}
+	if v, ok := m.Value["auth"]; ok {
+		auth, err := parseAuth(v)
+		if err != nil {
+			return opts, fmt.Errorf("%s: options.auth %w", fn, err)
+		}
+		opts.auth = auth
+	}
+	if v, ok := m.Value["timeout"]; ok {
+		ms, ok := tengo.ToInt64(v)
+		if !ok || ms < 0 {
+			return opts, fmt.Errorf("%s: options.timeout must be a non-negative number of milliseconds", fn)
+		}
+		opts.timeout = time.Duration(ms) * time.Millisecond
+	}
+	if v, ok := m.Value["retries"]; ok {
+		n, ok := tengo.ToInt(v)
+		if !ok || n < 0 {
+			return opts, fmt.Errorf("%s: options.retries must be a non-negative number", fn)
+		}
+		opts.retry.MaxAttempts = n + 1
+	}
+	if v, ok := m.Value["retry"]; ok {
+		if err := parseRetryOptions(fn, v, &opts.retry); err != nil {
+			return opts, err
+		}
+	}
+	if v, ok := m.Value["max_redirects"]; ok {
+		n, ok := tengo.ToInt(v)
+		if !ok || n < 0 {
+			return opts, fmt.Errorf("%s: options.max_redirects must be a non-negative number", fn)
+		}
+		opts.redirects = n
+	}
+	if v, ok := m.Value["no_follow"]; ok && !v.IsFalsy() {
+		opts.redirects = 0
+	}
+	if v, ok := m.Value["stream"]; ok {
+		opts.stream = !v.IsFalsy()
+	}
+	if v, ok := m.Value["bytes"]; ok {
+		opts.bytes = !v.IsFalsy()
+	}
+	return opts, nil
+}
+
+// scriptBody converts a request body: strings and bytes are sent as is,
+// maps and arrays as JSON.
+func scriptBody(obj tengo.Object) (any, error) {
+	switch v := obj.(type) {
+	case *tengo.String:
+		return v.Value, nil
+	case *tengo.Bytes:
+		return v.Value, nil
+	case *tengo.Map, *tengo.ImmutableMap, *tengo.Array, *tengo.ImmutableArray:
+		return tengo.ToInterface(v), nil
+	}
+	return nil, errors.New("must be a string, bytes, a map or an array")
+}
+
+// seenGet records a GET of rawURL with memo key key and logs it when the
+// invocation already sent one to that URL, since rules fetching the same page
+// twice double their latency. It returns the memoized response of an
+// identical earlier GET when there is one.
+func (inv *Invocation) seenGet(rawURL, key string) (tengo.Object, bool) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if inv.gets == nil {
+		inv.gets = make(map[string]int)
+	}
+	inv.gets[rawURL]++
+	if n := inv.gets[rawURL]; n > 1 {
+		inv.Logger.Warn("Duplicate request in run", "url", rawURL, "count", n)
+	}
+	if res, ok := inv.memo[key]; ok {
+		return res.Copy(), true
+	}
+	return nil, false
+}
+
+// memoize stores res as the response of the GET with memo key key when
+// Config.MemoizeGets is set. Only successful (2xx) responses are stored, so
+// that a GET repeated after an error or a redirect reaches the site again.
+func (inv *Invocation) memoize(key string, res tengo.Object) {
+	if !inv.Config.MemoizeGets {
+		return
+	}
+	if m, ok := res.(*tengo.Map); ok {
+		if status, ok := m.Value["status"].(*tengo.Int); !ok || status.Value < 200 || status.Value > 299 {
+			return
+		}
+	}
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if inv.memo == nil {
+		inv.memo = make(map[string]tengo.Object)
+	}
+	inv.memo[key] = res.Copy()
+}
+
+// getMemoKey identifies a GET of rawURL with opts for memoization.
+func getMemoKey(rawURL string, opts requestOptions) string {
+	var b strings.Builder
+	b.WriteString(rawURL)
+	for _, k := range slices.Sorted(maps.Keys(opts.query)) {
+		fmt.Fprintf(&b, "\n?%s=%s", k, opts.query[k])
+	}
+	for _, k := range slices.Sorted(maps.Keys(opts.headers)) {
+		fmt.Fprintf(&b, "\n%s: %s", k, opts.headers[k])
+	}
+	fmt.Fprintf(&b, "\n%t %s %d %s", opts.bytes, opts.timeout, opts.redirects, opts.auth)
+	return b.String()
+}
+
+// newRequest creates a request of the invocation's session honoring ctx and
+// the timeout in opts. The returned cancel function must be called once the
+// response has been consumed.
+func newRequest(ctx context.Context, inv *Invocation, opts requestOptions) (*req.Request, context.CancelFunc) {
+	r := inv.session().R()
+	if id := inv.Config.Identity; id != nil {
+		r.SetHeader("User-Agent", id.UserAgent).SetHeader("Accept-Language", id.AcceptLanguage)
+	}
+	if !hasHeader(opts.headers, "Authorization") {
+		if opts.auth == nil {
+			opts.auth = inv.requestAuth()
+		}
+		opts.auth.apply(r)
+	}
+	r.SetHeaders(opts.headers).SetQueryParams(opts.query)
+	switch opts.body.(type) {
+	case nil:
+	case string, []byte:
+		r.SetBody(opts.body)
+	default:
+		r.SetBodyJsonMarshal(opts.body)
+	}
+	if opts.stream {
+		r.DisableAutoReadResponse()
+	}
+	ctx = withRedirectLimit(ctx, opts.redirects)
+	if opts.timeout <= 0 {
+		return r.SetContext(ctx), func() {}
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	return r.SetContext(ctx), cancel
+}
+
+// doRequest sends the request built by send, retrying as set by opts.retry,
+// and converts the response into a Tengo map holding status,
+// headers, the post-redirect url, also as final_url, the redirects leading
+// there (see redirectChain), proto and duration_ms. With the stream option
+// the body is left unread and returned as a response-body object; with the
+// bytes option or a binary content type it is returned as bytes, e.g. for
+// images. Other bodies are decoded to UTF-8 strings from their charset, such
+// as GBK or Shift_JIS, which is reported as charset, and JSON bodies are
+// also parsed into json. With Config.Solver set, a GET answered with an
+// anti-bot challenge returns the page solved by it instead. Every attempt
+// counts against the request budget of inv, waits for Config.RateLimit and
+// is traced with Config.Tracer.
+func doRequest(fn, method, rawURL string, inv *Invocation, opts requestOptions, send func(*req.Request) (*req.Response, error)) (tengo.Object, error) {
+	var r *req.Response
+	var err error
+	var cancel context.CancelFunc
+	for attempt := 1; ; attempt++ {
+		if err := inv.takeRequest(); err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		if err := inv.Config.RateLimit.Wait(inv.Context, requestHost(rawURL)); err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+		ctx, span := startRequestSpan(inv, method, rawURL)
+		var request *req.Request
+		request, cancel = newRequest(ctx, inv, opts)
+		if ua := inv.Config.Solver.userAgent(requestHost(rawURL)); ua != "" && !hasHeader(opts.headers, "User-Agent") {
+			request.SetHeader("User-Agent", ua)
+		}
+		start := time.Now()
+		r, err = send(request)
+		endRequestSpan(span, r, err)
+		if observe := inv.Config.OnRequest; observe != nil {
+			info := RequestInfo{Method: request.Method, URL: request.RawURL, Duration: time.Since(start), Err: err}
+			if err == nil && r.Response != nil {
+				info.Status = r.StatusCode
+			}
+			observe(info)
+		}
+		if errors.Is(err, ErrHostNotAllowed) || errors.Is(err, ErrNoRecording) || errors.Is(err, ErrTooManyRedirects) || inv.Context.Err() != nil {
+			cancel()
+			break
+		}
+		if err == nil && !opts.retry.retryStatus(r.StatusCode) || attempt >= opts.retry.MaxAttempts {
+			break
+		}
+		if err == nil {
+			r.Body.Close()
+		}
+		cancel()
+		retryAfter := ""
+		logArgs := []any{"attempt", attempt}
+		if err != nil {
+			logArgs = append(logArgs, "error", err)
+		} else {
+			retryAfter = r.Header.Get("Retry-After")
+			logArgs = append(logArgs, "status", r.StatusCode)
+		}
+		delay := opts.retry.delay(attempt, retryAfter)
+		inv.Logger.Warn(fn+": retry", append(logArgs, "delay", delay)...)
+		if err := wait(inv.Context, delay); err != nil {
+			return nil, fmt.Errorf("%s: %w", fn, err)
+		}
+	}
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("%s: %w", fn, err)
+	}
+	finalURL := ""
+	if r.Response.Request != nil {
+		finalURL = r.Response.Request.URL.String()
+	}
+	challenged := challengePage(r.Response)
+	inv.noteResponse(r.StatusCode, challenged)
+	if solver := inv.Config.Solver; solver != nil && method == http.MethodGet && challenged {
+		r.Body.Close()
+		cancel()
+		return solver.solve(fn, finalURL, inv, opts)
+	}
+	result := map[string]tengo.Object{
+		"status":      &tengo.Int{Value: int64(r.Response.StatusCode)},
+		"headers":     convertHeaders(r.Response.Header),
+		"url":         &tengo.String{Value: finalURL},
+		"final_url":   &tengo.String{Value: finalURL},
+		"redirects":   redirectChain(r.Response),
+		"proto":       &tengo.String{Value: r.Response.Proto},
+		"duration_ms": &tengo.Int{Value: r.TotalTime().Milliseconds()},
+	}
+	if opts.stream {
+		result["stream"] = newResponseBody(inv, r.Body, cancel)
+	} else {
+		setBody(inv, fn, rawURL, result, r.Bytes(), r.Header.Get("Content-Type"), opts.bytes)
+		cancel()
+	}
+	return &tengo.Map{Value: result}, nil
+}
+
+// setBody sets the body of the response map result to data, a body of
+// content type ct: as bytes when raw is set or the content is binary, and
+// otherwise as a string decoded from its charset, together with the parsed
+// json of JSON bodies.
+func setBody(inv *Invocation, fn, rawURL string, result map[string]tengo.Object, data []byte, ct string, raw bool) {
+	if raw || binaryContent(ct) {
+		result["body"] = &tengo.Bytes{Value: data}
+		return
+	}
+	body, name := decodeText(data, ct)
+	result["body"] = &tengo.String{Value: body}
+	result["charset"] = &tengo.String{Value: name}
+	if jsonContent(ct) {
+		if v, err := json.Decode([]byte(body)); err == nil {
+			result["json"] = v
+		} else {
+			inv.Logger.Warn(fn+": invalid JSON body", "url", rawURL, "error", err)
+		}
+	}
+}
+
+// hasHeader reports whether headers set name, in any case.
+func hasHeader(headers map[string]string, name string) bool {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// binaryContent reports whether a body of content type ct is binary: types
+// other than text, JSON, XML, JavaScript and form data. Bodies without a
+// content type are taken as text.
+func binaryContent(ct string) bool {
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") {
+		return false
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript", "application/ecmascript",
+		"application/x-javascript", "application/x-www-form-urlencoded":
+		return false
+	}
+	return true
+}
+
+// jsonContent reports whether a body of content type ct is JSON.
+func jsonContent(ct string) bool {
+	mediaType, _, err := mime.ParseMediaType(ct)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// requestHost returns the host rawURL is sent to, or rawURL itself when it
+// does not parse.
+func requestHost(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Hostname()
+	}
+	return rawURL
+}
+
+// startRequestSpan starts the client span of a request attempt when the
+// invocation is traced.
+func startRequestSpan(inv *Invocation, method, rawURL string) (context.Context, trace.Span) {
+	if inv.Config.Tracer == nil {
+		return inv.Context, nil
+	}
+	return inv.Config.Tracer.Start(inv.Context, "HTTP "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", method),
+			attribute.String("url.full", rawURL),
+		))
+}
+
+// endRequestSpan records the outcome of a request attempt on span, if any,
+// and ends it.
+func endRequestSpan(span trace.Span, r *req.Response, err error) {
+	if span == nil {
+		return
+	}
+	if err == nil && r.Response != nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", r.StatusCode))
+		if r.StatusCode >= 500 {
+			span.SetStatus(codes.Error, r.Status)
+		}
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Protocols lists the values accepted for Config.Protocol.
+var Protocols = []string{"", "http1", "http2", "http3"}
+
+// Impersonations lists the values accepted for Config.Impersonate.
+var Impersonations = []string{"", "chrome", "firefox", "safari", "none"}
+
+// applyImpersonation makes client mimic the browser named by profile.
+func applyImpersonation(client *req.Client, profile string) {
+	switch profile {
+	case "", "chrome":
+		client.ImpersonateChrome()
+	case "firefox":
+		client.ImpersonateFirefox()
+	case "safari":
+		client.ImpersonateSafari()
+	}
+}
+
+// applyProtocol configures the protocol preference of client.
+func applyProtocol(client *req.Client, protocol string) {
+	switch protocol {
+	case "http1":
+		client.EnableForceHTTP1()
+	case "http2":
+		client.EnableForceHTTP2()
+	case "http3":
+		client.EnableHTTP3()
+	}
+}
+
+// ErrHostNotAllowed is returned for requests to a host outside
+// Config.AllowedHosts.
+var ErrHostNotAllowed = errors.New("host not allowed")
+
+// HostAllowed reports whether host is one of allowed or a subdomain of one.
+// Entries may be bare hosts or URLs; ports are ignored.
+func HostAllowed(host string, allowed []string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, a := range allowed {
+		if u, err := url.Parse(a); err == nil && u.Host != "" {
+			a = u.Hostname()
+		} else if h, _, err := net.SplitHostPort(a); err == nil {
+			a = h
+		}
+		a = strings.TrimSuffix(strings.TrimPrefix(strings.ToLower(a), "*."), ".")
+		if a != "" && (host == a || strings.HasSuffix(host, "."+a)) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewClient creates the HTTP client used by the req module for cfg.
+// Requests pass the host allowlist first, then the recorder, which sees them
+// unsigned so recordings match across signatures, and are signed last before
+// reaching Config.Transport or the network. Bodies are left undecoded, since
+// the req module decodes them itself and reports their charset.
+func NewClient(cfg Config) *req.Client {
+	client := req.C().DisableAutoDecode()
+	if cfg.Jar != nil {
+		client.SetCookieJar(cfg.Jar)
+	}
+	applyImpersonation(client, cfg.Impersonate)
+	applyProtocol(client, cfg.Protocol)
+	if len(cfg.Headers) > 0 {
+		client.SetCommonHeaders(cfg.Headers)
+	}
+	if cfg.UserAgent != "" {
+		client.SetUserAgent(cfg.UserAgent)
+	}
+	if cfg.Proxy != "" {
+		client.SetProxyURL(cfg.Proxy)
+	}
+	client.SetRedirectPolicy(redirectPolicy(cfg.MaxRedirects))
+	if cfg.Transport != nil {
+		client.Transport.WrapRoundTripFunc(func(http.RoundTripper) req.HttpRoundTripFunc {
+			return cfg.Transport.RoundTrip
+		})
+	}
+	if cfg.Signer != nil {
+		client.Transport.WrapRoundTripFunc(func(rt http.RoundTripper) req.HttpRoundTripFunc {
+			return func(r *http.Request) (*http.Response, error) {
+				signed := r.Clone(r.Context())
+				if err := cfg.Signer(signed); err != nil {
+					return nil, fmt.Errorf("signing request: %w", err)
+				}
+				return rt.RoundTrip(signed)
+			}
+		})
+	}
+	if cfg.Recorder != nil {
+		client.Transport.WrapRoundTripFunc(cfg.Recorder.wrap)
+	}
+	if len(cfg.AllowedHosts) > 0 {
+		client.Transport.WrapRoundTripFunc(func(rt http.RoundTripper) req.HttpRoundTripFunc {
+			return func(r *http.Request) (*http.Response, error) {
+				if !HostAllowed(r.URL.Hostname(), cfg.AllowedHosts) {
+					return nil, fmt.Errorf("%w: %s", ErrHostNotAllowed, r.URL.Hostname())
+				}
+				return rt.RoundTrip(r)
+			}
+		})
+	}
+	return client
+}
+
+func reqModule(inv *Invocation) map[string]tengo.Object {
+	attrs := map[string]tengo.Object{
 		"get": &tengo.UserFunction{
 			Name: "get",
 			Value: func(args ...tengo.Object) (tengo.Object, error) {
-				if len(args) != 1 {
-					return nil, fmt.Errorf("http.get: expected 1 argument")
+				urlStr, opts, err := urlArgs("http.get", args, inv.Config)
+				if err != nil {
+					return nil, err
 				}
-				urlStr, ok := args[0].(*tengo.String)
-				if !ok {
-					return nil, fmt.Errorf("http.get: argument must be a string")
+				return inv.get(urlStr, opts)
+			},
+		},
+		"get_json": &tengo.UserFunction{
+			Name: "get_json",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				urlStr, opts, err := urlArgs("http.get_json", args, inv.Config)
+				if err != nil {
+					return nil, err
 				}
-				headers := map[string]string{}
-				if len(args) == 2 {
-					hdrMap, ok := args[1].(*tengo.Map)
-					if !ok {
-						return nil, fmt.Errorf("http.get: second argument must be a map")
-					}
-					for k, v := range hdrMap.Value {
-						headers[k] = strings.Trim(v.String(), `"`)
-					}
+				if opts.stream || opts.bytes {
+					return nil, fmt.Errorf("http.get_json: the stream and bytes options are not supported")
 				}
-				var r *req.Response
-				var err error
-				for i := range 2 {
-					r, err = client.R().SetHeaders(headers).Get(urlStr.Value)
-					if err != nil {
-						logger.Warn("http.get: retry", "attempt", i+1, "error", err)
-						continue
-					}
-					break
+				res, err := inv.get(urlStr, opts)
+				if err != nil {
+					return nil, err
+				}
+				m := res.(*tengo.Map)
+				if status := m.Value["status"].(*tengo.Int).Value; status >= 400 {
+					return nil, fmt.Errorf("http.get_json: %s: status %d", urlStr, status)
+				}
+				if v, ok := m.Value["json"]; ok {
+					return v, nil
+				}
+				body, ok := m.Value["body"].(*tengo.String)
+				if !ok {
+					return nil, fmt.Errorf("http.get_json: %s: body is not text", urlStr)
 				}
+				v, err := json.Decode([]byte(body.Value))
 				if err != nil {
-					return nil, fmt.Errorf("http.get: %w", err)
+					return nil, fmt.Errorf("http.get_json: %s: %w", urlStr, err)
+				}
+				return v, nil
+			},
+		},
+		"head":           urlOnlyFunc(inv, http.MethodHead),
+		"delete":         urlOnlyFunc(inv, http.MethodDelete),
+		"post":           bodyFunc(inv, http.MethodPost),
+		"put":            bodyFunc(inv, http.MethodPut),
+		"patch":          bodyFunc(inv, http.MethodPatch),
+		"post_form":      postFormFunc(inv),
+		"post_multipart": postMultipartFunc(inv),
+		"download":       downloadFunc(inv),
+		"get_all":        getAllFunc(inv),
+		"identity":       identityFunc(inv),
+		"set_impersonate": &tengo.UserFunction{
+			Name: "set_impersonate",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 1 {
+					return nil, fmt.Errorf("http.set_impersonate: expected 1 argument")
+				}
+				name, ok := args[0].(*tengo.String)
+				if !ok {
+					return nil, fmt.Errorf("http.set_impersonate: argument must be a string")
 				}
-				result := map[string]tengo.Object{
-					"status":  &tengo.Int{Value: int64(r.Response.StatusCode)},
-					"body":    &tengo.String{Value: r.String()},
-					"headers": convertHeaders(r.Response.Header),
+				if !slices.Contains(Impersonations, name.Value) {
+					return nil, fmt.Errorf("http.set_impersonate: unknown profile '%s'", name.Value)
 				}
-				return &tengo.Map{Value: result}, nil
+				inv.impersonate(name.Value)
+				return tengo.UndefinedValue, nil
 			},
 		},
-		"post": &tengo.UserFunction{
-			Name: "post",
+		"request": &tengo.UserFunction{
+			Name: "request",
 			Value: func(args ...tengo.Object) (tengo.Object, error) {
-				if len(args) < 2 || len(args) > 3 {
-					return nil, fmt.Errorf("http.post: expected 2 or 3 arguments")
+				if len(args) != 1 {
+					return nil, fmt.Errorf("http.request: expected 1 argument")
 				}
-				urlStr, ok := args[0].(*tengo.String)
+				m, ok := args[0].(*tengo.Map)
 				if !ok {
-					return nil, fmt.Errorf("http.post: first argument must be a string")
+					return nil, fmt.Errorf("http.request: argument must be a map")
 				}
-				dataStr, ok := args[1].(*tengo.String)
+				urlStr, ok := m.Value["url"].(*tengo.String)
 				if !ok {
-					return nil, fmt.Errorf("http.post: second argument must be a string")
+					return nil, fmt.Errorf("http.request: url must be a string")
 				}
-				headers := map[string]string{}
-				if len(args) == 3 {
-					hdrMap, ok := args[2].(*tengo.Map)
+				method := http.MethodGet
+				if v, ok := m.Value["method"]; ok {
+					s, ok := v.(*tengo.String)
 					if !ok {
-						return nil, fmt.Errorf("http.post: third argument must be a map")
-					}
-					for k, v := range hdrMap.Value {
-						headers[k] = strings.Trim(v.String(), `"`)
+						return nil, fmt.Errorf("http.request: method must be a string")
 					}
+					method = strings.ToUpper(s.Value)
 				}
-				var r *req.Response
-				var err error
-				for i := range 2 {
-					r, err = client.R().SetHeaders(headers).SetBody(dataStr.Value).Post(urlStr.Value)
-					if err != nil {
-						logger.Warn("http.post: retry", "attempt", i+1, "error", err)
-						continue
-					}
-					break
-				}
+				opts, err := parseRequestOptions("http.request", m, inv.Config)
 				if err != nil {
-					return nil, fmt.Errorf("http.post: %w", err)
+					return nil, err
 				}
-				result := map[string]tengo.Object{
-					"status":  &tengo.Int{Value: int64(r.Response.StatusCode)},
-					"body":    &tengo.String{Value: r.String()},
-					"headers": convertHeaders(r.Response.Header),
+				if method == http.MethodGet && opts.body == nil {
+					return inv.get(urlStr.Value, opts)
 				}
-				return &tengo.Map{Value: result}, nil
+				return inv.send("http.request", method, urlStr.Value, opts)
 			},
 		},
 	}
+	maps.Copy(attrs, authFuncs(inv))
+	return attrs
+}
+
+// defaultGetAllConcurrency is the number of GETs req.get_all has in flight
+// when the concurrency option is unset.
+const defaultGetAllConcurrency = 4
+
+// getAllFunc implements req.get_all(urls[, options]): it GETs every URL of
+// urls with at most options.concurrency requests in flight and returns the
+// responses in the order of urls. The other options apply to every request.
+// A failed request yields an error in its slot instead of failing the call,
+// so scripts can check each entry with is_error.
+func getAllFunc(inv *Invocation) *tengo.UserFunction {
+	const fn = "http.get_all"
+	return &tengo.UserFunction{
+		Name: "get_all",
+		Value: func(args ...tengo.Object) (tengo.Object, error) {
+			if len(args) < 1 || len(args) > 2 {
+				return nil, fmt.Errorf("%s: expected 1 or 2 arguments", fn)
+			}
+			arr, ok := args[0].(*tengo.Array)
+			if !ok {
+				return nil, fmt.Errorf("%s: first argument must be an array", fn)
+			}
+			urls := make([]string, len(arr.Value))
+			for i, v := range arr.Value {
+				s, ok := v.(*tengo.String)
+				if !ok {
+					return nil, fmt.Errorf("%s: urls[%d] must be a string", fn, i)
+				}
+				urls[i] = s.Value
+			}
+			var optArg tengo.Object
+			if len(args) == 2 {
+				optArg = args[1]
+			}
+			opts, err := parseRequestOptions(fn, optArg, inv.Config)
+			if err != nil {
+				return nil, err
+			}
+			concurrency := defaultGetAllConcurrency
+			if m, ok := optArg.(*tengo.Map); ok {
+				if v, ok := m.Value["concurrency"]; ok {
+					n, ok := tengo.ToInt(v)
+					if !ok || n < 1 {
+						return nil, fmt.Errorf("%s: options.concurrency must be a positive int", fn)
+					}
+					concurrency = n
+				}
+			}
+			out := make([]tengo.Object, len(urls))
+			sem := make(chan struct{}, concurrency)
+			var wg sync.WaitGroup
+			for i, u := range urls {
+				wg.Add(1)
+				sem <- struct{}{}
+				go func() {
+					defer wg.Done()
+					defer func() { <-sem }()
+					res, err := inv.get(u, opts)
+					if err != nil {
+						res = &tengo.Error{Value: &tengo.String{Value: err.Error()}}
+					}
+					out[i] = res
+				}()
+			}
+			wg.Wait()
+			return &tengo.Array{Value: out}, nil
+		},
+	}
+}
+
+// get sends a GET of rawURL, answering it from the memoized response of an
+// identical earlier GET when memoization is on.
+func (inv *Invocation) get(rawURL string, opts requestOptions) (tengo.Object, error) {
+	if opts.auth == nil {
+		opts.auth = inv.requestAuth()
+	}
+	key := getMemoKey(rawURL, opts)
+	seenURL := rawURL
+	if len(opts.query) > 0 {
+		query := make(url.Values, len(opts.query))
+		for k, v := range opts.query {
+			query.Set(k, v)
+		}
+		seenURL += "?" + query.Encode()
+	}
+	if res, ok := inv.seenGet(seenURL, key); ok && !opts.stream {
+		return res, nil
+	}
+	res, err := inv.send("http.get", http.MethodGet, rawURL, opts)
+	if err == nil && !opts.stream {
+		inv.memoize(key, res)
+	}
+	return res, err
+}
+
+// send sends a method request to rawURL with opts.
+func (inv *Invocation) send(fn, method, rawURL string, opts requestOptions) (tengo.Object, error) {
+	return doRequest(fn, method, rawURL, inv, opts, func(r *req.Request) (*req.Response, error) {
+		return r.Send(method, rawURL)
+	})
+}
+
+// urlArgs reads the (url[, options]) arguments of fn.
+func urlArgs(fn string, args []tengo.Object, cfg Config) (string, requestOptions, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return "", requestOptions{}, fmt.Errorf("%s: expected 1 or 2 arguments", fn)
+	}
+	urlStr, ok := args[0].(*tengo.String)
+	if !ok {
+		return "", requestOptions{}, fmt.Errorf("%s: first argument must be a string", fn)
+	}
+	var optArg tengo.Object
+	if len(args) == 2 {
+		optArg = args[1]
+	}
+	opts, err := parseRequestOptions(fn, optArg, cfg)
+	return urlStr.Value, opts, err
+}
+
+// urlOnlyFunc returns the function of a method taking (url[, options]),
+// such as head and delete.
+func urlOnlyFunc(inv *Invocation, method string) *tengo.UserFunction {
+	name := strings.ToLower(method)
+	fn := "http." + name
+	return &tengo.UserFunction{
+		Name: name,
+		Value: func(args ...tengo.Object) (tengo.Object, error) {
+			urlStr, opts, err := urlArgs(fn, args, inv.Config)
+			if err != nil {
+				return nil, err
+			}
+			return inv.send(fn, method, urlStr, opts)
+		},
+	}
+}
+
+// bodyFunc returns the function of a method taking (url, body[, headers[,
+// options]]), such as post, put and patch.
+func bodyFunc(inv *Invocation, method string) *tengo.UserFunction {
+	name := strings.ToLower(method)
+	fn := "http." + name
+	return &tengo.UserFunction{
+		Name: name,
+		Value: func(args ...tengo.Object) (tengo.Object, error) {
+			if len(args) < 2 || len(args) > 4 {
+				return nil, fmt.Errorf("%s: expected 2 to 4 arguments", fn)
+			}
+			urlStr, ok := args[0].(*tengo.String)
+			if !ok {
+				return nil, fmt.Errorf("%s: first argument must be a string", fn)
+			}
+			body, err := scriptBody(args[1])
+			if err != nil {
+				return nil, fmt.Errorf("%s: second argument %w", fn, err)
+			}
+			opts, err := headersAndOptions(fn, args[2:], "third", inv.Config)
+			if err != nil {
+				return nil, err
+			}
+			opts.body = body
+			return inv.send(fn, method, urlStr.Value, opts)
+		},
+	}
 }
 
 // convertHeaders converts http.Header to a Tengo map.
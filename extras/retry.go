@@ -0,0 +1,151 @@
+package extras
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/d5/tengo/v2"
+)
+
+// RetryPolicy controls how the req module retries failed requests. Requests
+// failing with a transport error, or answered with one of Statuses, are
+// sent again after an exponential backoff: BaseDelay, doubled after every
+// attempt up to MaxDelay. A Retry-After header on a retried response is
+// honored, up to MaxDelay. Zero numeric fields and a nil Statuses take the
+// values of DefaultRetryPolicy.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts, the first one included.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// NoJitter turns off the randomization of every delay between half and
+	// all of it, which keeps clients from retrying in lockstep.
+	NoJitter bool
+	// Statuses are the response statuses that are retried, e.g. 429 and
+	// 503.
+	Statuses []int
+}
+
+// DefaultRetryPolicy is the retry policy of engines that set none: two
+// attempts, half a second apart, retrying 429 and 503 responses.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 2,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+	Statuses:    []int{http.StatusTooManyRequests, http.StatusServiceUnavailable},
+}
+
+// withDefaults returns p with its zero fields set from DefaultRetryPolicy.
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	d := DefaultRetryPolicy
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = d.MaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = d.BaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = d.MaxDelay
+	}
+	if p.Statuses == nil {
+		p.Statuses = d.Statuses
+	}
+	return p
+}
+
+// retryStatus reports whether responses with status are retried.
+func (p RetryPolicy) retryStatus(status int) bool {
+	return slices.Contains(p.Statuses, status)
+}
+
+// delay returns how long to wait before the attempt following attempt
+// (counted from 1), given the Retry-After header of the failed response.
+func (p RetryPolicy) delay(attempt int, retryAfter string) time.Duration {
+	d := p.BaseDelay << min(attempt-1, 30)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if !p.NoJitter {
+		d = d/2 + rand.N(d/2+1)
+	}
+	if after, ok := parseRetryAfter(retryAfter); ok {
+		d = min(max(d, after), p.MaxDelay)
+	}
+	return d
+}
+
+// parseRetryAfter parses a Retry-After header, either seconds or an HTTP
+// date.
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// wait sleeps for d or until ctx is done.
+func wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// parseRetryOptions applies the retry map of a request's options
+// ({attempts, backoff_ms, max_backoff_ms, jitter, statuses}) to p.
+func parseRetryOptions(fn string, obj tengo.Object, p *RetryPolicy) error {
+	m, ok := obj.(*tengo.Map)
+	if !ok {
+		return fmt.Errorf("%s: options.retry must be a map", fn)
+	}
+	for key, v := range m.Value {
+		switch key {
+		case "attempts", "backoff_ms", "max_backoff_ms":
+			n, ok := tengo.ToInt(v)
+			if !ok || n < 1 {
+				return fmt.Errorf("%s: options.retry.%s must be a positive number", fn, key)
+			}
+			switch key {
+			case "attempts":
+				p.MaxAttempts = n
+			case "backoff_ms":
+				p.BaseDelay = time.Duration(n) * time.Millisecond
+			default:
+				p.MaxDelay = time.Duration(n) * time.Millisecond
+			}
+		case "jitter":
+			p.NoJitter = v.IsFalsy()
+		case "statuses":
+			arr, ok := v.(*tengo.Array)
+			if !ok {
+				return fmt.Errorf("%s: options.retry.statuses must be an array", fn)
+			}
+			p.Statuses = make([]int, 0, len(arr.Value))
+			for _, s := range arr.Value {
+				status, ok := tengo.ToInt(s)
+				if !ok {
+					return fmt.Errorf("%s: options.retry.statuses must hold numbers", fn)
+				}
+				p.Statuses = append(p.Statuses, status)
+			}
+		default:
+			return fmt.Errorf("%s: unknown option retry.%s", fn, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package extras
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// DefaultAllowedTags are the tags SanitizeHTML keeps when given none: text
+// formatting, headings, lists, links and images, as most readers render.
+var DefaultAllowedTags = []string{
+	"p", "br", "hr", "b", "strong", "i", "em", "u", "s", "del", "sub", "sup",
+	"blockquote", "pre", "code", "h1", "h2", "h3", "h4", "h5", "h6",
+	"ul", "ol", "li", "a", "img",
+}
+
+// allowedAttrs are the attributes kept on allowed tags; all others, event
+// handlers and styles included, are dropped.
+var allowedAttrs = map[string][]string{
+	"a":   {"href", "title"},
+	"img": {"src", "alt", "title"},
+}
+
+// droppedTags are removed together with their content instead of being
+// unwrapped.
+var droppedTags = []atom.Atom{
+	atom.Script, atom.Style, atom.Iframe, atom.Object, atom.Embed, atom.Noscript,
+	atom.Template, atom.Head, atom.Title, atom.Form, atom.Button, atom.Select,
+	atom.Textarea, atom.Svg, atom.Math,
+}
+
+// SanitizeHTML returns the HTML fragment src with only the allowed tags,
+// DefaultAllowedTags when allowed is empty. Other tags are unwrapped, keeping
+// their content, except scripts, styles, frames, forms and the like, which
+// are removed whole. Comments and attributes other than the href of links
+// and the src and alt of images are dropped, as are URLs with schemes other
+// than http and https.
+func SanitizeHTML(src string, allowed ...string) (string, error) {
+	if len(allowed) == 0 {
+		allowed = DefaultAllowedTags
+	}
+	nodes, err := parseFragment(src)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, n := range nodes {
+		renderSanitized(&b, n, allowed)
+	}
+	return b.String(), nil
+}
+
+// HTMLToText returns the text of the HTML fragment src: blocks become
+// paragraphs separated by blank lines, line breaks become newlines and
+// other whitespace is collapsed. Content removed by SanitizeHTML, such as
+// scripts, is left out.
+func HTMLToText(src string) (string, error) {
+	nodes, err := parseFragment(src)
+	if err != nil {
+		return "", err
+	}
+	var t textWriter
+	for _, n := range nodes {
+		t.walk(n)
+	}
+	return t.String(), nil
+}
+
+// parseFragment parses src as the content of a body element.
+func parseFragment(src string) ([]*html.Node, error) {
+	return html.ParseFragment(strings.NewReader(src), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+}
+
+// renderSanitized writes n to b, keeping only the allowed tags.
+func renderSanitized(b *strings.Builder, n *html.Node, allowed []string) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(html.EscapeString(n.Data))
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if slices.Contains(droppedTags, n.DataAtom) {
+		return
+	}
+	keep := slices.Contains(allowed, n.Data)
+	if keep {
+		b.WriteString("<" + n.Data)
+		for _, a := range n.Attr {
+			if a.Namespace == "" && slices.Contains(allowedAttrs[n.Data], a.Key) && safeAttr(a) {
+				b.WriteString(" " + a.Key + `="` + html.EscapeString(a.Val) + `"`)
+			}
+		}
+		b.WriteString(">")
+		if voidElement(n.DataAtom) {
+			return
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		renderSanitized(b, c, allowed)
+	}
+	if keep {
+		b.WriteString("</" + n.Data + ">")
+	}
+}
+
+// safeAttr reports whether a is safe to keep: URLs must be relative or use
+// http or https.
+func safeAttr(a html.Attribute) bool {
+	if a.Key != "href" && a.Key != "src" {
+		return true
+	}
+	u, err := url.Parse(strings.TrimSpace(a.Val))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https":
+		return true
+	}
+	return false
+}
+
+// voidElement reports whether tags of a have no content or end tag.
+func voidElement(a atom.Atom) bool {
+	switch a {
+	case atom.Br, atom.Hr, atom.Img, atom.Wbr:
+		return true
+	}
+	return false
+}
+
+// blockElement reports whether tags of a start a new paragraph in text.
+func blockElement(a atom.Atom) bool {
+	switch a {
+	case atom.P, atom.Div, atom.Blockquote, atom.Pre, atom.Ul, atom.Ol, atom.Li,
+		atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Hr,
+		atom.Table, atom.Tr, atom.Section, atom.Article, atom.Header, atom.Footer:
+		return true
+	}
+	return false
+}
+
+// textWriter accumulates the text of HTML nodes for HTMLToText.
+type textWriter struct {
+	paragraphs []string
+	current    strings.Builder
+}
+
+func (t *textWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		t.current.WriteString(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if slices.Contains(droppedTags, n.DataAtom) {
+		return
+	}
+	if n.DataAtom == atom.Br {
+		t.current.WriteString("\n")
+		return
+	}
+	block := blockElement(n.DataAtom)
+	if block {
+		t.flush()
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		t.walk(c)
+	}
+	if block {
+		t.flush()
+	}
+}
+
+// flush ends the current paragraph, collapsing the whitespace of each of
+// its lines.
+func (t *textWriter) flush() {
+	lines := strings.Split(t.current.String(), "\n")
+	t.current.Reset()
+	var kept []string
+	for _, line := range lines {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	if len(kept) > 0 {
+		t.paragraphs = append(t.paragraphs, strings.Join(kept, "\n"))
+	}
+}
+
+func (t *textWriter) String() string {
+	t.flush()
+	return strings.Join(t.paragraphs, "\n\n")
+}
@@ -0,0 +1,75 @@
+package extras
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/d5/tengo/v2"
+)
+
+// ankoResponseBody is an unread response body, returned by req functions
+// when the stream option is set. It can be consumed only once.
+type ankoResponseBody struct {
+	tengo.ObjectImpl
+	body   io.ReadCloser
+	cancel context.CancelFunc
+
+	mu   sync.Mutex
+	used bool
+}
+
+// newResponseBody returns body as a response-body object. A body still
+// unread when the invocation ends is closed then, releasing its connection.
+func newResponseBody(inv *Invocation, body io.ReadCloser, cancel context.CancelFunc) *ankoResponseBody {
+	b := &ankoResponseBody{body: body, cancel: cancel}
+	context.AfterFunc(inv.Context, b.release)
+	return b
+}
+
+// release closes the body unless it was handed out.
+func (b *ankoResponseBody) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.used {
+		return
+	}
+	b.used = true
+	b.body.Close()
+	b.cancel()
+}
+
+func (b *ankoResponseBody) TypeName() string {
+	return "response-body"
+}
+
+func (b *ankoResponseBody) String() string {
+	return "<response-body>"
+}
+
+func (b *ankoResponseBody) Copy() tengo.Object {
+	return b
+}
+
+// take hands out the body stream. Closing it also releases the request
+// context.
+func (b *ankoResponseBody) take() (io.ReadCloser, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.used {
+		return nil, errors.New("response body already consumed")
+	}
+	b.used = true
+	return &streamReader{ReadCloser: b.body, cancel: b.cancel}, nil
+}
+
+type streamReader struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r *streamReader) Close() error {
+	defer r.cancel()
+	return r.ReadCloser.Close()
+}
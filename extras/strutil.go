@@ -0,0 +1,126 @@
+package extras
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/d5/tengo/v2"
+)
+
+// DefaultEllipsis is appended by Truncate when the script gives none.
+const DefaultEllipsis = "…"
+
+// strutilModule implements the strutil module.
+func strutilModule(_ *Invocation) map[string]tengo.Object {
+	return map[string]tengo.Object{
+		"truncate": &tengo.UserFunction{
+			Name: "truncate",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) < 2 || len(args) > 3 {
+					return nil, fmt.Errorf("strutil.truncate: expected 2 or 3 arguments")
+				}
+				s, ok := args[0].(*tengo.String)
+				if !ok {
+					return nil, fmt.Errorf("strutil.truncate: first argument must be a string")
+				}
+				n, ok := tengo.ToInt(args[1])
+				if !ok || n < 0 {
+					return nil, fmt.Errorf("strutil.truncate: second argument must be a non-negative int")
+				}
+				ellipsis := DefaultEllipsis
+				if len(args) == 3 {
+					e, ok := args[2].(*tengo.String)
+					if !ok {
+						return nil, fmt.Errorf("strutil.truncate: third argument must be a string")
+					}
+					ellipsis = e.Value
+				}
+				return &tengo.String{Value: Truncate(s.Value, n, ellipsis)}, nil
+			},
+		},
+		"summarize": &tengo.UserFunction{
+			Name: "summarize",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) != 2 {
+					return nil, fmt.Errorf("strutil.summarize: expected 2 arguments")
+				}
+				s, ok := args[0].(*tengo.String)
+				if !ok {
+					return nil, fmt.Errorf("strutil.summarize: first argument must be a string")
+				}
+				n, ok := tengo.ToInt(args[1])
+				if !ok || n < 0 {
+					return nil, fmt.Errorf("strutil.summarize: second argument must be a non-negative int")
+				}
+				return &tengo.String{Value: Summarize(s.Value, n)}, nil
+			},
+		},
+	}
+}
+
+// Truncate shortens s to at most n runes, ellipsis included, never splitting
+// a multibyte character. The cut falls on the last word boundary when there
+// is one in the second half of the kept text, as there is not in text
+// without spaces such as Chinese or Japanese. s is returned as is when it
+// fits.
+func Truncate(s string, n int, ellipsis string) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	keep := n - len([]rune(ellipsis))
+	if keep <= 0 {
+		return string([]rune(ellipsis)[:n])
+	}
+	cut := runes[:keep]
+	if !unicode.IsSpace(runes[keep]) {
+		for i := len(cut) - 1; i >= keep/2; i-- {
+			if unicode.IsSpace(cut[i]) {
+				cut = cut[:i]
+				break
+			}
+		}
+	}
+	return strings.TrimRightFunc(string(cut), func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r) && !strings.ContainsRune(sentenceEnds, r)
+	}) + ellipsis
+}
+
+// sentenceEnds are the runes ending a sentence, in Latin and CJK text.
+const sentenceEnds = ".!?。！？"
+
+// sentenceClosers may follow the end of a sentence before the space after
+// it, such as closing quotes.
+const sentenceClosers = `"')]”’」』】）`
+
+// Summarize returns the first n sentences of s, with its whitespace
+// collapsed. Latin sentences end with '.', '!' or '?' followed by a space,
+// CJK ones with '。', '！' or '？'; closing quotes and brackets stay with the
+// sentence they end.
+func Summarize(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	runes := []rune(strings.Join(strings.Fields(s), " "))
+	count := 0
+	for i := 0; i < len(runes) && count < n; i++ {
+		r := runes[i]
+		if !strings.ContainsRune(sentenceEnds, r) {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && (strings.ContainsRune(sentenceEnds, runes[end]) || strings.ContainsRune(sentenceClosers, runes[end])) {
+			end++
+		}
+		if r < unicode.MaxASCII && end < len(runes) && runes[end] != ' ' {
+			continue
+		}
+		count++
+		i = end - 1
+		if count == n {
+			return string(runes[:end])
+		}
+	}
+	return string(runes)
+}
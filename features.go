@@ -0,0 +1,59 @@
+package anko
+
+import (
+	"github.com/ancientcatz/anko/extras"
+	"github.com/d5/tengo/v2"
+)
+
+// Features describes what the host offers the source's rules, which see it
+// as the immutable map features:
+//
+//	if !features.browser_available { ... skip the JS-rendered fallback ... }
+//
+// so well-behaved sources can adapt instead of failing.
+type Features struct {
+	// BrowserAvailable reports that pages can be rendered with JavaScript.
+	// It is also set while a browser is configured (see SetBrowser).
+	BrowserAvailable bool
+	// OfflineMode reports that the network must not be used. It is also
+	// set while responses are only replayed (see SetHTTPRecorder).
+	OfflineMode bool
+	// MaxConcurrency is the number of the source's rules the host runs at
+	// once; zero falls back to the source's concurrency.max_parallel.
+	MaxConcurrency int
+}
+
+// SetFeatures sets the features the rules see. Cached compilations are
+// dropped so the next runs see them.
+func (e *Engine) SetFeatures(f Features) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.features = f
+	e.compiledCache.clear()
+}
+
+// createFeaturesVariable returns the features global of the rules. The
+// caller must hold e.mu.
+func (e *Engine) createFeaturesVariable() *tengo.ImmutableMap {
+	f := e.features
+	if rec := e.moduleConfig.Recorder; rec != nil && rec.Mode == extras.RecordReplay {
+		f.OfflineMode = true
+	}
+	if _, off := extras.UnavailableModules["browser"]; e.moduleConfig.Browser != nil && !off {
+		f.BrowserAvailable = true
+	}
+	if f.MaxConcurrency == 0 {
+		f.MaxConcurrency = e.Metadata.Concurrency.MaxParallel
+	}
+	flag := func(b bool) tengo.Object {
+		if b {
+			return tengo.TrueValue
+		}
+		return tengo.FalseValue
+	}
+	return &tengo.ImmutableMap{Value: map[string]tengo.Object{
+		"browser_available": flag(f.BrowserAvailable),
+		"offline_mode":      flag(f.OfflineMode),
+		"max_concurrency":   &tengo.Int{Value: int64(f.MaxConcurrency)},
+	}}
+}
@@ -0,0 +1,84 @@
+package anko
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// glossaryKey is the store key of the glossary of novel. The caller must
+// hold e.mu.
+func (e *Engine) glossaryKey(novel string) string {
+	return e.glossaryPrefix() + novel
+}
+
+// SetGlossary saves the glossary of novel, mapping names and terms as they
+// appear in the source's chapters to their preferred translations, in the
+// engine's Store. ContentRule replaces them in the title and content of
+// every chapter whose env sets novel to the same value, typically the
+// novel's URL. An empty glossary deletes it.
+func (e *Engine) SetGlossary(novel string, terms map[string]string) error {
+	e.mu.Lock()
+	store, key := e.store, e.glossaryKey(novel)
+	e.mu.Unlock()
+	if len(terms) == 0 {
+		return store.Save(key, nil)
+	}
+	data, err := json.Marshal(terms)
+	if err != nil {
+		return err
+	}
+	return store.Save(key, data)
+}
+
+// Glossary returns the glossary of novel saved with SetGlossary, or nil.
+func (e *Engine) Glossary(novel string) (map[string]string, error) {
+	e.mu.Lock()
+	store, key := e.store, e.glossaryKey(novel)
+	e.mu.Unlock()
+	data, ok, err := store.Load(key)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var terms map[string]string
+	if err := json.Unmarshal(data, &terms); err != nil {
+		return nil, fmt.Errorf("decoding glossary of '%s': %w", novel, err)
+	}
+	return terms, nil
+}
+
+// applyGlossary replaces the glossary terms of the novel named in envVars
+// in the title and content of a ContentRule result. Longer terms win over
+// the shorter terms they contain.
+func (e *Engine) applyGlossary(envVars, result map[string]any) error {
+	novel, _ := envVars["novel"].(string)
+	if novel == "" {
+		return nil
+	}
+	terms, err := e.Glossary(novel)
+	if err != nil {
+		return fmt.Errorf("ContentRule: %w", err)
+	}
+	if len(terms) == 0 {
+		return nil
+	}
+	keys := slices.SortedFunc(maps.Keys(terms), func(a, b string) int {
+		return cmp.Or(cmp.Compare(len(b), len(a)), strings.Compare(a, b))
+	})
+	pairs := make([]string, 0, 2*len(keys))
+	for _, k := range keys {
+		if k != "" {
+			pairs = append(pairs, k, terms[k])
+		}
+	}
+	r := strings.NewReplacer(pairs...)
+	for _, key := range []string{"title", "content"} {
+		if s, ok := result[key].(string); ok {
+			result[key] = r.Replace(s)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package anko
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrorHint is a machine-readable suggestion of what to do about an error,
+// for hosts that show actionable messages instead of raw script errors.
+// Where ErrorCode tells what failed, ErrorHint tells why it most likely did.
+// The values never change once released.
+type ErrorHint string
+
+// Error hints returned by Hint.
+const (
+	// HintNeedsBrowser means the site answered with an anti-bot challenge,
+	// such as Cloudflare's, which only a browser or a challenge solver (see
+	// SetChallengeSolver) gets past.
+	HintNeedsBrowser ErrorHint = "NEEDS_BROWSER"
+	// HintNovelRemoved means the page of the novel or chapter is gone: the
+	// site answered 404 Not Found or 410 Gone.
+	HintNovelRemoved ErrorHint = "NOVEL_REMOVED"
+	// HintSourceBroken means the source no longer matches the site, e.g. its
+	// selectors find nothing and its rules return incomplete results or none,
+	// and needs an update.
+	HintSourceBroken ErrorHint = "SOURCE_BROKEN"
+	// HintRetryLater means the failure is likely temporary: a timeout, a
+	// network error, rate limiting or a server error.
+	HintRetryLater ErrorHint = "RETRY_LATER"
+)
+
+// hintedError attaches an ErrorHint to an error without changing its message
+// or code.
+type hintedError struct {
+	hint ErrorHint
+	err  error
+}
+
+func (e *hintedError) Error() string { return e.err.Error() }
+func (e *hintedError) Unwrap() error { return e.err }
+
+// withHint attaches hint to err; a nil err or an empty hint leaves err as is.
+func withHint(hint ErrorHint, err error) error {
+	if err == nil || hint == "" {
+		return err
+	}
+	return &hintedError{hint: hint, err: err}
+}
+
+// Hint returns the hint of err: the one attached by the run that failed or,
+// without one, the hint implied by its code. It is empty when there is no
+// hint to give, e.g. for configuration errors, and for a nil error.
+func Hint(err error) ErrorHint {
+	if err == nil {
+		return ""
+	}
+	var he *hintedError
+	if errors.As(err, &he) {
+		return he.hint
+	}
+	return classifyFailure(Code(err), runSignals{})
+}
+
+// runSignals are the signatures of a failure a run leaves in its
+// invocation: the status of its latest response and whether that was an
+// unsolved challenge page.
+type runSignals struct {
+	status     int
+	challenged bool
+}
+
+type signalsKey struct{}
+
+// withSignals returns a context under which runSingle records the signals
+// of its runs in the returned runSignals, latest run last.
+func withSignals(ctx context.Context) (context.Context, *runSignals) {
+	s := new(runSignals)
+	return context.WithValue(ctx, signalsKey{}, s), s
+}
+
+// hint attaches to err the hint classifying it with the signals of the
+// latest run, unless it has one.
+func (s *runSignals) hint(err error) error {
+	var he *hintedError
+	if err == nil || errors.As(err, &he) {
+		return err
+	}
+	return withHint(classifyFailure(Code(err), *s), err)
+}
+
+// classifyFailure returns the hint for a failure with code after a run with
+// signals s. For failures of the rule itself, the response it saw last is
+// the strongest sign: a rule fails on a challenge or a missing page however
+// well it matches the site.
+func classifyFailure(code ErrorCode, s runSignals) ErrorHint {
+	switch code {
+	case CodeRuntime, CodeNoResult, CodeValidationMissingKey, CodeValidationType:
+		switch {
+		case s.challenged:
+			return HintNeedsBrowser
+		case s.status == http.StatusNotFound || s.status == http.StatusGone:
+			return HintNovelRemoved
+		case s.status == http.StatusTooManyRequests || s.status >= 500:
+			return HintRetryLater
+		}
+		return HintSourceBroken
+	case CodeCompile:
+		return HintSourceBroken
+	case CodeHTTP, CodeHTTPTimeout, CodeRuleTimeout:
+		return HintRetryLater
+	}
+	return ""
+}
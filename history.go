@@ -0,0 +1,92 @@
+package anko
+
+import "time"
+
+// defaultHistorySize is the number of runs kept per rule unless changed with
+// SetHistorySize.
+const defaultHistorySize = 32
+
+// RunReport describes a single finished run of a rule.
+type RunReport struct {
+	Rule     string
+	Started  time.Time
+	Duration time.Duration
+	// Error is the error message of a failed run, Code its ErrorCode and
+	// Hint its ErrorHint; all are empty for successful runs.
+	Error string
+	Code  ErrorCode
+	Hint  ErrorHint
+	Slow  bool
+}
+
+// runHistory is a ring buffer of the latest reports of one rule. It is
+// guarded by Engine.mu.
+type runHistory struct {
+	reports []RunReport
+	next    int
+	full    bool
+}
+
+func (h *runHistory) add(r RunReport) {
+	h.reports[h.next] = r
+	h.next = (h.next + 1) % len(h.reports)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// latest returns up to n reports, newest first.
+func (h *runHistory) latest(n int) []RunReport {
+	count := h.next
+	if h.full {
+		count = len(h.reports)
+	}
+	n = min(n, count)
+	out := make([]RunReport, n)
+	for i := range out {
+		out[i] = h.reports[(h.next-1-i+len(h.reports))%len(h.reports)]
+	}
+	return out
+}
+
+// History returns the reports of the latest n runs of ruleName, newest
+// first. At most the history size (see SetHistorySize) is kept per rule.
+func (e *Engine) History(ruleName string, n int) []RunReport {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	h, ok := e.history[ruleName]
+	if !ok || n <= 0 {
+		return nil
+	}
+	return h.latest(n)
+}
+
+// SetHistorySize sets how many runs History keeps per rule, dropping the
+// history recorded so far. Zero disables the history; negative values
+// restore the default.
+func (e *Engine) SetHistorySize(n int) {
+	if n < 0 {
+		n = defaultHistorySize
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.historySize = n
+	e.history = nil
+}
+
+// recordHistory adds r to the history of its rule. The caller must hold
+// e.mu.
+func (e *Engine) recordHistory(r RunReport) {
+	if e.historySize == 0 {
+		return
+	}
+	if e.history == nil {
+		e.history = make(map[string]*runHistory)
+	}
+	h, ok := e.history[r.Rule]
+	if !ok {
+		h = &runHistory{reports: make([]RunReport, e.historySize)}
+		e.history[r.Rule] = h
+	}
+	h.add(r)
+}
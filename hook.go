@@ -0,0 +1,99 @@
+package anko
+
+import (
+	"slices"
+	"time"
+
+	"github.com/ancientcatz/anko/extras"
+)
+
+// Hook observes rule runs, e.g. for metrics or auditing. BeforeRun is called
+// with the merged env once the rule is ready to run and may add or change
+// entries to inject per-run values. AfterRun is called after every run,
+// including failed compilations, with the value of "result" (nil on error)
+// and the time taken.
+//
+// Hooks are called synchronously on the goroutine running the rule, so they
+// must be safe for concurrent use when rules run concurrently.
+type Hook interface {
+	BeforeRun(rule string, env map[string]any)
+	AfterRun(rule string, result any, err error, duration time.Duration)
+}
+
+// HookFuncs adapts a pair of functions to the Hook interface. Either may be
+// nil.
+type HookFuncs struct {
+	Before func(rule string, env map[string]any)
+	After  func(rule string, result any, err error, duration time.Duration)
+}
+
+// BeforeRun calls h.Before when set.
+func (h HookFuncs) BeforeRun(rule string, env map[string]any) {
+	if h.Before != nil {
+		h.Before(rule, env)
+	}
+}
+
+// AfterRun calls h.After when set.
+func (h HookFuncs) AfterRun(rule string, result any, err error, duration time.Duration) {
+	if h.After != nil {
+		h.After(rule, result, err, duration)
+	}
+}
+
+// Use adds hook to the hooks called around every rule run, in the order they
+// were added. Tenant engines created afterwards inherit the hooks.
+func (e *Engine) Use(hook Hook) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.hooks = append(slices.Clip(e.hooks), hook)
+}
+
+// CompileHook is implemented by hooks that want to observe rule
+// compilations. AfterCompile is called with the engine lock held, so it must
+// not call back into the engine.
+type CompileHook interface {
+	AfterCompile(rule string, duration time.Duration, err error)
+}
+
+// RequestHook is implemented by hooks that want to observe every request
+// attempt made by the req module of the engine's rules.
+type RequestHook interface {
+	AfterRequest(info extras.RequestInfo)
+}
+
+// observeRequest records the time of the request for the reaper and passes
+// info to the hooks implementing RequestHook.
+func (e *Engine) observeRequest(info extras.RequestInfo) {
+	e.lastRequest.Store(time.Now().UnixNano())
+	e.mu.Lock()
+	hooks := e.hooks
+	e.mu.Unlock()
+	for _, h := range hooks {
+		if rh, ok := h.(RequestHook); ok {
+			rh.AfterRequest(info)
+		}
+	}
+}
+
+// DownloadHook is implemented by hooks that want to follow the progress of
+// the files downloaded by rules with req.download.
+type DownloadHook interface {
+	DownloadProgress(info extras.DownloadInfo)
+}
+
+// observeDownload passes info to the hooks implementing DownloadHook and
+// trims the caches once a download has completed.
+func (e *Engine) observeDownload(info extras.DownloadInfo) {
+	if info.Done && info.Err == nil {
+		defer e.trimCache()
+	}
+	e.mu.Lock()
+	hooks := e.hooks
+	e.mu.Unlock()
+	for _, h := range hooks {
+		if dh, ok := h.(DownloadHook); ok {
+			dh.DownloadProgress(info)
+		}
+	}
+}
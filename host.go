@@ -0,0 +1,48 @@
+package anko
+
+import (
+	"fmt"
+
+	"github.com/d5/tengo/v2"
+)
+
+// HostFunc is a Go callback exposed to scripts through the host map.
+// Arguments and the return value are converted between Tengo and Go values.
+type HostFunc func(args ...any) (any, error)
+
+// WithHostFunction exposes fn to every rule as host.<name>, e.g. host.notify
+// or host.prompt for asking the user for a captcha answer mid-rule.
+func WithHostFunction(name string, fn HostFunc) Option {
+	return func(e *Engine) {
+		if e.hostFuncs == nil {
+			e.hostFuncs = make(map[string]HostFunc)
+		}
+		e.hostFuncs[name] = fn
+	}
+}
+
+// createHostVariable wraps the registered host callbacks into a Tengo
+// ImmutableMap of user functions.
+func createHostVariable(funcs map[string]HostFunc, converters []Converter) *tengo.ImmutableMap {
+	m := make(map[string]tengo.Object, len(funcs))
+	for name, fn := range funcs {
+		m[name] = &tengo.UserFunction{
+			Name: name,
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				goArgs := make([]any, len(args))
+				for i, arg := range args {
+					goArgs[i] = tengo.ToInterface(arg)
+				}
+				res, err := fn(goArgs...)
+				if err != nil {
+					return nil, fmt.Errorf("host.%s: %w", name, err)
+				}
+				if res == nil {
+					return tengo.UndefinedValue, nil
+				}
+				return newConversion(converters).object(res, 0), nil
+			},
+		}
+	}
+	return &tengo.ImmutableMap{Value: m}
+}
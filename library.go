@@ -0,0 +1,65 @@
+package anko
+
+import "fmt"
+
+// Library is implemented by an embedding reader's database so anko can
+// write novels and chapters into it directly.
+type Library interface {
+	AddNovel(sourceID string, info NovelInfo) error
+	UpdateChapters(sourceID, novelURL string, chapters []Chapter) error
+	MarkRead(sourceID, chapterURL string) error
+}
+
+// LibrarySync pushes the results of an Engine's rules into a Library.
+// Schedulers hold one per source and call Sync or PushChapters on updates.
+type LibrarySync struct {
+	Engine  *Engine
+	Library Library
+}
+
+// NewLibrarySync creates a LibrarySync for the given engine and library.
+func NewLibrarySync(e *Engine, lib Library) *LibrarySync {
+	return &LibrarySync{Engine: e, Library: lib}
+}
+
+// Sync runs the info and chapter-list rules for novelURL and stores both
+// results in the library.
+func (s *LibrarySync) Sync(novelURL string) error {
+	env := map[string]any{"url": novelURL}
+	infoMap, err := s.Engine.NovelInfoRule(env)
+	if err != nil {
+		return fmt.Errorf("library sync: %w", err)
+	}
+	info := NewNovelInfo(infoMap)
+	if info.URL == "" {
+		info.URL = novelURL
+	}
+	if err := s.Library.AddNovel(s.sourceID(), info); err != nil {
+		return withCode(CodeLibrarySync, fmt.Errorf("library sync: add novel: %w", err))
+	}
+	items, err := s.Engine.ChapterListRule(env)
+	if err != nil {
+		return fmt.Errorf("library sync: %w", err)
+	}
+	return s.PushChapters(novelURL, NewChapters(items))
+}
+
+// PushChapters stores an already fetched chapter list for novelURL.
+func (s *LibrarySync) PushChapters(novelURL string, chapters []Chapter) error {
+	if err := s.Library.UpdateChapters(s.sourceID(), novelURL, chapters); err != nil {
+		return withCode(CodeLibrarySync, fmt.Errorf("library sync: update chapters: %w", err))
+	}
+	return nil
+}
+
+// MarkRead marks a chapter of this source as read in the library.
+func (s *LibrarySync) MarkRead(chapterURL string) error {
+	if err := s.Library.MarkRead(s.sourceID(), chapterURL); err != nil {
+		return withCode(CodeLibrarySync, fmt.Errorf("library sync: mark read: %w", err))
+	}
+	return nil
+}
+
+func (s *LibrarySync) sourceID() string {
+	return s.Engine.Metadata.Identifier
+}
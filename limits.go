@@ -0,0 +1,96 @@
+package anko
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/d5/tengo/v2"
+)
+
+// Limits bound the resources a single rule run may use, so a runaway or
+// malicious rule cannot hang or exhaust the host. Zero fields are unlimited.
+//
+// MaxAllocs limits the objects the script may allocate and MaxConstObjects
+// the constants of its compiled form; both are enforced by Tengo.
+// MaxExecutionTime aborts the run once it has taken that long. MaxRequests
+// limits the req module request attempts of the run, retries included.
+type Limits struct {
+	MaxAllocs        int64         `yaml:"max_allocs"`
+	MaxConstObjects  int           `yaml:"max_const_objects"`
+	MaxExecutionTime time.Duration `yaml:"max_execution_time"`
+	MaxRequests      int           `yaml:"max_requests"`
+}
+
+// merge returns l with the non-zero fields of override applied.
+func (l Limits) merge(override *Limits) Limits {
+	if override == nil {
+		return l
+	}
+	if override.MaxAllocs != 0 {
+		l.MaxAllocs = override.MaxAllocs
+	}
+	if override.MaxConstObjects != 0 {
+		l.MaxConstObjects = override.MaxConstObjects
+	}
+	if override.MaxExecutionTime != 0 {
+		l.MaxExecutionTime = override.MaxExecutionTime
+	}
+	if override.MaxRequests != 0 {
+		l.MaxRequests = override.MaxRequests
+	}
+	return l
+}
+
+// apply sets the Tengo limits of l on script.
+func (l Limits) apply(script *tengo.Script) {
+	if l.MaxAllocs > 0 {
+		script.SetMaxAllocs(l.MaxAllocs)
+	}
+	if l.MaxConstObjects > 0 {
+		script.SetMaxConstObjects(l.MaxConstObjects)
+	}
+}
+
+// SetLimits sets the limits applied to every rule. A rule's limits section
+// overrides them field by field. Cached compilations are dropped so the new
+// limits apply to the next run.
+func (e *Engine) SetLimits(l Limits) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.limits = l
+	e.compiledCache.clear()
+}
+
+// ruleLimits returns the limits of ruleName. The caller must hold e.mu.
+func (e *Engine) ruleLimits(ruleName string) Limits {
+	rule := e.Rules[ruleName]
+	l := e.limits.merge(rule.Limits)
+	if rule.Timeout != 0 {
+		l.MaxExecutionTime = rule.Timeout
+	}
+	return l
+}
+
+// runLimited runs compiled until runCtx, derived from the caller's ctx and
+// bounded by timeout, is done. It returns at that point even while the
+// script is blocked in a module call that ignores the context; the aborted
+// script then stops in the background as soon as the call returns.
+func runLimited(ctx, runCtx context.Context, compiled *tengo.Compiled, timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() { done <- compiled.RunContext(runCtx) }()
+	var err error
+	select {
+	case err = <-done:
+	case <-runCtx.Done():
+		err = runCtx.Err()
+	}
+	switch {
+	case ctx.Err() != nil && errors.Is(err, ctx.Err()):
+		return withCode(CodeCanceled, err)
+	case timeout > 0 && errors.Is(err, context.DeadlineExceeded):
+		return withCode(CodeRuleTimeout, fmt.Errorf("exceeded the execution time limit of %s: %w", timeout, err))
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+package anko
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// LoadDir loads every *.yaml and *.yml file in dir as one source definition.
+//
+// Files are read in lexical order and the documents of each file in order of
+// appearance. Later documents take precedence: env keys, rules, functions
+// and schemas with the same name replace earlier ones (an override is
+// logged), warm URLs are concatenated, and the anko, http and changelog
+// sections are taken from the last document that declares them.
+func (e *Engine) LoadDir(dir string) error {
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return withCode(CodeIO, fmt.Errorf("error listing YAML files: %w", err))
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return withCode(CodeIO, fmt.Errorf("no YAML files in %s", dir))
+	}
+	sort.Strings(files)
+
+	var y YAMLData
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			e.Logger.Error("Error reading YAML file", "error", err)
+			return withCode(CodeIO, fmt.Errorf("error reading YAML file: %w", err))
+		}
+		if err := e.verifyFile(file, data, os.ReadFile); err != nil {
+			return err
+		}
+		if err := e.decodeDocuments(&y, data, file); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	if err := e.apply(y); err != nil {
+		return err
+	}
+	e.Logger.Debug("anko loaded", "dir", dir, "files", len(files))
+	return nil
+}
+
+// decodeDocuments decodes every YAML document in data and merges it into dst,
+// recording where in file the code of each rule starts.
+func (e *Engine) decodeDocuments(dst *YAMLData, data []byte, file string) error {
+	positions := locateRules(data)
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for i := 0; ; i++ {
+		var doc YAMLData
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			e.Logger.Error("Error parsing YAML file", "error", err)
+			return withCode(CodeYAMLInvalid, fmt.Errorf("error parsing YAML: %w", err))
+		}
+		for name, rule := range doc.Rules {
+			if i < len(positions) {
+				rule.pos = positions[i][name]
+			}
+			rule.pos.File = file
+			doc.Rules[name] = rule
+		}
+		e.mergeDocument(dst, doc)
+	}
+}
+
+// mergeDocument merges src into dst with src taking precedence.
+func (e *Engine) mergeDocument(dst *YAMLData, src YAMLData) {
+	if !reflect.ValueOf(src.Metadata).IsZero() {
+		dst.Metadata = src.Metadata
+	}
+	if !reflect.ValueOf(src.HTTP).IsZero() {
+		dst.HTTP = src.HTTP
+	}
+	if !reflect.ValueOf(src.Security).IsZero() {
+		dst.Security = src.Security
+	}
+	if !reflect.ValueOf(src.Chapters).IsZero() {
+		dst.Chapters = src.Chapters
+	}
+	dst.Env = mergeSection(e, "env", dst.Env, src.Env)
+	dst.Secrets = mergeSection(e, "secret", dst.Secrets, src.Secrets)
+	dst.Rules = mergeSection(e, "rule", dst.Rules, src.Rules)
+	dst.Functions = mergeSection(e, "function", dst.Functions, src.Functions)
+	dst.Schemas = mergeSection(e, "schema", dst.Schemas, src.Schemas)
+	dst.Selectors = mergeSection(e, "selector", dst.Selectors, src.Selectors)
+	dst.Warm = append(dst.Warm, src.Warm...)
+	if len(src.Changelog) > 0 {
+		dst.Changelog = src.Changelog
+	}
+}
+
+// mergeSection copies src into dst, logging keys that replace earlier ones.
+func mergeSection[V any](e *Engine, kind string, dst, src map[string]V) map[string]V {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]V, len(src))
+	}
+	for k, v := range src {
+		if _, exists := dst[k]; exists {
+			e.Logger.Debug("Overriding definition", "kind", kind, "name", k)
+		}
+		dst[k] = v
+	}
+	return dst
+}
@@ -0,0 +1,102 @@
+package anko
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync/atomic"
+)
+
+// SetLogger replaces the engine's logger, or restores slog.Default when
+// logger is nil. Engine.Logger keeps pointing at the same logger, which
+// forwards to the replacement, so loggers already handed to modules of
+// cached compilations and to tenants switch over as well. It is safe to call
+// while rules are running.
+func (e *Engine) SetLogger(logger *slog.Logger) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.logs == nil {
+		// The engine was not built by NewEngine; there is nothing to forward.
+		e.Logger = logger
+		return
+	}
+	e.logs.set(logger.Handler())
+}
+
+// newSwitchLogger returns a logger forwarding to the handler of logger
+// (slog.Default when nil) until the returned switch is set to another one.
+func newSwitchLogger(logger *slog.Logger) (*slog.Logger, *logSwitch) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	sw := &logSwitch{}
+	sw.set(logger.Handler())
+	return slog.New(&switchHandler{sw: sw}), sw
+}
+
+// logSwitch holds the handler that the loggers derived from it forward to.
+type logSwitch struct {
+	gen atomic.Uint64
+	cur atomic.Pointer[logTarget]
+}
+
+// logTarget is a handler together with the generation of the switch it was
+// derived for.
+type logTarget struct {
+	h   slog.Handler
+	gen uint64
+}
+
+func (s *logSwitch) set(h slog.Handler) {
+	s.cur.Store(&logTarget{h: h, gen: s.gen.Add(1)})
+}
+
+// switchHandler is a slog.Handler forwarding to the current handler of its
+// switch, with the attributes and groups added through WithAttrs and
+// WithGroup applied on top.
+type switchHandler struct {
+	sw     *logSwitch
+	ops    []func(slog.Handler) slog.Handler
+	cached atomic.Pointer[logTarget]
+}
+
+// handler returns the current handler of the switch with h's attributes and
+// groups applied, rebuilding it only after the switch changed.
+func (h *switchHandler) handler() slog.Handler {
+	cur := h.sw.cur.Load()
+	if len(h.ops) == 0 {
+		return cur.h
+	}
+	if c := h.cached.Load(); c != nil && c.gen == cur.gen {
+		return c.h
+	}
+	handler := cur.h
+	for _, op := range h.ops {
+		handler = op(handler)
+	}
+	h.cached.Store(&logTarget{h: handler, gen: cur.gen})
+	return handler
+}
+
+func (h *switchHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler().Enabled(ctx, level)
+}
+
+func (h *switchHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.handler().Handle(ctx, r)
+}
+
+func (h *switchHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+func (h *switchHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+func (h *switchHandler) with(op func(slog.Handler) slog.Handler) slog.Handler {
+	return &switchHandler{sw: h.sw, ops: append(slices.Clip(h.ops), op)}
+}
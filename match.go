@@ -0,0 +1,130 @@
+package anko
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// DefaultMatchThreshold is the minimum title similarity for a search result
+// to be considered the same novel.
+const DefaultMatchThreshold = 0.85
+
+// AuthorMatchThreshold is the minimum author similarity for a search result
+// to be considered the same novel when both sides know the author. It is
+// lower than the title threshold, since sources romanize and abbreviate
+// author names more freely than titles.
+const AuthorMatchThreshold = 0.6
+
+// Match is a search result on another source that is likely the same novel.
+type Match struct {
+	SourceID string
+	Result   map[string]any
+	Score    float64
+}
+
+// FindMatches searches every registered source except excludeID for the novel
+// described by info. Candidates are scored by fuzzy comparison of the title
+// and alternative titles against threshold; when both sides know the author,
+// an author less similar than AuthorMatchThreshold rejects the candidate.
+// Sources whose search fails are logged and skipped. Matches are returned
+// best first.
+func (m *SourceManager) FindMatches(excludeID string, info NovelInfo, threshold float64) []Match {
+	if threshold <= 0 {
+		threshold = DefaultMatchThreshold
+	}
+	titles := append([]string{info.Title}, info.AltTitles...)
+	ids, engines := m.snapshot()
+
+	var matches []Match
+	for i, e := range engines {
+		if ids[i] == excludeID {
+			continue
+		}
+		for _, title := range titles {
+			if title == "" {
+				continue
+			}
+			results, err := e.SearchRule(map[string]any{"query": title})
+			if err != nil {
+				m.Logger.Warn("FindMatches", "source", ids[i], "query", title, "error", err)
+				continue
+			}
+			if match, ok := bestMatch(ids[i], results, info, titles, threshold); ok {
+				matches = append(matches, match)
+				break
+			}
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	return matches
+}
+
+// bestMatch returns the highest scoring result above threshold.
+func bestMatch(sourceID string, results []map[string]any, info NovelInfo, titles []string, threshold float64) (Match, bool) {
+	var best Match
+	for _, result := range results {
+		candidate := NewNovelInfo(result)
+		if info.Author != "" && candidate.Author != "" &&
+			similarity(info.Author, candidate.Author) < AuthorMatchThreshold {
+			continue
+		}
+		score := 0.0
+		for _, want := range titles {
+			for _, got := range append([]string{candidate.Title}, candidate.AltTitles...) {
+				score = max(score, similarity(want, got))
+			}
+		}
+		if score >= threshold && score > best.Score {
+			best = Match{SourceID: sourceID, Result: result, Score: score}
+		}
+	}
+	return best, best.Result != nil
+}
+
+// normalizeTitle lowercases s and keeps only letters and digits separated by
+// single spaces, so punctuation and spacing differences don't affect matching.
+func normalizeTitle(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space = false
+		} else {
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// similarity returns 1 minus the normalized Levenshtein distance between the
+// normalized forms of a and b.
+func similarity(a, b string) float64 {
+	ra, rb := []rune(normalizeTitle(a)), []rune(normalizeTitle(b))
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(max(len(ra), len(rb)))
+}
@@ -0,0 +1,71 @@
+package anko
+
+import "time"
+
+// RuleStats holds the counters of a single rule. Total and Max are the
+// summed and longest durations of its runs, failed ones included.
+type RuleStats struct {
+	Runs     int
+	Failures int
+	Slow     int
+	Total    time.Duration
+	Max      time.Duration
+}
+
+// SlowRunHook is implemented by hooks that want to be told about runs
+// exceeding the slow-rule threshold (see SetSlowRuleThreshold). SlowRun is
+// called after AfterRun with the run's duration and the threshold.
+type SlowRunHook interface {
+	SlowRun(rule string, duration, threshold time.Duration)
+}
+
+// SetSlowRuleThreshold makes runs that take longer than d count as slow: a
+// warning is logged, Stats.Slow and the rule's RuleStats.Slow are
+// incremented and hooks implementing SlowRunHook are notified. Zero, the
+// default, disables the check.
+func (e *Engine) SetSlowRuleThreshold(d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.slowThreshold = d
+}
+
+// recordRun adds a run of ruleName to the statistics and returns the slow
+// threshold it exceeded, or zero. The caller must hold e.mu.
+func (e *Engine) recordRun(ruleName string, elapsed time.Duration, err error) time.Duration {
+	if e.stats.Rules == nil {
+		e.stats.Rules = make(map[string]RuleStats)
+	}
+	rs := e.stats.Rules[ruleName]
+	e.stats.Runs++
+	rs.Runs++
+	if err != nil {
+		e.stats.Failures++
+		rs.Failures++
+		e.stats.LastFailure, e.stats.LastError = time.Now(), err.Error()
+	} else {
+		e.stats.LastSuccess = time.Now()
+	}
+	rs.Total += elapsed
+	rs.Max = max(rs.Max, elapsed)
+
+	var slow time.Duration
+	if e.slowThreshold > 0 && elapsed > e.slowThreshold {
+		slow = e.slowThreshold
+		e.stats.Slow++
+		rs.Slow++
+		e.Logger.Warn("Slow rule", "source", e.Metadata.Identifier, "rule", ruleName, "duration", elapsed, "threshold", slow)
+	}
+	e.stats.Rules[ruleName] = rs
+	return slow
+}
+
+// Stats returns the statistics of every registered source, keyed by
+// identifier.
+func (m *SourceManager) Stats() map[string]Stats {
+	ids, engines := m.snapshot()
+	out := make(map[string]Stats, len(engines))
+	for i, e := range engines {
+		out[ids[i]] = e.Stats()
+	}
+	return out
+}
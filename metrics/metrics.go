@@ -0,0 +1,261 @@
+// Package metrics collects the metrics of anko engines and exposes them in
+// the Prometheus text format and through expvar, for server deployments.
+//
+//	m := metrics.New()
+//	m.Attach(engine)
+//	http.Handle("/metrics", m.Handler())
+package metrics
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ancientcatz/anko"
+	"github.com/ancientcatz/anko/extras"
+)
+
+// buckets are the upper bounds, in seconds, of the duration histograms.
+var buckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics aggregates the metrics of every attached engine. Its methods are
+// safe for concurrent use.
+type Metrics struct {
+	mu       sync.Mutex
+	engines  map[string]*anko.Engine
+	runs     map[ruleKey]uint64
+	errors   map[errorKey]uint64
+	requests map[requestKey]uint64
+	runDur   map[ruleKey]*histogram
+	compDur  map[ruleKey]*histogram
+}
+
+type ruleKey struct{ source, rule string }
+
+type errorKey struct{ source, rule, code string }
+
+type requestKey struct{ source, method, status string }
+
+// New creates an empty Metrics.
+func New() *Metrics {
+	return &Metrics{
+		engines:  make(map[string]*anko.Engine),
+		runs:     make(map[ruleKey]uint64),
+		errors:   make(map[errorKey]uint64),
+		requests: make(map[requestKey]uint64),
+		runDur:   make(map[ruleKey]*histogram),
+		compDur:  make(map[ruleKey]*histogram),
+	}
+}
+
+// Attach starts collecting the metrics of e, labelled with its source
+// identifier. Attach e once its source is loaded, so the identifier is known.
+func (m *Metrics) Attach(e *anko.Engine) {
+	source := e.GetMetadata().Identifier
+	m.mu.Lock()
+	m.engines[source] = e
+	m.mu.Unlock()
+	e.Use(&engineHook{m: m, source: source})
+}
+
+// engineHook records the events of one engine.
+type engineHook struct {
+	m      *Metrics
+	source string
+}
+
+func (h *engineHook) BeforeRun(string, map[string]any) {}
+
+func (h *engineHook) AfterRun(rule string, _ any, err error, duration time.Duration) {
+	k := ruleKey{h.source, rule}
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+	h.m.runs[k]++
+	if err != nil {
+		h.m.errors[errorKey{h.source, rule, string(anko.Code(err))}]++
+	}
+	observe(h.m.runDur, k, duration)
+}
+
+func (h *engineHook) AfterCompile(rule string, duration time.Duration, _ error) {
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+	observe(h.m.compDur, ruleKey{h.source, rule}, duration)
+}
+
+func (h *engineHook) AfterRequest(info extras.RequestInfo) {
+	status := "error"
+	if info.Status != 0 {
+		status = strconv.Itoa(info.Status)
+	}
+	h.m.mu.Lock()
+	defer h.m.mu.Unlock()
+	h.m.requests[requestKey{h.source, info.Method, status}]++
+}
+
+// histogram counts observations in cumulative buckets.
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func observe(hs map[ruleKey]*histogram, k ruleKey, d time.Duration) {
+	h, ok := hs[k]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(buckets))}
+		hs[k] = h
+	}
+	s := d.Seconds()
+	for i, le := range buckets {
+		if s <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += s
+}
+
+// WritePrometheus writes every metric to w in the Prometheus text exposition
+// format.
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	var b strings.Builder
+	m.mu.Lock()
+	engines := maps.Clone(m.engines)
+
+	header(&b, "anko_rule_runs_total", "counter", "Rule runs, failed ones included.")
+	for _, k := range sortedKeys(m.runs, ruleLess) {
+		fmt.Fprintf(&b, "anko_rule_runs_total{source=%s,rule=%s} %d\n", quote(k.source), quote(k.rule), m.runs[k])
+	}
+	header(&b, "anko_rule_errors_total", "counter", "Failed rule runs by error code.")
+	for _, k := range sortedKeys(m.errors, func(a, b errorKey) bool {
+		return a.source+"\x00"+a.rule+"\x00"+a.code < b.source+"\x00"+b.rule+"\x00"+b.code
+	}) {
+		fmt.Fprintf(&b, "anko_rule_errors_total{source=%s,rule=%s,code=%s} %d\n", quote(k.source), quote(k.rule), quote(k.code), m.errors[k])
+	}
+	header(&b, "anko_http_requests_total", "counter", "Request attempts of the req module by method and status.")
+	for _, k := range sortedKeys(m.requests, func(a, b requestKey) bool {
+		return a.source+"\x00"+a.method+"\x00"+a.status < b.source+"\x00"+b.method+"\x00"+b.status
+	}) {
+		fmt.Fprintf(&b, "anko_http_requests_total{source=%s,method=%s,status=%s} %d\n", quote(k.source), quote(k.method), quote(k.status), m.requests[k])
+	}
+	writeHistograms(&b, "anko_rule_run_duration_seconds", "Duration of rule runs.", m.runDur)
+	writeHistograms(&b, "anko_rule_compile_duration_seconds", "Duration of rule compilations.", m.compDur)
+	m.mu.Unlock()
+
+	// Cache statistics are read from the engines, outside m.mu.
+	ids := slices.Sorted(maps.Keys(engines))
+	stats := make([]anko.CacheStats, len(ids))
+	for i, id := range ids {
+		stats[i] = engines[id].CacheStats()
+	}
+	header(&b, "anko_cache_hits_total", "counter", "Compiled rule cache hits.")
+	for i, id := range ids {
+		fmt.Fprintf(&b, "anko_cache_hits_total{source=%s} %d\n", quote(id), stats[i].Hits)
+	}
+	header(&b, "anko_cache_misses_total", "counter", "Compiled rule cache misses.")
+	for i, id := range ids {
+		fmt.Fprintf(&b, "anko_cache_misses_total{source=%s} %d\n", quote(id), stats[i].Misses)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeHistograms(b *strings.Builder, name, help string, hs map[ruleKey]*histogram) {
+	header(b, name, "histogram", help)
+	for _, k := range sortedKeys(hs, ruleLess) {
+		h := hs[k]
+		labels := "source=" + quote(k.source) + ",rule=" + quote(k.rule)
+		for i, le := range buckets {
+			fmt.Fprintf(b, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, strconv.FormatFloat(le, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(b, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+		fmt.Fprintf(b, "%s_sum{%s} %s\n", name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(b, "%s_count{%s} %d\n", name, labels, h.count)
+	}
+}
+
+func header(b *strings.Builder, name, typ, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// quote returns s as a quoted Prometheus label value.
+func quote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+	return `"` + s + `"`
+}
+
+func ruleLess(a, b ruleKey) bool {
+	return a.source < b.source || a.source == b.source && a.rule < b.rule
+}
+
+func sortedKeys[K comparable, V any](m map[K]V, less func(a, b K) bool) []K {
+	keys := slices.Collect(maps.Keys(m))
+	slices.SortFunc(keys, func(a, b K) int {
+		switch {
+		case less(a, b):
+			return -1
+		case less(b, a):
+			return 1
+		}
+		return 0
+	})
+	return keys
+}
+
+// Handler returns an http.Handler serving the metrics to Prometheus.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.WritePrometheus(w)
+	})
+}
+
+// Publish exposes the metrics as the expvar variable name, served by the
+// expvar handler at /debug/vars. Like expvar.Publish, it panics when name is
+// already in use.
+func (m *Metrics) Publish(name string) {
+	expvar.Publish(name, expvar.Func(m.snapshot))
+}
+
+// snapshot returns the metrics in a JSON-friendly form: rule counters keyed
+// by source and rule, and request counts keyed by source and "METHOD status".
+func (m *Metrics) snapshot() any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rules := make(map[string]map[string]map[string]any)
+	entry := func(k ruleKey) map[string]any {
+		if rules[k.source] == nil {
+			rules[k.source] = make(map[string]map[string]any)
+		}
+		if rules[k.source][k.rule] == nil {
+			rules[k.source][k.rule] = map[string]any{"runs": uint64(0), "errors": uint64(0)}
+		}
+		return rules[k.source][k.rule]
+	}
+	for k, n := range m.runs {
+		entry(k)["runs"] = n
+	}
+	for k, n := range m.errors {
+		e := entry(ruleKey{k.source, k.rule})
+		e["errors"] = e["errors"].(uint64) + n
+	}
+	for k, h := range m.runDur {
+		entry(k)["run_seconds"] = h.sum
+	}
+	requests := make(map[string]map[string]uint64)
+	for k, n := range m.requests {
+		if requests[k.source] == nil {
+			requests[k.source] = make(map[string]uint64)
+		}
+		requests[k.source][k.method+" "+k.status] = n
+	}
+	return map[string]any{"rules": rules, "http_requests": requests}
+}
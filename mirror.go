@@ -0,0 +1,148 @@
+package anko
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	req "github.com/imroc/req/v3"
+)
+
+// defaultMirrorFailureLimit is the number of consecutive runs failing with a
+// network or HTTP error after which the engine rotates to the next mirror.
+const defaultMirrorFailureLimit = 3
+
+// mirrorProbeTimeout bounds how long a single reachability probe may take.
+const mirrorProbeTimeout = 10 * time.Second
+
+// mirrorState tracks which entry of Metadata.Sources is used as base_url.
+type mirrorState struct {
+	index    int
+	selected bool
+	failures int
+}
+
+// Stats holds counters describing the engine's rule executions. Source is
+// the identifier of the source and Rules breaks the runs down by rule.
+// LastSuccess and LastFailure are when the latest successful and failed runs
+// ended, and LastError is the error of the latter.
+type Stats struct {
+	Source          string
+	Runs            int
+	Failures        int
+	Slow            int
+	Mirror          string
+	MirrorRotations int
+	Rules           map[string]RuleStats
+	LastSuccess     time.Time
+	LastFailure     time.Time
+	LastError       string
+	// Cache is the disk usage of the engine's CacheManager, if any.
+	Cache *CacheUsage
+}
+
+// Stats returns a snapshot of the engine's run statistics.
+func (e *Engine) Stats() Stats {
+	e.mu.Lock()
+	s := e.stats
+	s.Source = e.Metadata.Identifier
+	s.Rules = maps.Clone(e.stats.Rules)
+	cache := e.cacheManager
+	e.mu.Unlock()
+	if cache != nil {
+		if usage, err := cache.Usage(); err == nil {
+			s.Cache = &usage
+		} else {
+			e.Logger.Warn("Cannot read cache usage", "error", err)
+		}
+	}
+	return s
+}
+
+// SetMirrorFailureLimit sets how many consecutive runs failing with a network
+// or HTTP error trigger a rotation to the next mirror. Values below 1 restore
+// the default.
+func (e *Engine) SetMirrorFailureLimit(n int) {
+	if n < 1 {
+		n = defaultMirrorFailureLimit
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.mirrorFailureLimit = n
+}
+
+// ensureMirror populates the base_url env from the first reachable entry of
+// Metadata.Sources, starting at the current mirror index. The mirrors are
+// probed with the req module client, so the source's proxy, transport and
+// host allowlist apply. The probes run without e.mu held, so the caller must
+// not hold it; when another run picked a mirror meanwhile, its choice stands.
+func (e *Engine) ensureMirror() {
+	e.mu.Lock()
+	sources, start, probe := e.Metadata.Sources, e.mirror.index, e.probe
+	client := e.moduleConfig.Client
+	selected := e.mirror.selected
+	e.mu.Unlock()
+	if len(sources) == 0 || selected {
+		return
+	}
+
+	chosen := start % len(sources)
+	for i := range sources {
+		idx := (start + i) % len(sources)
+		if probe(client, sources[idx]) {
+			chosen = idx
+			break
+		}
+		e.Logger.Warn("Mirror unreachable", "mirror", sources[idx])
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.mirror.selected || e.mirror.index != start {
+		return
+	}
+	e.mirror.index = chosen
+	e.mirror.selected = true
+	e.mirror.failures = 0
+	e.stats.Mirror = sources[chosen]
+	e.addEnvVar("base_url", sources[chosen])
+	e.Logger.Debug("Mirror selected", "mirror", sources[chosen])
+}
+
+// recordMirrorResult updates the failure streak of the current mirror and
+// rotates to the next one once the failure limit is reached. Only network
+// and HTTP errors count; other failures, such as script errors or invalid
+// results, say nothing about the mirror and leave the streak as it is. The
+// caller must hold e.mu.
+func (e *Engine) recordMirrorResult(err error) {
+	if len(e.Metadata.Sources) < 2 {
+		return
+	}
+	if err == nil {
+		e.mirror.failures = 0
+		return
+	}
+	if code := Code(err); code != CodeHTTP && code != CodeHTTPTimeout {
+		return
+	}
+	e.mirror.failures++
+	if e.mirror.failures < e.mirrorFailureLimit {
+		return
+	}
+	e.Logger.Warn("Rotating mirror", "mirror", e.stats.Mirror, "failures", e.mirror.failures)
+	e.mirror.index = (e.mirror.index + 1) % len(e.Metadata.Sources)
+	e.mirror.selected = false
+	e.stats.MirrorRotations++
+}
+
+// probeMirror reports whether a mirror answers a HEAD request sent with
+// client without a server error.
+func probeMirror(client *req.Client, url string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorProbeTimeout)
+	defer cancel()
+	r, err := client.R().SetContext(ctx).Head(url)
+	if err != nil {
+		return false
+	}
+	return r.StatusCode < 500
+}
@@ -0,0 +1,41 @@
+package anko
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/ancientcatz/anko/extras"
+)
+
+// ModuleUnavailableError reports a rule importing an extra module that is
+// compiled out of this build (see extras.UnavailableModules). Loading a
+// source with such a rule fails with one of these per import.
+type ModuleUnavailableError struct {
+	Rule   string
+	Module string
+	// Hint tells how to build anko with the module.
+	Hint string
+}
+
+func (e *ModuleUnavailableError) Error() string {
+	return fmt.Sprintf("rule '%s' imports module '%s', which is not available in this build: %s", e.Rule, e.Module, e.Hint)
+}
+
+// checkModules returns the joined ModuleUnavailableErrors of the rules.
+func checkModules(rules map[string]Rule) error {
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var errs []error
+	for _, name := range names {
+		for _, imp := range rules[name].Imports {
+			if hint, ok := extras.UnavailableModules[imp]; ok {
+				errs = append(errs, &ModuleUnavailableError{Rule: name, Module: imp, Hint: hint})
+			}
+		}
+	}
+	return withCode(CodeModuleUnavailable, errors.Join(errs...))
+}
@@ -0,0 +1,46 @@
+package anko
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// needsOrder returns the rules ruleName transitively needs followed by
+// ruleName itself, each listed after the rules it needs and only once.
+// The caller must hold e.mu.
+func (e *Engine) needsOrder(ruleName string) ([]string, error) {
+	var order []string
+	done := make(map[string]bool)
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		if done[name] {
+			return nil
+		}
+		for i, p := range path {
+			if p == name {
+				return withCode(CodeRuleDependency, fmt.Errorf("rule dependency cycle: %s", strings.Join(append(path[i:], name), " -> ")))
+			}
+		}
+		rule, exists := e.Rules[name]
+		if !exists {
+			if len(path) == 0 {
+				return withCode(CodeRuleNotFound, fmt.Errorf("rule '%s' not found", name))
+			}
+			return withCode(CodeRuleDependency, fmt.Errorf("rule '%s' needs unknown rule '%s'", path[len(path)-1], name))
+		}
+		next := append(slices.Clone(path), name)
+		for _, dep := range rule.Needs {
+			if err := visit(dep, next); err != nil {
+				return err
+			}
+		}
+		done[name] = true
+		order = append(order, name)
+		return nil
+	}
+	if err := visit(ruleName, nil); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
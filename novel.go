@@ -0,0 +1,134 @@
+package anko
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// NovelInfo is the typed form of an info rule result.
+type NovelInfo struct {
+	Title       string
+	AltTitles   []string
+	Cover       string
+	Author      string
+	Description string
+	Status      string
+	Genres      []string
+	URL         string
+}
+
+// Chapter is the typed form of a chapter-list rule item.
+type Chapter struct {
+	Title string
+	URL   string
+}
+
+// ChapterImage is an image of an image-based chapter, such as a comic page,
+// with the Referer to send when fetching it, since image hosts often refuse
+// requests without one.
+type ChapterImage struct {
+	URL     string
+	Referer string
+}
+
+// NewChapterImages returns the images of a content rule result of the image
+// shape {title, images}, or nil for text chapters.
+func NewChapterImages(content map[string]any) []ChapterImage {
+	items, _ := content["images"].([]any)
+	var images []ChapterImage
+	for _, item := range items {
+		if m, ok := item.(map[string]any); ok {
+			images = append(images, ChapterImage{URL: stringValue(m["url"]), Referer: stringValue(m["referer"])})
+		}
+	}
+	return images
+}
+
+// NewNovelInfo builds a NovelInfo from the map returned by NovelInfoRule.
+// Missing or mistyped keys are left empty.
+func NewNovelInfo(m map[string]any) NovelInfo {
+	return NovelInfo{
+		Title:       stringValue(m["title"]),
+		AltTitles:   stringSlice(m["alt_titles"]),
+		Cover:       stringValue(m["cover"]),
+		Author:      stringValue(m["author"]),
+		Description: stringValue(m["description"]),
+		Status:      stringValue(m["status"]),
+		Genres:      stringSlice(m["genres"]),
+		URL:         stringValue(m["url"]),
+	}
+}
+
+// NewChapters builds typed chapters from the items returned by ChapterListRule.
+func NewChapters(items []map[string]any) []Chapter {
+	chapters := make([]Chapter, len(items))
+	for i, item := range items {
+		chapters[i] = Chapter{
+			Title: stringValue(item["title"]),
+			URL:   stringValue(item["url"]),
+		}
+	}
+	return chapters
+}
+
+// SearchEnv returns a copy of the env of a search rule with the encoded
+// forms of a string "query" added, so sources need not encode it
+// themselves:
+//
+//	query_encoded  percent-encoded, spaces as %20, safe in paths and queries
+//	query_plus     form-encoded, spaces as +, as url_encode returns it
+//
+// Keys already present in envVars are kept.
+func SearchEnv(envVars map[string]any) map[string]any {
+	query, ok := envVars["query"].(string)
+	if !ok {
+		return envVars
+	}
+	env := maps.Clone(envVars)
+	plus := url.QueryEscape(query)
+	derived := map[string]string{
+		"query_encoded": strings.ReplaceAll(plus, "+", "%20"),
+		"query_plus":    plus,
+	}
+	for k, v := range derived {
+		if _, exists := env[k]; !exists {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// stringValue returns v as a string, or "" when v is nil. Bytes are taken
+// as text and times are formatted as RFC 3339.
+func stringValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// stringSlice returns the string elements of an []any value.
+func stringSlice(v any) []string {
+	arr, ok := v.([]any)
+	if !ok {
+		return nil
+	}
+	out := make([]string, 0, len(arr))
+	for _, item := range arr {
+		if item != nil {
+			out = append(out, stringValue(item))
+		}
+	}
+	return out
+}
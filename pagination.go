@@ -0,0 +1,130 @@
+package anko
+
+import (
+	"fmt"
+	"maps"
+)
+
+// Page is one page of a paginated listing. List rules may return, instead of
+// the array of items, a map holding the items and an opaque cursor:
+//
+//	result := {items: items, cursor: next_token}
+//
+// The cursor can be any value, e.g. the token of a cursor-based API or the
+// number of the next page. An undefined cursor ends the listing.
+type Page struct {
+	Items  []map[string]any
+	Cursor any
+}
+
+// Done reports whether p is the last page of its listing.
+func (p Page) Done() bool {
+	return p.Cursor == nil
+}
+
+// pagedRules maps the list rules supporting pages to the env key holding
+// their parameters and the label and required keys of their items.
+var pagedRules = map[string]struct {
+	envKey, label string
+	required      []string
+}{
+	"search":       {"search", "SearchRule", []string{"title", "url"}},
+	"chapter-list": {"chapter_list", "ChapterListRule", []string{"title", "url"}},
+}
+
+// cursorKey identifies the stored cursor of a listing.
+type cursorKey struct{ rule, env string }
+
+// NextPage runs the list rule ruleName, "search" or "chapter-list", with
+// envVars and returns the next page of its listing. The cursor returned with
+// the previous page for the same envVars is passed back to the rule as
+// env.<key>.cursor, and the new one is stored, so repeated calls walk the
+// listing and an interrupted sync resumes where it stopped. After the last
+// page the next call starts over. Loading a new definition drops the stored
+// cursors.
+func (e *Engine) NextPage(ruleName string, envVars map[string]any) (Page, error) {
+	pr, ok := pagedRules[ruleName]
+	if !ok {
+		return Page{}, withCode(CodeConfigInvalid, fmt.Errorf("rule '%s' is not a list rule", ruleName))
+	}
+	key := cursorKey{ruleName, EnvHash(envVars)}
+	env := envVars
+	e.mu.Lock()
+	cursor, resumed := e.cursors[key]
+	e.mu.Unlock()
+	if resumed {
+		env = maps.Clone(envVars)
+		env["cursor"] = cursor
+	}
+	if ruleName == "search" {
+		env = SearchEnv(env)
+	}
+	resultVar, err := e.runRuleAndGetResult(ruleName, map[string]any{pr.envKey: env})
+	if err != nil {
+		return Page{}, err
+	}
+	page, err := e.collectPage(pr.label, resultVar.Value(), pr.required)
+	if err != nil {
+		return Page{}, err
+	}
+	e.mu.Lock()
+	if ruleName == "chapter-list" {
+		page.Items = mergeParts(e.chapterPatterns.merge, page.Items)
+	}
+	if page.Done() {
+		delete(e.cursors, key)
+	} else {
+		if e.cursors == nil {
+			e.cursors = make(map[cursorKey]any)
+		}
+		e.cursors[key] = page.Cursor
+	}
+	e.mu.Unlock()
+	return page, nil
+}
+
+// PageCursor returns the cursor stored by NextPage for ruleName and envVars,
+// e.g. to persist an incremental sync across restarts.
+func (e *Engine) PageCursor(ruleName string, envVars map[string]any) (any, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	cursor, ok := e.cursors[cursorKey{ruleName, EnvHash(envVars)}]
+	return cursor, ok
+}
+
+// SetPageCursor stores cursor as the one NextPage passes to ruleName with
+// envVars next, e.g. one persisted with PageCursor. A nil cursor makes the
+// listing start over.
+func (e *Engine) SetPageCursor(ruleName string, envVars map[string]any, cursor any) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	key := cursorKey{ruleName, EnvHash(envVars)}
+	if cursor == nil {
+		delete(e.cursors, key)
+		return
+	}
+	if e.cursors == nil {
+		e.cursors = make(map[cursorKey]any)
+	}
+	e.cursors[key] = cursor
+}
+
+// collectPage validates the result of a list rule, an array of items or a
+// map of items and cursor, as collectItems does.
+func (e *Engine) collectPage(label string, result any, required []string) (Page, error) {
+	var page Page
+	arr, ok := result.([]any)
+	if m, isMap := result.(map[string]any); isMap {
+		arr, ok = m["items"].([]any)
+		page.Cursor = m["cursor"]
+	}
+	if !ok && result != nil {
+		return Page{}, withCode(CodeValidationType, fmt.Errorf("%s: result must be an array or a map of items and cursor", label))
+	}
+	items, err := e.collectItems(label, arr, required)
+	if err != nil {
+		return Page{}, err
+	}
+	page.Items = items
+	return page, nil
+}
@@ -0,0 +1,147 @@
+package anko
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// sourcePos is where a rule's code starts in its YAML file. Line and Column
+// are those of the first character of the code.
+type sourcePos struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// locateRules returns, for every document in data, the position of the code
+// of each rule in its rules section. Documents that cannot be parsed or have
+// no rules yield an empty map.
+func locateRules(data []byte) []map[string]sourcePos {
+	var out []map[string]sourcePos
+	dec := yamlv3.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yamlv3.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return out
+		}
+		positions := make(map[string]sourcePos)
+		out = append(out, positions)
+		if err != nil {
+			return out
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		rules := mappingValue(doc.Content[0], "rules")
+		if rules == nil || rules.Kind != yamlv3.MappingNode {
+			continue
+		}
+		for i := 0; i+1 < len(rules.Content); i += 2 {
+			code := mappingValue(rules.Content[i+1], "code")
+			if code == nil {
+				continue
+			}
+			positions[rules.Content[i].Value] = codeStart(code, data)
+		}
+	}
+}
+
+// mappingValue returns the value node for key in a mapping node.
+func mappingValue(n *yamlv3.Node, key string) *yamlv3.Node {
+	if n.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// codeStart returns the position of the first character of a scalar's value.
+// Block scalars start on the line after their indicator, indented by the
+// block's indentation.
+func codeStart(n *yamlv3.Node, data []byte) sourcePos {
+	switch n.Style {
+	case yamlv3.LiteralStyle, yamlv3.FoldedStyle:
+		line := n.Line + 1
+		lines := bytes.Split(data, []byte("\n"))
+		for line <= len(lines) && len(bytes.TrimSpace(lines[line-1])) == 0 {
+			line++
+		}
+		indent := 0
+		if line <= len(lines) {
+			indent = len(lines[line-1]) - len(bytes.TrimLeft(lines[line-1], " "))
+		}
+		return sourcePos{Line: line, Column: indent + 1}
+	case yamlv3.DoubleQuotedStyle, yamlv3.SingleQuotedStyle:
+		return sourcePos{Line: n.Line, Column: n.Column + 1}
+	default:
+		return sourcePos{Line: n.Line, Column: n.Column}
+	}
+}
+
+// mainPos matches positions in the main script of Tengo error messages.
+var mainPos = regexp.MustCompile(`\(main\):(\d+):(\d+)`)
+
+// sourcePosition maps a line and column of the compiled script of ruleName
+// back to the rule's YAML source. Without a known YAML position, lines are
+// relative to the code block. ok is false for positions in the preamble.
+// The caller must hold e.mu.
+func (e *Engine) sourcePosition(ruleName string, line, col int) (file string, l, c int, ok bool) {
+	offset, known := e.codeOffsets[ruleName]
+	if !known || line <= offset {
+		return "", line, col, false
+	}
+	line -= offset
+	pos := e.Rules[ruleName].pos
+	if pos.Line == 0 {
+		return pos.File, line, col, true
+	}
+	// Every line of a block scalar shares its indentation.
+	return pos.File, pos.Line + line - 1, col + pos.Column - 1, true
+}
+
+// positionError is a Tengo error whose message points at the YAML source.
+type positionError struct {
+	msg string
+	err error
+}
+
+func (e *positionError) Error() string { return e.msg }
+func (e *positionError) Unwrap() error { return e.err }
+
+// mapErrorPositions rewrites the script positions in err to YAML source
+// positions, keeping err reachable through errors.As.
+// The caller must hold e.mu.
+func (e *Engine) mapErrorPositions(ruleName string, err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	mapped := mainPos.ReplaceAllStringFunc(msg, func(m string) string {
+		parts := mainPos.FindStringSubmatch(m)
+		line, _ := strconv.Atoi(parts[1])
+		col, _ := strconv.Atoi(parts[2])
+		file, line, col, ok := e.sourcePosition(ruleName, line, col)
+		if !ok {
+			return m
+		}
+		if file == "" {
+			file = "(" + ruleName + ")"
+		}
+		return fmt.Sprintf("%s:%d:%d", file, line, col)
+	})
+	if mapped == msg {
+		return err
+	}
+	return &positionError{msg: mapped, err: err}
+}
@@ -0,0 +1,93 @@
+package anko
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// defaultReapInterval is the time between two sweeps of a reaper whose
+// ReaperOptions leave Interval unset.
+const defaultReapInterval = time.Minute
+
+// ReaperOptions configures Reap and the reapers of StartReaper. A zero idle
+// period leaves the matching resources alone.
+type ReaperOptions struct {
+	// Interval is the time between two sweeps of StartReaper; zero means a
+	// minute.
+	Interval time.Duration
+	// ConnIdle closes the idle HTTP connections of engines that have sent no
+	// request for this long.
+	ConnIdle time.Duration
+	// CacheIdle evicts compiled rules that have not run for this long.
+	// Expired compilations (see SetCacheTTL) are evicted by every sweep.
+	CacheIdle time.Duration
+}
+
+// Reap releases the resources of e and its tenants that have been idle for
+// the periods of opts, so that always-on hosts, such as mobile apps, shrink
+// while unused. Hosts can call it directly, e.g. when the app is sent to the
+// background, or run it periodically with StartReaper.
+func (e *Engine) Reap(opts ReaperOptions) {
+	e.mu.Lock()
+	rules := e.compiledCache.reap(opts.CacheIdle)
+	client := e.moduleConfig.Client
+	tenants := slices.Collect(maps.Values(e.tenants))
+	e.mu.Unlock()
+
+	closed := false
+	if opts.ConnIdle > 0 && client != nil && time.Since(time.Unix(0, e.lastRequest.Load())) > opts.ConnIdle {
+		client.GetTransport().CloseIdleConnections()
+		closed = true
+	}
+	if rules > 0 || closed {
+		e.Logger.Debug("Reaped idle resources", "rules", rules, "connections_closed", closed)
+	}
+	for _, t := range tenants {
+		t.Reap(opts)
+	}
+}
+
+// StartReaper runs Reap with opts every opts.Interval in the background
+// until the returned function is called.
+func (e *Engine) StartReaper(opts ReaperOptions) (stop func()) {
+	return startReaper(opts.Interval, func() { e.Reap(opts) })
+}
+
+// StartReaper runs Engine.Reap with opts on every registered source every
+// opts.Interval in the background until the returned function is called.
+func (m *SourceManager) StartReaper(opts ReaperOptions) (stop func()) {
+	return startReaper(opts.Interval, func() {
+		_, engines := m.snapshot()
+		for _, e := range engines {
+			e.Reap(opts)
+		}
+	})
+}
+
+// startReaper calls sweep every interval until stopped.
+func startReaper(interval time.Duration, sweep func()) (stop func()) {
+	if interval <= 0 {
+		interval = defaultReapInterval
+	}
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				sweep()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+		})
+	}
+}
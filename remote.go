@@ -0,0 +1,238 @@
+package anko
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	req "github.com/imroc/req/v3"
+)
+
+// LoadOption configures how a source definition is loaded.
+type LoadOption func(*loadOptions)
+
+type loadOptions struct {
+	checksum  string
+	cacheDir  string
+	verify    func(data, sig []byte) error
+	allowHTTP bool
+}
+
+// WithChecksum requires the downloaded YAML to have the given hex-encoded
+// SHA-256 digest.
+func WithChecksum(sha256Hex string) LoadOption {
+	return func(o *loadOptions) {
+		o.checksum = strings.ToLower(sha256Hex)
+	}
+}
+
+// WithCacheDir caches downloaded definitions in dir and revalidates them with
+// the server's ETag on later loads. The cached copy is used when the server
+// is unreachable. Only definitions that pass their checksum and signature
+// checks are cached, together with their signature.
+func WithCacheDir(dir string) LoadOption {
+	return func(o *loadOptions) {
+		o.cacheDir = dir
+	}
+}
+
+// WithSignature fetches the detached signature published next to the YAML
+// (the same URL with a ".sig" suffix) and rejects the source unless verify
+// accepts it. It replaces the check against the engine's trusted keys (see
+// Engine.SetTrustedKeys).
+func WithSignature(verify func(data, sig []byte) error) LoadOption {
+	return func(o *loadOptions) {
+		o.verify = verify
+	}
+}
+
+// WithInsecureHTTP allows plain http:// URLs, e.g. for a local test server.
+func WithInsecureHTTP() LoadOption {
+	return func(o *loadOptions) {
+		o.allowHTTP = true
+	}
+}
+
+// LoadURL downloads a YAML source definition, verifies it according to opts
+// and populates the Engine.
+func (e *Engine) LoadURL(ctx context.Context, rawURL string, opts ...LoadOption) error {
+	var o loadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return withCode(CodeSourceInvalid, fmt.Errorf("invalid source URL: %w", err))
+	}
+	if u.Scheme != "https" && !(o.allowHTTP && u.Scheme == "http") {
+		return withCode(CodeRemoteInsecure, fmt.Errorf("refusing to load source over %s", u.Scheme))
+	}
+
+	e.mu.Lock()
+	cache := e.cacheManager
+	e.mu.Unlock()
+	if o.cacheDir == "" && cache != nil {
+		if o.cacheDir, err = cache.Dir(CacheSources); err != nil {
+			e.Logger.Error("Cannot create cache directory", "dir", o.cacheDir, "error", err)
+			o.cacheDir = ""
+		}
+	}
+	client := req.C()
+	src, err := fetchSource(ctx, client, rawURL, o.cacheDir)
+	if err != nil {
+		e.Logger.Error("Error downloading source", "url", rawURL, "error", err)
+		return withCode(CodeRemoteFetch, fmt.Errorf("error downloading source: %w", err))
+	}
+	data := src.data
+	if o.checksum != "" {
+		sum := sha256.Sum256(data)
+		if got := hex.EncodeToString(sum[:]); got != o.checksum {
+			e.Logger.Error("Source checksum mismatch", "url", rawURL, "want", o.checksum, "got", got)
+			return withCode(CodeRemoteChecksum, fmt.Errorf("checksum mismatch for %s: got %s", rawURL, got))
+		}
+	}
+	verify := o.verify
+	if verify == nil && e.verifying() {
+		verify = e.verifySignature
+	}
+	if verify != nil {
+		sig := src.sig
+		if sig == nil {
+			r, err := client.R().SetContext(ctx).Get(rawURL + ".sig")
+			if err != nil {
+				return withCode(CodeRemoteFetch, fmt.Errorf("error downloading signature: %w", err))
+			}
+			if r.StatusCode == http.StatusNotFound {
+				e.Logger.Error("Source signature missing", "url", rawURL)
+				return withCode(CodeSourceUnsigned, fmt.Errorf("%s: %w", rawURL, ErrUnsigned))
+			}
+			if r.StatusCode != http.StatusOK {
+				return withCode(CodeRemoteFetch, fmt.Errorf("error downloading signature: status %d", r.StatusCode))
+			}
+			sig = r.Bytes()
+		}
+		if err := verify(data, sig); err != nil {
+			e.Logger.Error("Source signature rejected", "url", rawURL, "error", err)
+			return withCode(CodeRemoteSigned, fmt.Errorf("signature verification failed: %w", err))
+		}
+		src.sig = sig
+	}
+	// Only a verified source is cached, so that the offline copy is never
+	// one that failed its checks.
+	if err := src.store(); err != nil {
+		e.Logger.Error("Cannot cache source", "url", rawURL, "error", err)
+	}
+	if cache != nil {
+		e.trimCache()
+	}
+	if err := e.LoadBytes(data); err != nil {
+		return err
+	}
+	e.Logger.Debug("anko loaded", "url", rawURL)
+	return nil
+}
+
+// fetchedSource is a source definition as fetchSource returned it, together
+// with where it is cached.
+type fetchedSource struct {
+	data []byte
+	// sig is the cached signature of a source served from the cache, if
+	// any.
+	sig  []byte
+	etag string
+	// fresh is set when data was downloaded rather than served from the
+	// cache, and so must be stored there.
+	fresh bool
+
+	dir, dataPath, etagPath, sigPath string
+}
+
+// fetchSource downloads rawURL, revalidating a cached copy in cacheDir with
+// If-None-Match when one exists. The cached copy is also served when the
+// server is unreachable. Downloads are not cached until stored.
+func fetchSource(ctx context.Context, client *req.Client, rawURL, cacheDir string) (*fetchedSource, error) {
+	src := &fetchedSource{dir: cacheDir}
+	var cached []byte
+	request := client.R().SetContext(ctx)
+	if cacheDir != "" {
+		key := sha256.Sum256([]byte(rawURL))
+		name := hex.EncodeToString(key[:])
+		src.dataPath = filepath.Join(cacheDir, name+".yaml")
+		src.etagPath = filepath.Join(cacheDir, name+".etag")
+		src.sigPath = filepath.Join(cacheDir, name+".sig")
+		if data, err := os.ReadFile(src.dataPath); err == nil {
+			cached = data
+			if etag, err := os.ReadFile(src.etagPath); err == nil {
+				request.SetHeader("If-None-Match", string(etag))
+			}
+		}
+	}
+	fromCache := func() (*fetchedSource, error) {
+		touchFile(src.dataPath)
+		src.data = cached
+		if sig, err := os.ReadFile(src.sigPath); err == nil {
+			src.sig = sig
+		}
+		return src, nil
+	}
+
+	r, err := request.Get(rawURL)
+	if err != nil {
+		if cached != nil {
+			return fromCache()
+		}
+		return nil, err
+	}
+	switch {
+	case r.StatusCode == http.StatusNotModified && cached != nil:
+		return fromCache()
+	case r.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("status %d", r.StatusCode)
+	}
+	src.data, src.etag, src.fresh = r.Bytes(), r.Header.Get("ETag"), true
+	return src, nil
+}
+
+// store caches a downloaded source with its ETag and signature, replacing
+// the previous copy, or the signature of a source served from the cache
+// that was cached without one.
+func (s *fetchedSource) store() error {
+	if s.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	if !s.fresh {
+		if s.sig == nil {
+			return nil
+		}
+		return os.WriteFile(s.sigPath, s.sig, 0o644)
+	}
+	if err := os.WriteFile(s.dataPath, s.data, 0o644); err != nil {
+		return err
+	}
+	if err := writeOrRemove(s.etagPath, []byte(s.etag)); err != nil {
+		return err
+	}
+	return writeOrRemove(s.sigPath, s.sig)
+}
+
+// writeOrRemove writes content to the file at path, or removes the file
+// when content is empty.
+func writeOrRemove(path string, content []byte) error {
+	if len(content) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(path, content, 0o644)
+}
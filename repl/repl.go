@@ -0,0 +1,160 @@
+// Package repl implements an interactive Tengo prompt over an anko engine,
+// for experimenting with expressions such as html.query against a fetched
+// page while developing a source.
+//
+//	repl.Run(ctx, engine, os.Stdin, os.Stdout)
+package repl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ancientcatz/anko"
+	"github.com/d5/tengo/v2"
+	"github.com/d5/tengo/v2/parser"
+)
+
+const (
+	prompt         = ">> "
+	continuePrompt = ".. "
+	printlnName    = "__repl_println__"
+)
+
+// session is the state kept between the inputs of a prompt.
+type session struct {
+	ctx         context.Context
+	out         io.Writer
+	modules     *tengo.ModuleMap
+	fileSet     *parser.SourceFileSet
+	symbolTable *tengo.SymbolTable
+	globals     []tengo.Object
+	constants   []tengo.Object
+}
+
+// Run reads Tengo code from in and writes the value of every expression
+// statement, or the error, to out until in is exhausted or ctx is done. The
+// code sees the scope of the engine's rules (see anko.Engine.Scope): env,
+// the source's functions and every module the source may import, whose
+// I/O is bound to ctx. Input spanning several lines, such as a function
+// literal, is read until it parses.
+func Run(ctx context.Context, e *anko.Engine, in io.Reader, out io.Writer) error {
+	scope := e.Scope(ctx)
+	s := &session{
+		ctx:         ctx,
+		out:         out,
+		modules:     scope.Modules,
+		fileSet:     parser.NewFileSet(),
+		symbolTable: tengo.NewSymbolTable(),
+		globals:     make([]tengo.Object, tengo.GlobalsSize),
+	}
+	for idx, fn := range tengo.GetAllBuiltinFunctions() {
+		s.symbolTable.DefineBuiltin(idx, fn.Name)
+	}
+	for name, value := range scope.Globals {
+		s.globals[s.symbolTable.Define(name).Index] = value
+	}
+	s.globals[s.symbolTable.Define(printlnName).Index] = &tengo.UserFunction{
+		Name:  "println",
+		Value: s.println,
+	}
+	if err := s.eval(scope.Preamble); err != nil {
+		return fmt.Errorf("cannot load the source's modules and functions: %w", err)
+	}
+
+	scanner := bufio.NewScanner(in)
+	var input strings.Builder
+	for ctx.Err() == nil {
+		if input.Len() == 0 {
+			fmt.Fprint(out, prompt)
+		} else {
+			fmt.Fprint(out, continuePrompt)
+		}
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+		input.WriteString(scanner.Text())
+		input.WriteByte('\n')
+		if incomplete(input.String()) {
+			continue
+		}
+		if err := s.eval(input.String()); err != nil {
+			fmt.Fprintln(out, err)
+		}
+		input.Reset()
+	}
+	return ctx.Err()
+}
+
+// incomplete reports whether src stops in the middle of a statement, so more
+// lines are needed before it can be evaluated.
+func incomplete(src string) bool {
+	p := parser.NewParser(parser.NewFileSet().AddFile("repl", -1, len(src)), []byte(src), nil)
+	_, err := p.ParseFile()
+	errs, ok := err.(parser.ErrorList)
+	return ok && len(errs) > 0 && strings.HasSuffix(errs[0].Msg, "found 'EOF'")
+}
+
+// eval compiles and runs src in the session, printing the values of its
+// expression statements.
+func (s *session) eval(src string) error {
+	srcFile := s.fileSet.AddFile("repl", -1, len(src))
+	file, err := parser.NewParser(srcFile, []byte(src), nil).ParseFile()
+	if err != nil {
+		return err
+	}
+	file = addPrints(file)
+	c := tengo.NewCompiler(srcFile, s.symbolTable, s.constants, s.modules, nil)
+	if err := c.Compile(file); err != nil {
+		return err
+	}
+	bytecode := c.Bytecode()
+	machine := tengo.NewVM(bytecode, s.globals, -1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			machine.Abort()
+		case <-done:
+		}
+	}()
+	if err := machine.Run(); err != nil {
+		return err
+	}
+	s.constants = bytecode.Constants
+	return nil
+}
+
+// println writes its arguments to the session output.
+func (s *session) println(args ...tengo.Object) (tengo.Object, error) {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		if arg == tengo.UndefinedValue {
+			parts[i] = "<undefined>"
+			continue
+		}
+		parts[i], _ = tengo.ToString(arg)
+	}
+	fmt.Fprintln(s.out, strings.Join(parts, " "))
+	return tengo.UndefinedValue, nil
+}
+
+// addPrints wraps the expression statements of file in calls printing their
+// values.
+func addPrints(file *parser.File) *parser.File {
+	stmts := make([]parser.Stmt, len(file.Stmts))
+	for i, stmt := range file.Stmts {
+		if expr, ok := stmt.(*parser.ExprStmt); ok {
+			stmt = &parser.ExprStmt{Expr: &parser.CallExpr{
+				Func: &parser.Ident{Name: printlnName},
+				Args: []parser.Expr{expr.Expr},
+			}}
+		}
+		stmts[i] = stmt
+	}
+	return &parser.File{InputFile: file.InputFile, Stmts: stmts}
+}
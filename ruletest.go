@@ -0,0 +1,220 @@
+package anko
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/d5/tengo/v2"
+)
+
+// RuleTest is a test case of a rule, declared in its tests section, so
+// source maintainers notice when a site changes its markup:
+//
+//	rules:
+//	  search:
+//	    tests:
+//	      - name: finds a known novel
+//	        env: {search: {query: overlord}}
+//	        now: 2024-05-01T12:00:00Z
+//	        expect:
+//	          0.title: Overlord
+//	        non_empty: [0.url, 0.cover]
+//	        golden: testdata/search.json
+//
+// Env is merged over Engine.Env as in RunRuleWithEnv. Now, when set, is the
+// fixed time anko.now and times.now return during the test. Paths into the result
+// are dot separated map keys and array indexes; an empty path is the result
+// itself. Expect compares values as their JSON encodings, NonEmpty requires
+// the values to exist and not be empty, and Golden, a JSON file relative to
+// the source file, must hold the whole result. A rule with a schema must
+// also satisfy it.
+type RuleTest struct {
+	Name     string         `yaml:"name"`
+	Env      map[string]any `yaml:"env"`
+	Now      time.Time      `yaml:"now"`
+	Expect   map[string]any `yaml:"expect"`
+	NonEmpty []string       `yaml:"non_empty"`
+	Golden   string         `yaml:"golden"`
+}
+
+// TestResult is the outcome of a RuleTest. Failures is empty when the test
+// passed.
+type TestResult struct {
+	Rule     string
+	Name     string
+	Failures []string
+	Duration time.Duration
+}
+
+// Passed reports whether the test passed.
+func (r TestResult) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// RunTests runs the tests of every rule, in rule name order and then in the
+// order they are declared, and returns their results.
+func (e *Engine) RunTests() []TestResult {
+	e.mu.Lock()
+	names := make([]string, 0, len(e.Rules))
+	for name := range e.Rules {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	rules := make(map[string]Rule, len(names))
+	for _, name := range names {
+		rules[name] = e.Rules[name]
+	}
+	e.mu.Unlock()
+
+	var out []TestResult
+	for _, name := range names {
+		rule := rules[name]
+		for i, test := range rule.Tests {
+			if test.Name == "" {
+				test.Name = "#" + strconv.Itoa(i+1)
+			}
+			out = append(out, e.runTest(name, rule.pos.File, test))
+		}
+	}
+	return out
+}
+
+// runTest runs test of ruleName, which was loaded from file.
+func (e *Engine) runTest(ruleName, file string, test RuleTest) TestResult {
+	res := TestResult{Rule: ruleName, Name: test.Name}
+	ctx := context.Background()
+	if !test.Now.IsZero() {
+		ctx = withClock(ctx, fixedClock(test.Now))
+	}
+	start := time.Now()
+	resultVar, err := e.runRuleAndGetResultContext(ctx, ruleName, test.Env)
+	res.Duration = time.Since(start)
+	if err != nil {
+		res.Failures = append(res.Failures, err.Error())
+		return res
+	}
+	result := resultVar.Value()
+
+	e.mu.Lock()
+	schema, ok := e.Schemas[ruleName]
+	e.mu.Unlock()
+	if ok {
+		if err := schema.check("result", result); err != nil {
+			res.Failures = append(res.Failures, err.Error())
+		}
+	}
+	paths := make([]string, 0, len(test.Expect))
+	for path := range test.Expect {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	for _, path := range paths {
+		got, ok := lookupPath(result, path)
+		if !ok {
+			res.Failures = append(res.Failures, fmt.Sprintf("%s: missing", pathName(path)))
+			continue
+		}
+		if !jsonEqual(got, test.Expect[path]) {
+			res.Failures = append(res.Failures, fmt.Sprintf("%s: got %s, want %s", pathName(path), jsonString(got), jsonString(test.Expect[path])))
+		}
+	}
+	for _, path := range test.NonEmpty {
+		got, ok := lookupPath(result, path)
+		if !ok || isEmpty(got) {
+			res.Failures = append(res.Failures, fmt.Sprintf("%s: empty", pathName(path)))
+		}
+	}
+	if test.Golden != "" {
+		golden := test.Golden
+		if !filepath.IsAbs(golden) && file != "" {
+			golden = filepath.Join(filepath.Dir(file), golden)
+		}
+		data, err := os.ReadFile(golden)
+		var want any
+		if err == nil {
+			err = json.Unmarshal(data, &want)
+		}
+		if err != nil {
+			res.Failures = append(res.Failures, fmt.Sprintf("golden file: %v", err))
+		} else if !jsonEqual(result, want) {
+			res.Failures = append(res.Failures, fmt.Sprintf("result differs from golden file %s", test.Golden))
+		}
+	}
+	return res
+}
+
+// lookupPath returns the value at the dot separated path in v.
+func lookupPath(v any, path string) (any, bool) {
+	if path == "" {
+		return v, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch c := v.(type) {
+		case map[string]any:
+			var ok bool
+			if v, ok = c[key]; !ok {
+				return nil, false
+			}
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, false
+			}
+			v = c[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// pathName names path in failure messages.
+func pathName(path string) string {
+	if path == "" {
+		return "result"
+	}
+	return "result." + path
+}
+
+// isEmpty reports whether v is nil, an empty string, array or map.
+func isEmpty(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(v) == ""
+	case []any:
+		return len(v) == 0
+	case map[string]any:
+		return len(v) == 0
+	}
+	return false
+}
+
+// jsonEqual reports whether a and b have equal JSON encodings, so numbers
+// decoded from YAML or JSON compare equal to script integers and floats.
+func jsonEqual(a, b any) bool {
+	var na, nb any
+	if json.Unmarshal([]byte(jsonString(a)), &na) != nil || json.Unmarshal([]byte(jsonString(b)), &nb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(na, nb)
+}
+
+// jsonString returns the JSON encoding of v, converted as for scripts so
+// maps decoded from YAML encode as well, or its Go syntax when it has none.
+func jsonString(v any) string {
+	data, err := json.Marshal(tengo.ToInterface(toTengoObject(v)))
+	if err != nil {
+		return fmt.Sprintf("%#v", v)
+	}
+	return string(data)
+}
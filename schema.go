@@ -0,0 +1,163 @@
+package anko
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"time"
+)
+
+// Schema describes the expected shape of a rule result, declared per rule in
+// the schemas section of the YAML:
+//
+//	schemas:
+//	  search:
+//	    type: array
+//	    items:
+//	      type: map
+//	      required: [title, url]
+//	      fields:
+//	        title: {type: string}
+//	        genres: {type: array, items: {type: string}}
+//
+// Type is one of string, int, float, bool, array, map, bytes, time or any
+// (the default). Required lists the keys a map must hold, Fields the schema of
+// individual map values and Items the schema of every array element.
+type Schema struct {
+	Type     string            `yaml:"type"`
+	Required []string          `yaml:"required"`
+	Fields   map[string]Schema `yaml:"fields"`
+	Items    *Schema           `yaml:"items"`
+}
+
+// schemaTypes lists the accepted values of Schema.Type.
+var schemaTypes = []string{"", "any", "string", "int", "float", "bool", "array", "map", "bytes", "time"}
+
+// validate checks the declaration of s, named by path in errors: its types
+// must be known and items, fields and required used with types that have
+// them.
+func (s Schema) validate(path string) error {
+	if !slices.Contains(schemaTypes, s.Type) {
+		return withCode(CodeConfigInvalid, fmt.Errorf("%s: unknown schema type '%s'", path, s.Type))
+	}
+	anyType := s.Type == "" || s.Type == "any"
+	if s.Items != nil {
+		if !anyType && s.Type != "array" {
+			return withCode(CodeConfigInvalid, fmt.Errorf("%s: items declared for type '%s'", path, s.Type))
+		}
+		if err := s.Items.validate(path + ".items"); err != nil {
+			return err
+		}
+	}
+	if (len(s.Fields) > 0 || len(s.Required) > 0) && !anyType && s.Type != "map" {
+		return withCode(CodeConfigInvalid, fmt.Errorf("%s: fields declared for type '%s'", path, s.Type))
+	}
+	for _, key := range slices.Sorted(maps.Keys(s.Fields)) {
+		if err := s.Fields[key].validate(path + ".fields." + key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunValidated runs ruleName with envVars under the rule's env key in env
+// (the rule's name, or chapter_list for chapter-list), as SearchRule and the
+// other rule helpers do, and checks the result against
+// the rule's declared schema. Rules without a schema return their result
+// unchecked.
+func (e *Engine) RunValidated(ruleName string, envVars map[string]any) (any, error) {
+	resultVar, err := e.runRuleAndGetResult(ruleName, map[string]any{ruleEnvKey(ruleName): envVars})
+	if err != nil {
+		return nil, err
+	}
+	result := resultVar.Value()
+
+	e.mu.Lock()
+	schema, ok := e.Schemas[ruleName]
+	e.mu.Unlock()
+	if !ok {
+		return result, nil
+	}
+	if err := schema.check("result", result); err != nil {
+		e.Logger.Error("Schema validation failed", "rule", ruleName, "error", err)
+		return nil, fmt.Errorf("rule '%s': %w", ruleName, err)
+	}
+	return result, nil
+}
+
+// check validates v against s, naming v by path in errors.
+func (s Schema) check(path string, v any) error {
+	if !slices.Contains(schemaTypes, s.Type) {
+		return withCode(CodeConfigInvalid, fmt.Errorf("%s: unknown schema type '%s'", path, s.Type))
+	}
+	switch s.Type {
+	case "", "any":
+	case "string":
+		if _, ok := v.(string); !ok {
+			return typeError(path, s.Type, v)
+		}
+	case "int":
+		if _, ok := v.(int64); !ok {
+			return typeError(path, s.Type, v)
+		}
+	case "float":
+		switch v.(type) {
+		case float64, int64:
+		default:
+			return typeError(path, s.Type, v)
+		}
+	case "bool":
+		if _, ok := v.(bool); !ok {
+			return typeError(path, s.Type, v)
+		}
+	case "bytes":
+		if _, ok := v.([]byte); !ok {
+			return typeError(path, s.Type, v)
+		}
+	case "time":
+		if _, ok := v.(time.Time); !ok {
+			return typeError(path, s.Type, v)
+		}
+	case "array":
+		if _, ok := v.([]any); !ok {
+			return typeError(path, s.Type, v)
+		}
+	case "map":
+		if _, ok := v.(map[string]any); !ok {
+			return typeError(path, s.Type, v)
+		}
+	}
+
+	if arr, ok := v.([]any); ok && s.Items != nil {
+		for i, item := range arr {
+			if err := s.Items.check(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+	}
+	if m, ok := v.(map[string]any); ok {
+		for _, key := range s.Required {
+			if _, exists := m[key]; !exists {
+				return withCode(CodeValidationMissingKey, fmt.Errorf("%s: missing required key: %s", path, key))
+			}
+		}
+		keys := make([]string, 0, len(s.Fields))
+		for key := range s.Fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if val, exists := m[key]; exists {
+				if err := s.Fields[key].check(path+"."+key, val); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func typeError(path, want string, v any) error {
+	return withCode(CodeValidationType, fmt.Errorf("%s: expected %s, got %T", path, want, v))
+}
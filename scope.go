@@ -0,0 +1,65 @@
+package anko
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/ancientcatz/anko/extras"
+	"github.com/d5/tengo/v2"
+	"github.com/d5/tengo/v2/stdlib"
+)
+
+// Scope is what the code of a rule sees besides its own code, for tools that
+// run code outside of rules, such as the repl package.
+type Scope struct {
+	// Preamble is Tengo code to run before any other code. It imports the
+	// modules and defines the fn_ functions of the source.
+	Preamble string
+	// Modules are the modules the code may import.
+	Modules *tengo.ModuleMap
+	// Globals are the values predefined as globals: env, the registered
+	// functions, host, selectors, features, translate and the context
+	// modules.
+	Globals map[string]tengo.Object
+}
+
+// Scope returns the scope of a rule of the loaded source importing every
+// module and function the source may use, with its context modules bound to
+// ctx. The deny list and declared capabilities apply as they do to rules.
+func (e *Engine) Scope(ctx context.Context) Scope {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var rule Rule
+	for _, name := range slices.Sorted(slices.Values(append(stdlib.AllModuleNames(), extras.AllExtraModuleNames()...))) {
+		if _, ok := capabilityAllowed(name, e.Metadata.Capabilities); ok && !slices.Contains(e.denyLibs, name) {
+			rule.Imports = append(rule.Imports, name)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(e.Functions)) {
+		rule.Imports = append(rule.Imports, "fn:"+name)
+	}
+	preamble, allowedModules := buildPreamble(rule, e.Functions, e.Logger, e.denyLibs, e.Metadata.Capabilities)
+
+	inv := extras.NewInvocation(ctx, e.Logger, e.moduleConfig)
+	globals := extras.ModuleObjects(inv, allowedModules)
+	globals["env"] = createEnvVariable(e.Env, e.converters)
+	for name, fn := range e.funcs {
+		globals[name] = fn
+	}
+	if len(e.hostFuncs) > 0 {
+		globals["host"] = createHostVariable(e.hostFuncs, e.converters)
+	}
+	if len(e.Selectors) > 0 || len(e.selectorOverrides) > 0 {
+		globals["selectors"] = createSelectorsVariable(e.effectiveSelectors())
+	}
+	globals["features"] = e.createFeaturesVariable()
+	if translate := e.translateFunction(); translate != nil {
+		globals["translate"] = translate(ctx)
+	}
+	return Scope{
+		Preamble: preamble,
+		Modules:  extras.GetCustomModuleMap(inv, allowedModules),
+		Globals:  globals,
+	}
+}
@@ -0,0 +1,144 @@
+package anko
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+
+	"github.com/ancientcatz/anko/extras"
+)
+
+// SecretProvider resolves the secrets and ${NAME} references of a source at
+// load time, e.g. from a vault or keychain, so API keys never have to be
+// committed inside rule files.
+type SecretProvider interface {
+	LookupSecret(name string) (string, bool)
+}
+
+// SecretProviderFunc adapts a function to the SecretProvider interface.
+type SecretProviderFunc func(name string) (string, bool)
+
+// LookupSecret calls f.
+func (f SecretProviderFunc) LookupSecret(name string) (string, bool) {
+	return f(name)
+}
+
+// EnvSecrets resolves secrets from the OS environment. It is the default
+// provider.
+var EnvSecrets SecretProvider = SecretProviderFunc(os.LookupEnv)
+
+// WithSecretProvider resolves secrets and ${NAME} references with p instead
+// of the OS environment.
+func WithSecretProvider(p SecretProvider) Option {
+	return func(e *Engine) {
+		e.secrets = p
+	}
+}
+
+// ErrSecretNotFound is returned when a secret or ${NAME} reference of a
+// source cannot be resolved.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// envRef matches ${NAME} references in env values.
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// resolveEnv returns env with ${NAME} references in its string values,
+// nested ones included, replaced and every entry of secrets (env key to
+// secret name) added. Secrets take precedence over env entries of the same
+// key.
+func (e *Engine) resolveEnv(env map[string]any, secrets map[string]string) (map[string]any, error) {
+	provider := e.secrets
+	if provider == nil {
+		provider = EnvSecrets
+	}
+	var missing []string
+	var expand func(v any) any
+	expand = func(v any) any {
+		switch v := v.(type) {
+		case string:
+			return envRef.ReplaceAllStringFunc(v, func(ref string) string {
+				name := envRef.FindStringSubmatch(ref)[1]
+				value, ok := provider.LookupSecret(name)
+				if !ok {
+					missing = append(missing, name)
+				}
+				return value
+			})
+		case []any:
+			out := make([]any, len(v))
+			for i, item := range v {
+				out[i] = expand(item)
+			}
+			return out
+		case map[any]any:
+			out := make(map[any]any, len(v))
+			for k, item := range v {
+				out[k] = expand(item)
+			}
+			return out
+		case map[string]any:
+			out := make(map[string]any, len(v))
+			for k, item := range v {
+				out[k] = expand(item)
+			}
+			return out
+		default:
+			return v
+		}
+	}
+
+	var out map[string]any
+	if env != nil || len(secrets) > 0 {
+		out = make(map[string]any, len(env)+len(secrets))
+	}
+	for k, v := range env {
+		out[k] = expand(v)
+	}
+	for _, key := range slices.Sorted(maps.Keys(secrets)) {
+		value, ok := provider.LookupSecret(secrets[key])
+		if !ok {
+			missing = append(missing, secrets[key])
+			continue
+		}
+		out[key] = value
+	}
+	if len(missing) > 0 {
+		slices.Sort(missing)
+		return nil, withCode(CodeSecretNotFound, fmt.Errorf("%w: %v", ErrSecretNotFound, slices.Compact(missing)))
+	}
+	return out, nil
+}
+
+// SetCredentials sets the credentials of the user at the source with the
+// given identifier, which its rules read with req.credentials, e.g. to log
+// in, instead of having them written into the YAML. They apply while the
+// engine holds that source, including definitions loaded later; zero
+// credentials remove them. Tenant engines start without credentials: a
+// tenant's own are set on the tenant.
+func (e *Engine) SetCredentials(sourceID string, creds extras.Credentials) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if creds == (extras.Credentials{}) {
+		delete(e.credentials, sourceID)
+	} else {
+		if e.credentials == nil {
+			e.credentials = make(map[string]extras.Credentials)
+		}
+		e.credentials[sourceID] = creds
+	}
+	e.moduleConfig.Credentials = e.sourceCredentials()
+	e.compiledCache.clear()
+}
+
+// sourceCredentials returns the credentials of the loaded source, or nil.
+// The caller must hold e.mu.
+func (e *Engine) sourceCredentials() *extras.Credentials {
+	creds, ok := e.credentials[e.Metadata.Identifier]
+	if !ok {
+		return nil
+	}
+	return &creds
+}
@@ -0,0 +1,22 @@
+package anko
+
+import "slices"
+
+// SetAllowedHosts adds hosts to those the req module may contact, on top of
+// the hosts of Metadata.Sources and security.allowed_hosts. Requests to any
+// other host, including redirects, fail with extras.ErrHostNotAllowed. Only
+// sources that declare no mirrors and no allowed hosts may contact any host.
+func (e *Engine) SetAllowedHosts(hosts ...string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.allowedHosts = slices.Clone(hosts)
+	e.moduleConfig.AllowedHosts = e.hostAllowlist()
+	e.rebuildClient()
+	e.compiledCache.clear()
+}
+
+// hostAllowlist returns the hosts the req module may contact; empty means
+// every host. The caller must hold e.mu.
+func (e *Engine) hostAllowlist() []string {
+	return slices.Concat(e.Metadata.Sources, e.Security.AllowedHosts, e.allowedHosts)
+}
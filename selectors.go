@@ -0,0 +1,63 @@
+package anko
+
+import (
+	"maps"
+
+	"github.com/d5/tengo/v2"
+)
+
+// OverrideSelector replaces the selector name of the selectors section for
+// every later run, e.g. to hot-fix a broken XPath without editing the source.
+// Overrides survive loading a new definition; names the source does not
+// define are added. Cached compilations are dropped so the next run sees the
+// new value.
+func (e *Engine) OverrideSelector(name, value string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.selectorOverrides == nil {
+		e.selectorOverrides = make(map[string]string)
+	}
+	e.selectorOverrides[name] = value
+	e.compiledCache.clear()
+}
+
+// ResetSelector drops the override of the selector name, restoring the
+// value of the selectors section.
+func (e *Engine) ResetSelector(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.selectorOverrides[name]; !ok {
+		return
+	}
+	delete(e.selectorOverrides, name)
+	e.compiledCache.clear()
+}
+
+// EffectiveSelectors returns the selectors the rules see: the selectors
+// section with the overrides applied.
+func (e *Engine) EffectiveSelectors() map[string]string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.effectiveSelectors()
+}
+
+// effectiveSelectors implements EffectiveSelectors. The caller must hold
+// e.mu.
+func (e *Engine) effectiveSelectors() map[string]string {
+	out := maps.Clone(e.Selectors)
+	if out == nil {
+		out = make(map[string]string, len(e.selectorOverrides))
+	}
+	maps.Copy(out, e.selectorOverrides)
+	return out
+}
+
+// createSelectorsVariable wraps selectors into the Tengo ImmutableMap
+// scripts see as the selectors global.
+func createSelectorsVariable(selectors map[string]string) *tengo.ImmutableMap {
+	m := make(map[string]tengo.Object, len(selectors))
+	for k, v := range selectors {
+		m[k] = &tengo.String{Value: v}
+	}
+	return &tengo.ImmutableMap{Value: m}
+}
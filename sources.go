@@ -0,0 +1,140 @@
+package anko
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+// SourceManager owns a set of Engines, one per source, indexed by
+// Metadata.Identifier.
+type SourceManager struct {
+	mu      sync.RWMutex
+	engines map[string]*Engine
+	order   []string
+	Logger  *slog.Logger
+}
+
+// NewSourceManager creates an empty SourceManager with the given *slog.Logger.
+// A nil logger logs to slog.Default.
+func NewSourceManager(logger *slog.Logger) *SourceManager {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SourceManager{
+		engines: make(map[string]*Engine),
+		Logger:  logger,
+	}
+}
+
+// Add registers a loaded Engine under its Metadata.Identifier.
+func (m *SourceManager) Add(e *Engine) error {
+	id := e.Metadata.Identifier
+	if id == "" {
+		return withCode(CodeSourceInvalid, fmt.Errorf("source '%s' has no identifier", e.Metadata.Name))
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.engines[id]; exists {
+		return withCode(CodeSourceExists, fmt.Errorf("source '%s' already registered", id))
+	}
+	m.engines[id] = e
+	m.order = append(m.order, id)
+	return nil
+}
+
+// Get returns the Engine registered under id.
+func (m *SourceManager) Get(id string) (*Engine, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.engines[id]
+	return e, ok
+}
+
+// Remove unregisters the source with the given id.
+func (m *SourceManager) Remove(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.engines[id]; !ok {
+		return
+	}
+	delete(m.engines, id)
+	m.order = slices.DeleteFunc(m.order, func(s string) bool { return s == id })
+}
+
+// LoadFile creates an Engine for the YAML file, sharing the manager's logger
+// and the given options, and registers it.
+func (m *SourceManager) LoadFile(filename string, opts ...Option) (*Engine, error) {
+	e := NewEngine(m.Logger, opts...)
+	if err := e.LoadFile(filename); err != nil {
+		return nil, err
+	}
+	if err := m.Add(e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// List returns the metadata of every registered source in registration order.
+func (m *SourceManager) List() []Metadata {
+	_, engines := m.snapshot()
+	out := make([]Metadata, len(engines))
+	for i, e := range engines {
+		out[i] = e.GetMetadata()
+	}
+	return out
+}
+
+// SearchResult is a search result item tagged with the source it came from.
+type SearchResult struct {
+	SourceID string
+	Item     map[string]any
+}
+
+// SearchAll runs the search rule of every source concurrently with
+// {"query": query} and aggregates the results, ordered by source registration
+// and then by each source's own ordering. Sources that fail are reported in
+// the returned error map instead of aborting the search.
+func (m *SourceManager) SearchAll(query string) ([]SearchResult, map[string]error) {
+	ids, engines := m.snapshot()
+	results := make([][]map[string]any, len(engines))
+	errs := make([]error, len(engines))
+
+	var wg sync.WaitGroup
+	for i, e := range engines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = e.SearchRule(map[string]any{"query": query})
+		}()
+	}
+	wg.Wait()
+
+	var out []SearchResult
+	failed := make(map[string]error)
+	for i, items := range results {
+		if errs[i] != nil {
+			m.Logger.Warn("SearchAll", "source", ids[i], "error", errs[i])
+			failed[ids[i]] = errs[i]
+			continue
+		}
+		for _, item := range items {
+			out = append(out, SearchResult{SourceID: ids[i], Item: item})
+		}
+	}
+	return out, failed
+}
+
+// snapshot returns the registered identifiers and engines in insertion order.
+func (m *SourceManager) snapshot() ([]string, []*Engine) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ids := make([]string, len(m.order))
+	engines := make([]*Engine, len(m.order))
+	for i, id := range m.order {
+		ids[i] = id
+		engines[i] = m.engines[id]
+	}
+	return ids, engines
+}
@@ -0,0 +1,184 @@
+package anko
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/ancientcatz/anko/extras"
+)
+
+// stateVersion is the version of the EngineState format written by
+// ExportState.
+const stateVersion = 1
+
+// EngineState is the state of an engine kept on behalf of a user, as
+// exported by ExportState: the session cookies, the credentials set for the
+// source (see SetCredentials), the selector overrides, the glossaries saved
+// in its Store and the page cursors of its listings (see NextPage).
+//
+// Caches are not part of it: compiled rules are rebuilt on demand and the
+// disk caches of a CacheManager belong to the device. The engine keeps no
+// watch subscriptions, so there are none to export; hosts watching novels
+// keep those themselves.
+type EngineState struct {
+	Version     int                 `json:"version"`
+	Source      string              `json:"source"`
+	Cookies     []extras.Cookie     `json:"cookies,omitempty"`
+	Credentials *extras.Credentials `json:"credentials,omitempty"`
+	Selectors   map[string]string   `json:"selectors,omitempty"`
+	Store       map[string][]byte   `json:"store,omitempty"`
+	Cursors     []CursorState       `json:"cursors,omitempty"`
+}
+
+// CursorState is a page cursor stored by NextPage: the cursor of the
+// listing of Rule for the env hashing to Env (see EnvHash).
+type CursorState struct {
+	Rule   string          `json:"rule"`
+	Env    string          `json:"env"`
+	Cursor json.RawMessage `json:"cursor"`
+}
+
+// glossaryPrefix is the prefix of the Store keys of the glossaries of the
+// engine's source, set apart per tenant. The caller must hold e.mu.
+func (e *Engine) glossaryPrefix() string {
+	if e.tenantID != "" {
+		return "tenants/" + e.tenantID + "/glossary/" + e.Metadata.Identifier + "/"
+	}
+	return "glossary/" + e.Metadata.Identifier + "/"
+}
+
+// ExportState returns the user state of the engine as a portable JSON blob
+// (see EngineState), e.g. to move a reader setup to another device with
+// ImportState. Store values are only included when the store implements
+// StoreLister.
+func (e *Engine) ExportState() ([]byte, error) {
+	e.mu.Lock()
+	state := EngineState{
+		Version:     stateVersion,
+		Source:      e.Metadata.Identifier,
+		Selectors:   maps.Clone(e.selectorOverrides),
+		Credentials: e.sourceCredentials(),
+	}
+	for _, key := range slices.SortedFunc(maps.Keys(e.cursors), func(a, b cursorKey) int {
+		return cmp.Or(strings.Compare(a.rule, b.rule), strings.Compare(a.env, b.env))
+	}) {
+		data, err := json.Marshal(e.cursors[key])
+		if err != nil {
+			e.mu.Unlock()
+			return nil, fmt.Errorf("encoding cursor of '%s': %w", key.rule, err)
+		}
+		state.Cursors = append(state.Cursors, CursorState{Rule: key.rule, Env: key.env, Cursor: data})
+	}
+	store, prefix := e.store, e.glossaryPrefix()
+	e.mu.Unlock()
+	state.Cookies = e.ExportCookies()
+	if lister, ok := store.(StoreLister); ok {
+		keys, err := lister.Keys(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("listing store: %w", err)
+		}
+		for _, key := range keys {
+			value, ok, err := store.Load(key)
+			if err != nil {
+				return nil, fmt.Errorf("loading '%s': %w", key, err)
+			}
+			if !ok {
+				continue
+			}
+			if state.Store == nil {
+				state.Store = make(map[string][]byte)
+			}
+			state.Store[strings.TrimPrefix(key, prefix)] = value
+		}
+	}
+	return json.Marshal(state)
+}
+
+// ImportState restores the state exported by ExportState for the same
+// source: its cookies, Store values and page cursors are added, replacing
+// those with the same names, and its credentials and selector overrides
+// applied.
+func (e *Engine) ImportState(data []byte) error {
+	var state EngineState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return withCode(CodeConfigInvalid, fmt.Errorf("decoding engine state: %w", err))
+	}
+	if state.Version != stateVersion {
+		return withCode(CodeConfigInvalid, fmt.Errorf("unsupported engine state version %d", state.Version))
+	}
+	e.mu.Lock()
+	id, store, prefix := e.Metadata.Identifier, e.store, e.glossaryPrefix()
+	e.mu.Unlock()
+	if state.Source != id {
+		return withCode(CodeConfigInvalid, fmt.Errorf("engine state of source '%s' cannot be imported into '%s'", state.Source, id))
+	}
+	cursors := make(map[cursorKey]any, len(state.Cursors))
+	for _, c := range state.Cursors {
+		cursor, err := decodeJSONValue(c.Cursor)
+		if err != nil {
+			return withCode(CodeConfigInvalid, fmt.Errorf("decoding cursor of '%s': %w", c.Rule, err))
+		}
+		if cursor != nil {
+			cursors[cursorKey{c.Rule, c.Env}] = cursor
+		}
+	}
+	for key, value := range state.Store {
+		if err := store.Save(prefix+key, value); err != nil {
+			return fmt.Errorf("saving '%s': %w", key, err)
+		}
+	}
+	e.ImportCookies(state.Cookies)
+	if state.Credentials != nil {
+		e.SetCredentials(id, *state.Credentials)
+	}
+	if len(cursors) > 0 {
+		e.mu.Lock()
+		if e.cursors == nil {
+			e.cursors = make(map[cursorKey]any)
+		}
+		maps.Copy(e.cursors, cursors)
+		e.mu.Unlock()
+	}
+	for name, value := range state.Selectors {
+		e.OverrideSelector(name, value)
+	}
+	return nil
+}
+
+// decodeJSONValue decodes data as the value of a script: integral numbers
+// become int64, as Tengo ints do, and other numbers float64.
+func decodeJSONValue(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return jsonNumbers(v), nil
+}
+
+// jsonNumbers replaces the json.Numbers in v as decodeJSONValue describes.
+func jsonNumbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case []any:
+		for i, item := range v {
+			v[i] = jsonNumbers(item)
+		}
+	case map[string]any:
+		for k, item := range v {
+			v[k] = jsonNumbers(item)
+		}
+	}
+	return v
+}
@@ -0,0 +1,77 @@
+package anko
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Store persists state the engine keeps on behalf of the host, such as
+// glossaries, e.g. in a database or a directory, so it outlives the process.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Load returns the value saved under key and whether there is one.
+	Load(key string) ([]byte, bool, error)
+	// Save saves value under key; a nil value deletes the key.
+	Save(key string, value []byte) error
+}
+
+// StoreLister is implemented by stores that can list their keys. The
+// engine needs it to include the values it saved in ExportState.
+type StoreLister interface {
+	// Keys returns the keys starting with prefix.
+	Keys(prefix string) ([]string, error)
+}
+
+// MemoryStore is a Store keeping values in memory. It is the default store.
+type MemoryStore struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{values: make(map[string][]byte)}
+}
+
+// Load implements Store.
+func (s *MemoryStore) Load(key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[key]
+	return value, ok, nil
+}
+
+// Save implements Store.
+func (s *MemoryStore) Save(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if value == nil {
+		delete(s.values, key)
+		return nil
+	}
+	s.values[key] = value
+	return nil
+}
+
+// Keys implements StoreLister.
+func (s *MemoryStore) Keys(prefix string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for key := range s.values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// WithStore makes the engine and its tenants keep their persistent state in
+// s instead of memory.
+func WithStore(s Store) Option {
+	return func(e *Engine) {
+		e.store = s
+	}
+}
@@ -0,0 +1,121 @@
+package anko
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// TaxonomyTerm is a genre or tag seen in the results of a source, for
+// browse-by-genre UIs of sources without a genre listing.
+type TaxonomyTerm struct {
+	// Name is the most common spelling of the term, or the first seen of
+	// equally common ones.
+	Name string
+	// Slug is the normalized form under which spellings are merged, e.g.
+	// "sci-fi" for "Sci-Fi", "sci fi" and "SCI_FI".
+	Slug string
+	// Kind is "genre" or "tag".
+	Kind string
+	// Count is the number of distinct novels carrying the term.
+	Count int
+	// Variants are the spellings seen, sorted.
+	Variants []string
+}
+
+// taxonomy aggregates the genres and tags of the results of a source. It is
+// shared by the source's tenants.
+type taxonomy struct {
+	mu    sync.Mutex
+	terms map[string]*taxonomyEntry
+}
+
+type taxonomyEntry struct {
+	kind      string
+	slug      string
+	novels    map[string]bool
+	spellings map[string]int
+	order     []string
+}
+
+func newTaxonomy() *taxonomy {
+	return &taxonomy{terms: make(map[string]*taxonomyEntry)}
+}
+
+// record adds the genres and tags of the novel result m to the taxonomy.
+// Novels are told apart by url, or title when they have none.
+func (t *taxonomy) record(m map[string]any) {
+	novel := stringValue(m["url"])
+	if novel == "" {
+		novel = stringValue(m["title"])
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, kind := range []string{"genre", "tag"} {
+		for _, name := range stringSlice(m[kind+"s"]) {
+			name = strings.Join(strings.Fields(name), " ")
+			slug := termSlug(name)
+			if slug == "" {
+				continue
+			}
+			key := kind + "/" + slug
+			entry, ok := t.terms[key]
+			if !ok {
+				entry = &taxonomyEntry{kind: kind, slug: slug, novels: make(map[string]bool), spellings: make(map[string]int)}
+				t.terms[key] = entry
+			}
+			entry.novels[novel] = true
+			if entry.spellings[name] == 0 {
+				entry.order = append(entry.order, name)
+			}
+			entry.spellings[name]++
+		}
+	}
+}
+
+// termSlug returns the lower-case letters and digits of name, with the runs
+// of other characters between them replaced by single hyphens.
+func termSlug(name string) string {
+	var b strings.Builder
+	sep := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if sep && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			sep = false
+		} else {
+			sep = true
+		}
+	}
+	return b.String()
+}
+
+// Taxonomy returns the genres and tags seen in the results of NovelInfoRule
+// and SearchRule since the engine was created, under their "genres" and
+// "tags" keys, most common first. Spellings differing only in case,
+// spacing or punctuation are merged.
+func (e *Engine) Taxonomy() []TaxonomyTerm {
+	e.mu.Lock()
+	t := e.taxonomy
+	e.mu.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]TaxonomyTerm, 0, len(t.terms))
+	for _, entry := range t.terms {
+		name := entry.order[0]
+		for _, v := range entry.order {
+			if entry.spellings[v] > entry.spellings[name] {
+				name = v
+			}
+		}
+		out = append(out, TaxonomyTerm{Name: name, Slug: entry.slug, Kind: entry.kind, Count: len(entry.novels), Variants: slices.Sorted(slices.Values(entry.order))})
+	}
+	slices.SortFunc(out, func(a, b TaxonomyTerm) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Kind, b.Kind), cmp.Compare(a.Slug, b.Slug))
+	})
+	return out
+}
@@ -0,0 +1,82 @@
+package anko
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/ancientcatz/anko/extras"
+)
+
+// Tenant returns the engine serving the tenant with the given id, creating it
+// on first use. A tenant engine runs the same source definition but keeps its
+// own HTTP client and cookie jar, compiled rule cache, env, mirror state,
+// statistics, warm-up and taxonomy, so sessions of different users of one
+// server never mix. Tenants start without credentials (see SetCredentials)
+// and keep their glossaries under keys of their own in the shared Store. The
+// throttle is shared, since it protects the site rather than a user.
+//
+// Loading a new definition into e drops its tenants; later calls return fresh
+// tenant engines for the new definition.
+func (e *Engine) Tenant(id string) *Engine {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if t, ok := e.tenants[id]; ok {
+		return t
+	}
+	t := &Engine{
+		Metadata:      e.Metadata,
+		Env:           maps.Clone(e.Env),
+		Rules:         e.Rules,
+		Functions:     e.Functions,
+		Schemas:       e.Schemas,
+		Selectors:     e.Selectors,
+		Changelog:     e.Changelog,
+		HTTP:          e.HTTP,
+		Security:      e.Security,
+		Chapters:      e.Chapters,
+		Warm:          e.Warm,
+		compiledCache: newRuleCache(),
+		codeOffsets:   make(map[string]int),
+		ruleModules:   make(map[string][]string),
+		CacheEnabled:  e.CacheEnabled,
+		settings:      e.settings,
+		httpClient:    e.httpClient,
+	}
+	t.denyLibs = slices.Clone(e.denyLibs)
+	t.funcs = maps.Clone(e.funcs)
+	t.tenantID = id
+	t.taxonomy = newTaxonomy()
+	t.credentials = nil
+	t.moduleConfig.Credentials = nil
+	t.selectorOverrides = maps.Clone(e.selectorOverrides)
+	t.Logger, t.logs = newSwitchLogger(e.Logger.With("tenant", id))
+	t.compiledCache.size = e.compiledCache.size
+	t.compiledCache.ttl = e.compiledCache.ttl
+	t.moduleConfig.OnRequest = t.observeRequest
+	t.moduleConfig.OnDownload = t.observeDownload
+	t.moduleConfig.Jar = extras.NewCookieJar()
+	t.rebuildClient()
+	if e.tenants == nil {
+		e.tenants = make(map[string]*Engine)
+	}
+	e.tenants[id] = t
+	return t
+}
+
+// RemoveTenant drops the engine of the tenant with the given id together with
+// its cookies and cached state.
+func (e *Engine) RemoveTenant(id string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.tenants, id)
+}
+
+// Tenant returns the engine of the source registered under sourceID for the
+// given tenant; see Engine.Tenant.
+func (m *SourceManager) Tenant(sourceID, tenantID string) (*Engine, bool) {
+	e, ok := m.Get(sourceID)
+	if !ok {
+		return nil, false
+	}
+	return e.Tenant(tenantID), true
+}
@@ -0,0 +1,55 @@
+package anko
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName is the instrumentation scope of the engine's spans.
+const tracerName = "github.com/ancientcatz/anko"
+
+// SetTracerProvider makes the engine record OpenTelemetry spans with tp: an
+// anko.RunRule span per run, with children for building the preamble,
+// compiling and running each script and for every HTTP request of the req
+// module. Spans carry the rule name and source identifier, and request spans
+// the URL. A nil tp turns tracing off, which is the default.
+func (e *Engine) SetTracerProvider(tp trace.TracerProvider) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if tp == nil {
+		e.moduleConfig.Tracer = nil
+		return
+	}
+	e.moduleConfig.Tracer = tp.Tracer(tracerName)
+}
+
+// tracer returns the tracer of the engine, a no-op one when tracing is off.
+// The caller must hold e.mu.
+func (e *Engine) tracer() trace.Tracer {
+	if e.moduleConfig.Tracer == nil {
+		return noop.Tracer{}
+	}
+	return e.moduleConfig.Tracer
+}
+
+// startSpan starts the span name for ruleName with tracer. The caller must
+// hold e.mu.
+func (e *Engine) startSpan(ctx context.Context, tracer trace.Tracer, name, ruleName string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("anko.rule", ruleName),
+		attribute.String("anko.source", e.Metadata.Identifier),
+	))
+}
+
+// endSpan records err, if any, on span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,94 @@
+package anko
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/d5/tengo/v2"
+)
+
+// Translator translates text, e.g. through DeepL or LibreTranslate, for
+// sources whose site is in another language than the reader's. from is the
+// language of the source, empty when unknown, and to the target language.
+// Text may hold HTML markup, which should be preserved.
+type Translator interface {
+	Translate(ctx context.Context, text, from, to string) (string, error)
+}
+
+// TranslatorFunc adapts a function to the Translator interface.
+type TranslatorFunc func(ctx context.Context, text, from, to string) (string, error)
+
+// Translate calls f.
+func (f TranslatorFunc) Translate(ctx context.Context, text, from, to string) (string, error) {
+	return f(ctx, text, from, to)
+}
+
+// WithTranslator translates into the language to with t. Rules get the
+// global function translate(text[, to]), and ContentRule translates the
+// title and content of chapters of sources whose anko.language differs
+// from to. Sources without a language are only translated by their rules.
+func WithTranslator(t Translator, to string) Option {
+	return func(e *Engine) {
+		e.translator = t
+		e.translateTo = to
+	}
+}
+
+// translateFunction returns a constructor of the translate function of a
+// run, bound to the run's context, or nil without a translator. The caller
+// must hold e.mu.
+func (e *Engine) translateFunction() func(ctx context.Context) *tengo.UserFunction {
+	if e.translator == nil {
+		return nil
+	}
+	t, from, to := e.translator, e.Metadata.Language, e.translateTo
+	return func(ctx context.Context) *tengo.UserFunction {
+		return &tengo.UserFunction{
+			Name: "translate",
+			Value: func(args ...tengo.Object) (tengo.Object, error) {
+				if len(args) < 1 || len(args) > 2 {
+					return nil, fmt.Errorf("translate: expected 1 or 2 arguments")
+				}
+				text, ok := tengo.ToString(args[0])
+				if !ok {
+					return nil, fmt.Errorf("translate: text must be a string")
+				}
+				target := to
+				if len(args) == 2 {
+					if target, ok = tengo.ToString(args[1]); !ok {
+						return nil, fmt.Errorf("translate: language must be a string")
+					}
+				}
+				out, err := t.Translate(ctx, text, from, target)
+				if err != nil {
+					return nil, fmt.Errorf("translate: %w", err)
+				}
+				return &tengo.String{Value: out}, nil
+			},
+		}
+	}
+}
+
+// translateContent translates the title and content of a ContentRule result
+// under ctx, the context of the rule's runs, when the source's language
+// differs from the translator's.
+func (e *Engine) translateContent(ctx context.Context, result map[string]any) error {
+	e.mu.Lock()
+	t, from, to := e.translator, e.Metadata.Language, e.translateTo
+	e.mu.Unlock()
+	if t == nil || from == "" || from == to {
+		return nil
+	}
+	for _, key := range []string{"title", "content"} {
+		text, ok := result[key].(string)
+		if !ok || text == "" {
+			continue
+		}
+		out, err := t.Translate(ctx, text, from, to)
+		if err != nil {
+			return fmt.Errorf("ContentRule: translating %s: %w", key, err)
+		}
+		result[key] = out
+	}
+	return nil
+}
@@ -1,10 +1,12 @@
 package anko
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/url"
-	"reflect"
 	"slices"
 	"strings"
 	"unicode"
@@ -14,8 +16,9 @@ import (
 	"github.com/d5/tengo/v2/stdlib"
 )
 
-// buildPreamble constructs the preamble for a rule using the deny list.
-func buildPreamble(rule Rule, functions map[string]string, logger *slog.Logger, denyList []string) (string, []string) {
+// buildPreamble constructs the preamble for a rule using the deny list and,
+// when capabilities is non-nil, the source's declared capabilities.
+func buildPreamble(rule Rule, functions map[string]string, logger *slog.Logger, denyList []string, capabilities []string) (string, []string) {
 	var preamble strings.Builder
 	var allowedModules []string
 
@@ -37,9 +40,17 @@ func buildPreamble(rule Rule, functions map[string]string, logger *slog.Logger,
 				logger.Warn("Import denied", "import", imp)
 				continue
 			}
+			if capability, ok := capabilityAllowed(imp, capabilities); !ok {
+				logger.Warn("Import requires undeclared capability", "import", imp, "capability", capability)
+				continue
+			}
 			if allowedSet[imp] || slices.Contains(extras.AllExtraModuleNames(), imp) {
 				allowedModules = append(allowedModules, imp)
-				preamble.WriteString(fmt.Sprintf("%s := import(\"%s\")\n", imp, imp))
+				// Context modules are passed to the script as globals, so
+				// every run can bind them to its own context.
+				if !extras.IsContextModule(imp) {
+					preamble.WriteString(fmt.Sprintf("%s := import(\"%s\")\n", imp, imp))
+				}
 			} else {
 				logger.Warn("Unrecognized standard import", "import", imp)
 			}
@@ -48,52 +59,33 @@ func buildPreamble(rule Rule, functions map[string]string, logger *slog.Logger,
 	return preamble.String(), allowedModules
 }
 
-// toTengoObject recursively converts a Go value into the corresponding tengo.Object.
-func toTengoObject(v any) tengo.Object {
-	switch v := v.(type) {
-	case string:
-		return &tengo.String{Value: v}
-	case bool:
-		if v {
-			return tengo.TrueValue
-		}
-		return tengo.FalseValue
-	case int:
-		return &tengo.Int{Value: int64(v)}
-	case int8, int16, int32, int64:
-		return &tengo.Int{Value: reflect.ValueOf(v).Int()}
-	case uint, uint8, uint16, uint32, uint64:
-		return &tengo.Int{Value: int64(reflect.ValueOf(v).Uint())}
-	case float32, float64:
-		return &tengo.Float{Value: reflect.ValueOf(v).Float()}
-	case []any:
-		arr := make([]tengo.Object, len(v))
-		for i, e := range v {
-			arr[i] = toTengoObject(e)
-		}
-		return &tengo.Array{Value: arr}
-	case map[string]any:
-		mm := make(map[string]tengo.Object, len(v))
-		for kk, vv := range v {
-			mm[kk] = toTengoObject(vv)
-		}
-		return &tengo.ImmutableMap{Value: mm}
-	default:
-		// fallback: string representation
-		return &tengo.String{Value: fmt.Sprintf("%v", v)}
-	}
-}
-
 // createEnvVariable converts the Env map into a Tengo ImmutableMap,
-// preserving string, bool, numeric, array, and map types.
-func createEnvVariable(envData map[string]any) *tengo.ImmutableMap {
+// preserving string, bool, numeric, array, and map types, with converters
+// consulted first (see RegisterConverter).
+func createEnvVariable(envData map[string]any, converters []Converter) *tengo.ImmutableMap {
 	m := make(map[string]tengo.Object, len(envData))
 	for k, v := range envData {
-		m[k] = toTengoObject(v)
+		m[k] = newConversion(converters).object(v, 0)
 	}
 	return &tengo.ImmutableMap{Value: m}
 }
 
+// EnvHash returns a canonical hash of env for keying per-env state such as
+// result caches. Values are normalized the way they are passed to scripts and
+// encoded as JSON with sorted keys, so equal envs always hash the same
+// regardless of map iteration order.
+func EnvHash(env map[string]any) string {
+	v := tengo.ToInterface(createEnvVariable(env, nil))
+	data, err := json.Marshal(v)
+	if err != nil {
+		// Values JSON cannot encode (e.g. NaN) fall back to fmt, which also
+		// prints maps in key order.
+		data = []byte(fmt.Sprintf("%v", v))
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
 func addURLEncode() *tengo.UserFunction {
 	export := &tengo.UserFunction{
 		Name: "url_encode",
@@ -128,12 +120,6 @@ func addToTitleCase() *tengo.UserFunction {
 	return export
 }
 
-// serializeEnv turns a map into a reproducible string key.
-// You can swap in JSON‑marshal for stable ordering if needed.
-func serializeEnv(envVars map[string]any) string {
-	return fmt.Sprintf("%#v", envVars)
-}
-
 // errorToFields converts an error message into key-value pairs for logging.
 func errorToFields(err error) []any {
 	s := err.Error()
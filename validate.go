@@ -0,0 +1,194 @@
+package anko
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ancientcatz/anko/extras"
+	"github.com/d5/tengo/v2"
+	"github.com/d5/tengo/v2/parser"
+	"github.com/d5/tengo/v2/stdlib"
+)
+
+// RuleError describes a problem found in a rule without running it.
+// Line and Column point into the YAML file the rule was loaded from, or into
+// the rule's code when File is empty; they are zero when the problem has no
+// source position.
+type RuleError struct {
+	Rule    string
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e RuleError) Error() string {
+	if e.Line > 0 && e.File != "" {
+		return fmt.Sprintf("rule '%s' at %s:%d:%d: %s", e.Rule, e.File, e.Line, e.Column, e.Message)
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("rule '%s' at %d:%d: %s", e.Rule, e.Line, e.Column, e.Message)
+	}
+	return fmt.Sprintf("rule '%s': %s", e.Rule, e.Message)
+}
+
+// Validate compiles every rule together with its preamble without running it
+// and reports unresolved imports and needs, dependency cycles and compile
+// errors, sorted by rule name.
+// An empty result means every rule compiles.
+func (e *Engine) Validate() []RuleError {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	names := make([]string, 0, len(e.Rules))
+	for name := range e.Rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	known := extras.ToSet(stdlib.AllModuleNames()...)
+	var out []RuleError
+	for _, name := range names {
+		for _, imp := range e.Rules[name].Imports {
+			if key, ok := strings.CutPrefix(imp, "fn:"); ok {
+				if _, exists := e.Functions[key]; !exists {
+					out = append(out, RuleError{Rule: name, Message: fmt.Sprintf("function '%s' not found", key)})
+				}
+			} else if hint, ok := extras.UnavailableModules[imp]; ok {
+				out = append(out, RuleError{Rule: name, Message: fmt.Sprintf("module '%s' is not available in this build: %s", imp, hint)})
+			} else if !known[imp] && !slices.Contains(extras.AllExtraModuleNames(), imp) {
+				out = append(out, RuleError{Rule: name, Message: fmt.Sprintf("unrecognized import '%s'", imp)})
+			} else if capability, ok := capabilityAllowed(imp, e.Metadata.Capabilities); !ok {
+				out = append(out, RuleError{Rule: name, Message: fmt.Sprintf("import '%s' requires undeclared capability '%s'", imp, capability)})
+			}
+		}
+		if _, err := e.needsOrder(name); err != nil {
+			out = append(out, RuleError{Rule: name, Message: err.Error()})
+		}
+		if _, err := e.compileRule(context.Background(), name); err != nil {
+			re := newRuleError(name, err)
+			if re.Line > 0 {
+				if file, line, col, ok := e.sourcePosition(name, re.Line, re.Column); ok {
+					re.File, re.Line, re.Column = file, line, col
+				}
+			}
+			out = append(out, re)
+		}
+	}
+	return out
+}
+
+// newRuleError extracts the position and message of a Tengo parse or
+// compile error.
+func newRuleError(rule string, err error) RuleError {
+	var compileErr *tengo.CompilerError
+	var parseErrs parser.ErrorList
+	var parseErr *parser.Error
+	switch {
+	case errors.As(err, &compileErr):
+		pos := compileErr.FileSet.Position(compileErr.Node.Pos())
+		return RuleError{Rule: rule, Line: pos.Line, Column: pos.Column, Message: compileErr.Err.Error()}
+	case errors.As(err, &parseErrs) && len(parseErrs) > 0:
+		first := parseErrs[0]
+		return RuleError{Rule: rule, Line: first.Pos.Line, Column: first.Pos.Column, Message: first.Msg}
+	case errors.As(err, &parseErr):
+		return RuleError{Rule: rule, Line: parseErr.Pos.Line, Column: parseErr.Pos.Column, Message: parseErr.Msg}
+	default:
+		return RuleError{Rule: rule, Message: err.Error()}
+	}
+}
+
+// parallelValidateThreshold is the list length from which items are
+// validated in parallel chunks.
+const parallelValidateThreshold = 2048
+
+// validateChunkSize is the number of items a single worker validates.
+const validateChunkSize = 512
+
+// validateItems asserts that every item of arr is a map holding the required
+// keys and collects the maps in the same pass, applying fn (when non-nil) to
+// each. Required keys holding an empty value produce a warning instead of an
+// error. Long lists are split into chunks validated concurrently; the error
+// reported is always the one for the lowest failing index and warnings keep
+// item order.
+func validateItems(label string, arr []any, required []string, fn func(map[string]any)) ([]map[string]any, []string, error) {
+	out := make([]map[string]any, len(arr))
+	check := func(lo, hi int) ([]string, error) {
+		var warnings []string
+		for i := lo; i < hi; i++ {
+			m, ok := arr[i].(map[string]any)
+			if !ok {
+				return nil, withCode(CodeValidationType, fmt.Errorf("%s: item %d is not a map", label, i))
+			}
+			for _, key := range required {
+				v, exists := m[key]
+				if !exists {
+					return nil, withCode(CodeValidationMissingKey, fmt.Errorf("%s: item %d missing required key: %s", label, i, key))
+				}
+				if v == nil || v == "" {
+					warnings = append(warnings, fmt.Sprintf("item %d has empty %s", i, key))
+				}
+			}
+			if fn != nil {
+				fn(m)
+			}
+			out[i] = m
+		}
+		return warnings, nil
+	}
+
+	if len(arr) < parallelValidateThreshold {
+		warnings, err := check(0, len(arr))
+		if err != nil {
+			return nil, nil, err
+		}
+		return out, warnings, nil
+	}
+
+	chunks := (len(arr) + validateChunkSize - 1) / validateChunkSize
+	errs := make([]error, chunks)
+	chunkWarnings := make([][]string, chunks)
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	var wg sync.WaitGroup
+	for c := range chunks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			lo := c * validateChunkSize
+			chunkWarnings[c], errs[c] = check(lo, min(lo+validateChunkSize, len(arr)))
+		}()
+	}
+	wg.Wait()
+	var warnings []string
+	for c, err := range errs {
+		if err != nil {
+			return nil, nil, err
+		}
+		warnings = append(warnings, chunkWarnings[c]...)
+	}
+	return out, warnings, nil
+}
+
+// collectItems validates a list result with validateItems, canonicalizing
+// each item's url and logging the outcome under label.
+func (e *Engine) collectItems(label string, arr []any, required []string) ([]map[string]any, error) {
+	items, warnings, err := validateItems(label, arr, required, func(m map[string]any) {
+		e.canonicalize(m, "url")
+	})
+	if err != nil {
+		e.Logger.Error(label, "error", err)
+		return nil, err
+	}
+	if len(warnings) > 0 {
+		e.Logger.Warn(label, "message", "items with empty required values", "count", len(warnings), "first", warnings[0])
+	}
+	return items, nil
+}
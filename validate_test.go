@@ -0,0 +1,67 @@
+package anko
+
+import (
+	"fmt"
+	"testing"
+)
+
+// benchItems returns a list result of n valid items.
+func benchItems(n int) []any {
+	arr := make([]any, n)
+	for i := range arr {
+		arr[i] = map[string]any{
+			"title": fmt.Sprintf("Chapter %d", i+1),
+			"url":   fmt.Sprintf("https://example.com/novel/chapter-%d", i+1),
+		}
+	}
+	return arr
+}
+
+// validateTwoPass validates arr and then copies its items in a second loop,
+// as SearchRule did before validateItems, for comparison.
+func validateTwoPass(label string, arr []any, required []string) ([]map[string]any, error) {
+	for i, item := range arr {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: item %d is not a map", label, i)
+		}
+		for _, key := range required {
+			if _, exists := m[key]; !exists {
+				return nil, fmt.Errorf("%s: item %d missing required key: %s", label, i, key)
+			}
+		}
+	}
+	out := make([]map[string]any, 0, len(arr))
+	for _, item := range arr {
+		if m, ok := item.(map[string]any); ok {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+// BenchmarkValidateItems compares validateItems with the former two-pass
+// validation on lists below parallelValidateThreshold, validated in one
+// pass, and above it, validated in parallel chunks.
+func BenchmarkValidateItems(b *testing.B) {
+	required := []string{"title", "url"}
+	for _, n := range []int{1000, parallelValidateThreshold - 1, parallelValidateThreshold, 5000, 20000} {
+		arr := benchItems(n)
+		b.Run(fmt.Sprintf("items=%d/single-pass", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, _, err := validateItems("bench", arr, required, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("items=%d/two-pass", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := validateTwoPass("bench", arr, required); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package anko
+
+import (
+	"context"
+	"net/url"
+	"sync"
+)
+
+// warmOnce returns the sync.Once guarding this session's warm-up.
+func (e *Engine) warmOnce() *sync.Once {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.warm == nil {
+		e.warm = &sync.Once{}
+	}
+	return e.warm
+}
+
+// warmUp fetches the source's warm URLs once per session with the session
+// client, so cookies set by a landing page or token endpoint are present for
+// the first rule. Relative URLs are resolved against base_url. The requests
+// are bound to ctx, the context of the run that triggered them. Failures are
+// logged and do not stop the rule.
+func (e *Engine) warmUp(ctx context.Context) {
+	e.warmOnce().Do(func() {
+		e.mu.Lock()
+		urls := e.Warm
+		client := e.moduleConfig.Client
+		base, _ := e.Env["base_url"].(string)
+		e.mu.Unlock()
+
+		for _, raw := range urls {
+			target := raw
+			if base != "" {
+				if b, err := url.Parse(base); err == nil {
+					if ref, err := url.Parse(raw); err == nil {
+						target = b.ResolveReference(ref).String()
+					}
+				}
+			}
+			r, err := client.R().SetContext(ctx).Get(target)
+			if err != nil {
+				e.Logger.Warn("Warm-up request failed", "url", target, "error", err)
+				continue
+			}
+			e.Logger.Debug("Warm-up request", "url", target, "status", r.StatusCode)
+		}
+	})
+}